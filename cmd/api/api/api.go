@@ -3,27 +3,53 @@ package api
 import (
 	"context"
 	_ "embed"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 
+	"gophercon-2025/cmd/api/apikey"
 	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/ingest"
+	"gophercon-2025/cmd/api/limit"
 	"gophercon-2025/cmd/api/llm"
+	"gophercon-2025/cmd/api/provider"
 	"gophercon-2025/cmd/api/rag"
 	"gophercon-2025/cmd/api/telemetry"
+	"gophercon-2025/cmd/api/tokenizer"
+	"gophercon-2025/cmd/api/tool"
 )
 
 type Service struct {
-	llm   *llm.Service
-	rag   *rag.Service
-	cache *cache.Service
-	model string
+	llm          *llm.Service
+	rag          *rag.Service
+	cache        *cache.Service
+	conversation *conversation.Service
+	ingest       *ingest.Service
+	tool         *tool.Service
+	provider     provider.Provider
+	tokenizer    *tokenizer.Service
+	model        string
+	embModel     string
+	mcpPath      string
+	mcp          http.Handler
+	apikey       *apikey.Service
+	limit        *limit.Service
+	checks       []Check
+	config       map[string]any
+	startedAt    time.Time
 
 	metricResponseTime metric.Float64Counter
 }
@@ -36,6 +62,25 @@ func WithModel(model string) Option {
 	}
 }
 
+// WithEmbModel sets the embedding model served by the OpenAI compatible api.
+func WithEmbModel(model string) Option {
+	return func(service *Service) {
+		service.embModel = model
+	}
+}
+
+func WithProvider(p provider.Provider) Option {
+	return func(service *Service) {
+		service.provider = p
+	}
+}
+
+func WithTokenizer(t *tokenizer.Service) Option {
+	return func(service *Service) {
+		service.tokenizer = t
+	}
+}
+
 func WithRag(rag *rag.Service) Option {
 	return func(service *Service) {
 		service.rag = rag
@@ -48,6 +93,40 @@ func WithCache(cache *cache.Service) Option {
 	}
 }
 
+func WithConversation(c *conversation.Service) Option {
+	return func(service *Service) {
+		service.conversation = c
+	}
+}
+
+func WithIngest(i *ingest.Service) Option {
+	return func(service *Service) {
+		service.ingest = i
+	}
+}
+
+func WithTool(t *tool.Service) Option {
+	return func(service *Service) {
+		service.tool = t
+	}
+}
+
+// WithMcp serves an mcp server at path.
+func WithMcp(path string, handler http.Handler) Option {
+	return func(service *Service) {
+		service.mcpPath = path
+		service.mcp = handler
+	}
+}
+
+// WithApiKeys requires an api key with the scopes each operation declares.
+// Without it every route is open.
+func WithApiKeys(k *apikey.Service) Option {
+	return func(service *Service) {
+		service.apikey = k
+	}
+}
+
 func WithLlm(l *llm.Service) Option {
 	return func(service *Service) {
 		service.llm = l
@@ -71,6 +150,129 @@ func (a *Service) middlewareTrace(hctx huma.Context, next func(huma.Context)) {
 	next(hctx)
 }
 
+// securityScheme is the name of the api key auth in the OpenAPI document.
+const securityScheme = "apiKey"
+
+// scopes declares the api key scopes an operation requires, any of them
+// granting access. Operations declaring none are public.
+func scopes(s ...string) []map[string][]string {
+	if len(s) == 0 {
+		return []map[string][]string{{}}
+	}
+
+	return []map[string][]string{{securityScheme: s}}
+}
+
+// requiredScopes returns the scopes op requires. Operations that declare
+// nothing take an admin key, so a route can't be left open by mistake.
+func requiredScopes(op *huma.Operation) (ret []string, public bool) {
+	if op.Security == nil {
+		return []string{apikey.ScopeAdmin}, false
+	}
+
+	for _, req := range op.Security {
+		if len(req) == 0 {
+			return nil, true
+		}
+
+		ret = append(ret, req[securityScheme]...)
+	}
+
+	return ret, false
+}
+
+// bearer returns the api key of an Authorization: Bearer header, the way
+// OpenAI clients send it.
+func bearer(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// middlewareAuth checks the api key of the request against the scopes of the
+// operation. The key goes on in the context, its id as the tool scope so the
+// key policies of the tools file apply.
+func (a *Service) middlewareAuth(humaApi huma.API) func(huma.Context, func(huma.Context)) {
+	return func(hctx huma.Context, next func(huma.Context)) {
+		if a.apikey == nil {
+			next(hctx)
+			return
+		}
+
+		needed, public := requiredScopes(hctx.Operation())
+		if public {
+			next(hctx)
+			return
+		}
+
+		secret, ok := bearer(hctx.Header("Authorization"))
+		if !ok {
+			hctx.SetHeader("WWW-Authenticate", "Bearer")
+			huma.WriteErr(humaApi, hctx, http.StatusUnauthorized, "api key required") //nolint:errcheck
+
+			return
+		}
+
+		key, err := a.apikey.Verify(hctx.Context(), secret)
+
+		switch {
+		case errors.Is(err, apikey.ErrInvalid):
+			hctx.SetHeader("WWW-Authenticate", "Bearer")
+			huma.WriteErr(humaApi, hctx, http.StatusUnauthorized, err.Error()) //nolint:errcheck
+
+			return
+		case err != nil:
+			huma.WriteErr(humaApi, hctx, http.StatusInternalServerError, "failed to verify api key", err) //nolint:errcheck
+
+			return
+		case !slices.ContainsFunc(needed, key.Allows):
+			huma.WriteErr(humaApi, hctx, http.StatusForbidden, //nolint:errcheck
+				fmt.Sprintf("api key %s lacks scope %s", key.Name, strings.Join(needed, " or ")))
+
+			return
+		}
+
+		ctx := apikey.WithKey(hctx.Context(), key)
+		ctx = tool.WithScope(ctx, tool.Scope{KeyID: key.ID})
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("api_key", key.Name))
+
+		next(huma.WithContext(hctx, ctx))
+	}
+}
+
+// verifyMcp authenticates mcp requests with the same api keys. The sdk wants
+// every scope granted and an expiration, keys that never expire are good for
+// the request.
+func (a *Service) verifyMcp(ctx context.Context, secret string, _ *http.Request) (*mcpauth.TokenInfo, error) {
+	key, err := a.apikey.Verify(ctx, secret)
+	if errors.Is(err, apikey.ErrInvalid) {
+		return nil, fmt.Errorf("%w: %w", mcpauth.ErrInvalidToken, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &mcpauth.TokenInfo{UserID: key.ID, Expiration: time.Now().Add(time.Minute)}
+	if key.ExpiresAt != nil {
+		ret.Expiration = *key.ExpiresAt
+	}
+
+	for _, scope := range apikey.Scopes {
+		if key.Allows(scope) {
+			ret.Scopes = append(ret.Scopes, scope)
+		}
+	}
+
+	return ret, nil
+}
+
 func (a *Service) test(_ context.Context, _ *struct{}) (*struct{ Body string }, error) {
 	return &struct{ Body string }{Body: "Hello - I am working"}, nil
 }
@@ -79,7 +281,7 @@ func (a *Service) test(_ context.Context, _ *struct{}) (*struct{ Body string },
 var indexHtml []byte
 
 func New(opt ...Option) http.Handler {
-	service := &Service{}
+	service := &Service{startedAt: time.Now()}
 
 	for _, opt := range opt {
 		opt(service)
@@ -87,20 +289,36 @@ func New(opt ...Option) http.Handler {
 
 	mux := http.NewServeMux()
 
-	humaApi := humago.New(mux, huma.DefaultConfig("gophercon-2025", "1.0.0"))
+	config := huma.DefaultConfig("gophercon-2025", Version)
+	config.Components.SecuritySchemes = map[string]*huma.SecurityScheme{
+		securityScheme: {Type: "http", Scheme: "bearer", Description: "Api key, created with the keys command or endpoints"},
+	}
+
+	humaApi := humago.New(mux, config)
 	humaApi.UseMiddleware(service.middlewareTrace)
+	humaApi.UseMiddleware(service.middlewareAuth(humaApi))
+	humaApi.UseMiddleware(service.middlewareLimit(humaApi))
 
 	huma.Register(humaApi, huma.Operation{
 		OperationID: "apiV1TestGet",
 		Method:      "GET",
 		Path:        "/api/v1/test",
 		Description: "Checks API General Availability",
+		Security:    scopes(),
 	}, service.test)
 
 	service.setupApiRag(humaApi)
 	service.setupApiStatus(humaApi)
+	service.setupApiHealth(humaApi)
 	service.setupApiLlm(humaApi)
 	service.setupApiCache(humaApi)
+	service.setupApiConversation(humaApi)
+	service.setupApiIngest(humaApi)
+	service.setupApiExport(humaApi)
+	service.setupApiTool(humaApi)
+	service.setupApiKpi(humaApi)
+	service.setupApiOpenai(humaApi)
+	service.setupApiKeys(humaApi)
 
 	var err error
 
@@ -109,6 +327,17 @@ func New(opt ...Option) http.Handler {
 		panic(err)
 	}
 
+	if service.mcp != nil && service.mcpPath != "" {
+		mcpHandler := service.mcp
+		if service.apikey != nil {
+			mcpHandler = mcpauth.RequireBearerToken(service.verifyMcp, &mcpauth.RequireBearerTokenOptions{
+				Scopes: []string{apikey.ScopeQuery},
+			})(mcpHandler)
+		}
+
+		mux.Handle(service.mcpPath, mcpHandler)
+	}
+
 	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
 		writer.Write(indexHtml) //nolint:errcheck
 	})
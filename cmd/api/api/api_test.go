@@ -0,0 +1,370 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/limit"
+	"gophercon-2025/cmd/api/llm"
+	"gophercon-2025/cmd/api/provider"
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/sqldb"
+	"gophercon-2025/cmd/api/telemetry"
+	"gophercon-2025/cmd/api/tokenizer"
+	"gophercon-2025/cmd/api/tool"
+)
+
+func TestMain(m *testing.M) {
+	telemetry.Tracer = tracenoop.NewTracerProvider().Tracer("")
+	telemetry.Meter = metricnoop.NewMeterProvider().Meter("")
+
+	os.Exit(m.Run())
+}
+
+// newTestApi serves the api answering through p, with in-memory stores.
+func newTestApi(t *testing.T, p provider.Provider, toolService *tool.Service, opts ...Option) http.Handler {
+	t.Helper()
+
+	embed := provider.EmbeddingFunc(p, "fake")
+
+	ragService, err := rag.New(
+		rag.WithDb(chromem.NewDB()),
+		rag.WithEmbeddingFunc(embed),
+		rag.WithTracer(telemetry.Tracer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheService, err := cache.New(
+		cache.WithDb(chromem.NewDB()),
+		cache.WithEmbeddingFunc(embed),
+		cache.WithTracer(telemetry.Tracer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if toolService == nil {
+		toolService = tool.New(tool.WithTracer(telemetry.Tracer))
+	}
+
+	tokenizerService := tokenizer.New(tokenizer.WithWhitespace())
+
+	llmService := llm.New(
+		llm.WithProvider(p),
+		llm.WithRag(ragService),
+		llm.WithCache(cacheService),
+		llm.WithTool(toolService),
+		llm.WithTokenizer(tokenizerService),
+		llm.WithLogger(slog.New(slog.DiscardHandler)),
+		llm.WithTracer(telemetry.Tracer),
+		llm.WithMetrics(telemetry.Meter),
+		llm.WithMinConfidenceRag(0.8),
+		llm.WithMinConfidenceTool(0.6),
+		llm.WithMinConfidenceCache(0.9),
+		llm.WithMaxAgentSteps(4),
+	)
+
+	return New(append([]Option{
+		WithProvider(p),
+		WithRag(ragService),
+		WithCache(cacheService),
+		WithTool(toolService),
+		WithTokenizer(tokenizerService),
+		WithLlm(llmService),
+	}, opts...)...)
+}
+
+func newTestKeys(t *testing.T) *apikey.Service {
+	t.Helper()
+
+	db, dialect, err := sqldb.Open("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	ret, err := apikey.New(apikey.WithDb(db, dialect), apikey.WithTracer(telemetry.Tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func newTestKey(t *testing.T, keys *apikey.Service, name string, scopes ...string) (apikey.Key, string) {
+	t.Helper()
+
+	key, secret, err := keys.Create(context.Background(), name, scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, secret
+}
+
+// do serves a request with body encoded as json, authenticated by secret
+// when there is one.
+func do(h http.Handler, method string, path string, secret string, body any) *httptest.ResponseRecorder {
+	var reader bytes.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			panic(err)
+		}
+
+		reader.Reset(data)
+	}
+
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+var query = map[string]any{"query": "Quando o suporte abre?"}
+
+func TestAuthScopes(t *testing.T) {
+	ctx := context.Background()
+	keys := newTestKeys(t)
+	h := newTestApi(t, provider.NewFake(), nil, WithApiKeys(keys))
+
+	_, querySecret := newTestKey(t, keys, "query", apikey.ScopeQuery)
+	_, ragSecret := newTestKey(t, keys, "rag", apikey.ScopeRagWrite)
+	_, adminSecret := newTestKey(t, keys, "admin", apikey.ScopeAdmin)
+	revoked, revokedSecret := newTestKey(t, keys, "revoked", apikey.ScopeQuery)
+
+	if err := keys.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		secret string
+		want   int
+	}{
+		{name: "public", method: http.MethodGet, path: "/api/v1/test", want: http.StatusOK},
+		{name: "no key", method: http.MethodPost, path: "/api/v1/llm", want: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodPost, path: "/api/v1/llm", secret: "sk-nope", want: http.StatusUnauthorized},
+		{name: "revoked key", method: http.MethodPost, path: "/api/v1/llm", secret: revokedSecret, want: http.StatusUnauthorized},
+		{name: "missing scope", method: http.MethodPost, path: "/api/v1/llm", secret: ragSecret, want: http.StatusForbidden},
+		{name: "scope", method: http.MethodPost, path: "/api/v1/llm", secret: querySecret, want: http.StatusOK},
+		{name: "admin", method: http.MethodPost, path: "/api/v1/llm", secret: adminSecret, want: http.StatusOK},
+		{name: "admin only", method: http.MethodGet, path: "/api/v1/keys", secret: querySecret, want: http.StatusForbidden},
+		{name: "admin only with admin", method: http.MethodGet, path: "/api/v1/keys", secret: adminSecret, want: http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var body any
+			if tt.method == http.MethodPost {
+				body = query
+			}
+
+			rec := do(h, tt.method, tt.path, tt.secret, body)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Fatal("missing WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestAuthToolScope(t *testing.T) {
+	keys := newTestKeys(t)
+
+	denied, deniedSecret := newTestKey(t, keys, "denied", apikey.ScopeQuery)
+	_, allowedSecret := newTestKey(t, keys, "allowed", apikey.ScopeQuery)
+
+	// policies are keyed by the key id, only known once it is created
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+
+	err := os.WriteFile(path, []byte("policies:\n  keys:\n    "+denied.ID+":\n      deny: [date]\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		secret string
+		denied bool
+	}{
+		{name: "denied", secret: deniedSecret, denied: true},
+		{name: "allowed", secret: allowedSecret},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := provider.NewFake(`{"type": "TOOL", "tool": "date", "confidence": 0.9}`)
+			toolService := tool.New(tool.WithTracer(telemetry.Tracer), tool.WithConfig(path))
+			h := newTestApi(t, fake, toolService, WithApiKeys(keys))
+
+			rec := do(h, http.MethodPost, "/api/v1/llm", tt.secret, map[string]any{"query": "Que dia e hoje?", "details": true})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+
+			var ret llm.Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &ret); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ret.Steps) != 1 {
+				t.Fatalf("%d steps, want 1", len(ret.Steps))
+			}
+
+			if denied := strings.Contains(ret.Steps[0].Error, tool.ErrDenied.Error()); denied != tt.denied {
+				t.Fatalf("denied = %v, want %v: %+v", denied, tt.denied, ret.Steps[0])
+			}
+		})
+	}
+}
+
+// blockingProvider holds every chat until release is closed, telling on
+// started when one begins.
+type blockingProvider struct {
+	*provider.Fake
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProvider) Chat(ctx context.Context, req provider.ChatRequest, fn provider.StreamFunc) (string, error) {
+	p.started <- struct{}{}
+	<-p.release
+
+	return p.Fake.Chat(ctx, req, fn)
+}
+
+func TestLimit(t *testing.T) {
+	t.Run("rate", func(t *testing.T) {
+		keys := newTestKeys(t)
+		limits := limit.New(limit.WithRate(0.01, 1))
+		h := newTestApi(t, provider.NewFake(), nil, WithApiKeys(keys), WithLimits(limits))
+
+		_, first := newTestKey(t, keys, "first", apikey.ScopeQuery)
+		_, second := newTestKey(t, keys, "second", apikey.ScopeQuery)
+
+		if rec := do(h, http.MethodPost, "/api/v1/llm", first, query); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+
+		rec := do(h, http.MethodPost, "/api/v1/llm", first, query)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status %d, want 429", rec.Code)
+		}
+
+		if got := rec.Header().Get("Retry-After"); got != "100" {
+			t.Fatalf("Retry-After %q, want 100", got)
+		}
+
+		// buckets are per key
+		if rec := do(h, http.MethodPost, "/api/v1/llm", second, query); rec.Code != http.StatusOK {
+			t.Fatalf("other key got status %d: %s", rec.Code, rec.Body)
+		}
+
+		// only generations are limited
+		if rec := do(h, http.MethodGet, "/api/v1/test", "", nil); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		p := &blockingProvider{Fake: provider.NewFake(), started: make(chan struct{}), release: make(chan struct{})}
+		limits := limit.New(limit.WithRate(0, 1), limit.WithConcurrency(1), limit.WithQueue(0))
+		h := newTestApi(t, p, nil, WithLimits(limits))
+
+		done := make(chan int)
+
+		go func() {
+			done <- do(h, http.MethodPost, "/api/v1/llm", "", query).Code
+		}()
+
+		select {
+		case <-p.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("first generation did not start")
+		}
+
+		rec := do(h, http.MethodPost, "/api/v1/llm", "", query)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("status %d Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+
+		close(p.release)
+
+		if code := <-done; code != http.StatusOK {
+			t.Fatalf("first generation got status %d", code)
+		}
+	})
+}
+
+func TestOpenaiErrors(t *testing.T) {
+	h := newTestApi(t, provider.NewFake(), nil)
+
+	for _, tt := range []struct {
+		name string
+		path string
+		body any
+	}{
+		{
+			name: "chat without a user message",
+			path: "/v1/chat/completions",
+			body: map[string]any{"model": "x", "messages": []map[string]any{{"role": "system", "content": "seja breve"}}},
+		},
+		{
+			name: "embeddings of tokens",
+			path: "/v1/embeddings",
+			body: map[string]any{"model": "x", "input": []int{1, 2}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(h, http.MethodPost, tt.path, "", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("content type %q", ct)
+			}
+
+			var ret map[string]map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &ret); err != nil {
+				t.Fatal(err)
+			}
+
+			if ret["error"]["type"] != "invalid_request_error" || ret["error"]["message"] == "" {
+				t.Fatalf("got %s, want an OpenAI error", rec.Body)
+			}
+
+			if code, ok := ret["error"]["code"]; !ok || code != nil {
+				t.Fatalf("code %v, want null", code)
+			}
+		})
+	}
+}
@@ -5,6 +5,10 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/philippgille/chromem-go"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/rag"
 )
 
 type (
@@ -44,7 +48,7 @@ type cacheQueryResponse struct {
 }
 
 func (a *Service) cacheQuery(ctx context.Context, req *cacheQueryRequest) (*cacheQueryResponse, error) {
-	docs, err := a.cache.Query(ctx, req.Q)
+	docs, err := a.cache.Query(ctx, req.Q, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +85,7 @@ func (a *Service) setupApiCache(humaApi huma.API) {
 		Method:      "POST",
 		Path:        "/api/v1/cache/op/clear",
 		Description: "Clears cache content",
+		Security:    scopes(apikey.ScopeCacheAdmin),
 	}, a.cacheClear)
 
 	huma.Register(humaApi, huma.Operation{
@@ -88,6 +93,7 @@ func (a *Service) setupApiCache(humaApi huma.API) {
 		Method:      "GET",
 		Path:        "/api/v1/cache",
 		Description: "Queries cache",
+		Security:    scopes(apikey.ScopeCacheAdmin),
 	}, a.cacheQuery)
 
 	huma.Register(humaApi, huma.Operation{
@@ -95,6 +101,7 @@ func (a *Service) setupApiCache(humaApi huma.API) {
 		Method:      "POST",
 		Path:        "/api/v1/cache",
 		Description: "Adds entry to cache",
+		Security:    scopes(apikey.ScopeCacheAdmin),
 	}, a.cacheAdd)
 
 	huma.Register(humaApi, huma.Operation{
@@ -102,5 +109,54 @@ func (a *Service) setupApiCache(humaApi huma.API) {
 		Method:      "DELETE",
 		Path:        "/api/v1/cache/{id}",
 		Description: "Dels entry from cache",
+		Security:    scopes(apikey.ScopeCacheAdmin),
 	}, a.cacheDel)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagDependentsGet",
+		Method:      "GET",
+		Path:        "/api/v1/rag/{id}/dependents",
+		Description: "Lists the cache entries built from a rag fact, which are dropped when it changes",
+		Security:    scopes(apikey.ScopeCacheAdmin),
+	}, a.cacheDependents)
+}
+
+type cacheDependentsRequest struct {
+	Id string `path:"id"`
+	Ns string `json:"ns" query:"ns"`
+}
+
+type cacheDependent struct {
+	ID       string            `json:"id"`
+	Query    string            `json:"query"`
+	Response string            `json:"response"`
+	Meta     map[string]string `json:"meta"`
+}
+
+type cacheDependentsResponse struct {
+	Body []cacheDependent
+}
+
+func (a *Service) cacheDependents(ctx context.Context, req *cacheDependentsRequest) (*cacheDependentsResponse, error) {
+	ns := req.Ns
+	if ns == "" {
+		ns = rag.DefaultNamespace
+	}
+
+	docs, err := a.cache.Dependents(ctx, ns, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]cacheDependent, 0, len(docs))
+	for _, doc := range docs {
+		ret = append(ret, cacheDependent{
+			ID:       doc.ID,
+			Query:    doc.Content,
+			Response: doc.Metadata[cache.MetaResponse],
+			Meta:     doc.Metadata,
+		})
+	}
+
+	return &cacheDependentsResponse{Body: ret}, nil
 }
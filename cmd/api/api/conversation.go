@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/llm"
+)
+
+func conversationErr(err error) error {
+	if errors.Is(err, conversation.ErrNotFound) {
+		return huma.Error404NotFound(err.Error())
+	}
+
+	return ragErr(err)
+}
+
+type conversationCreateRequest struct {
+	Body struct {
+		Title string `json:"title,omitempty"`
+	}
+}
+
+type conversationResponse struct {
+	Body conversation.Conversation
+}
+
+func (a *Service) conversationCreate(ctx context.Context, req *conversationCreateRequest) (*conversationResponse, error) {
+	ret, err := a.conversation.Create(ctx, req.Body.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversationResponse{Body: ret}, nil
+}
+
+type conversationListRequest struct{}
+
+type conversationListResponse struct {
+	Body []conversation.Conversation
+}
+
+func (a *Service) conversationList(ctx context.Context, _ *conversationListRequest) (*conversationListResponse, error) {
+	ret, err := a.conversation.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversationListResponse{Body: ret}, nil
+}
+
+type conversationGetRequest struct {
+	Id string `path:"id"`
+}
+
+func (a *Service) conversationGet(ctx context.Context, req *conversationGetRequest) (*conversationResponse, error) {
+	ret, err := a.conversation.Get(ctx, req.Id)
+	if err != nil {
+		return nil, conversationErr(err)
+	}
+
+	return &conversationResponse{Body: ret}, nil
+}
+
+type conversationContinueRequest struct {
+	Id   string `path:"id"`
+	Body struct {
+		Query      string   `json:"query,omitempty"`
+		Details    bool     `json:"details,omitempty"`
+		Namespaces []string `json:"namespaces,omitempty"`
+	}
+}
+
+type conversationContinueResponse struct {
+	Body any
+}
+
+func (a *Service) conversationContinue(ctx context.Context, req *conversationContinueRequest) (*conversationContinueResponse, error) {
+	ret, _, err := a.llm.Converse(ctx, req.Id, llm.Request{
+		Query:      req.Body.Query,
+		Namespaces: req.Body.Namespaces,
+	}, nil)
+	if err != nil {
+		return nil, conversationErr(err)
+	}
+
+	if req.Body.Details {
+		return &conversationContinueResponse{Body: ret}, nil
+	}
+
+	return &conversationContinueResponse{Body: ret.Response}, nil
+}
+
+type conversationDelRequest struct {
+	Id string `path:"id"`
+}
+
+type conversationDelResponse struct{}
+
+func (a *Service) conversationDel(ctx context.Context, req *conversationDelRequest) (*conversationDelResponse, error) {
+	if err := a.conversation.Delete(ctx, req.Id); err != nil {
+		return nil, conversationErr(err)
+	}
+
+	return &conversationDelResponse{}, nil
+}
+
+func (a *Service) setupApiConversation(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ConversationPost",
+		Method:      "POST",
+		Path:        "/api/v1/conversations",
+		Description: "Creates a conversation",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.conversationCreate)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ConversationListGet",
+		Method:      "GET",
+		Path:        "/api/v1/conversations",
+		Description: "Lists conversations",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.conversationList)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ConversationGet",
+		Method:      "GET",
+		Path:        "/api/v1/conversations/{id}",
+		Description: "Retrieves a conversation and its messages",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.conversationGet)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ConversationMessagePost",
+		Method:      "POST",
+		Path:        "/api/v1/conversations/{id}/messages",
+		Description: "Continues a conversation",
+		Security:    scopes(apikey.ScopeQuery),
+		Metadata:    generates(),
+	}, a.conversationContinue)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ConversationDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/conversations/{id}",
+		Description: "Dels a conversation",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.conversationDel)
+}
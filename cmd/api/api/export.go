@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/vecdb"
+)
+
+const contentTypeJsonl = "application/x-ndjson"
+
+type exportRequest struct {
+	Ns         []string `json:"ns" query:"ns"`
+	Embeddings bool     `json:"embeddings" query:"embeddings"`
+}
+
+// importRequest hands the body over as it comes, records are read as they
+// arrive instead of the whole export being held in memory.
+type importRequest struct {
+	body io.Reader
+}
+
+func (r *importRequest) Resolve(hctx huma.Context) []error {
+	r.body = hctx.BodyReader()
+
+	return nil
+}
+
+// jsonlBody documents the body of imports, which huma does not read.
+var jsonlBody = &huma.RequestBody{
+	Required:    true,
+	Description: "JSONL export, one record per line",
+	Content: map[string]*huma.MediaType{
+		contentTypeJsonl: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+	},
+}
+
+// flushWriter flushes the response after every page of an export, so it
+// reaches the client as it is written.
+type flushWriter struct {
+	io.Writer
+}
+
+func (w flushWriter) Flush() error {
+	return flush(w.Writer)
+}
+
+type importResponse struct {
+	Body struct {
+		Imported int `json:"imported"`
+	}
+}
+
+func importErr(err error) error {
+	if errors.Is(err, vecdb.ErrInvalidRecord) {
+		return huma.Error400BadRequest(err.Error())
+	}
+
+	return ragErr(err)
+}
+
+// streamJsonl streams what export writes. Errors found once the body started
+// can't change the status anymore, so they are only logged.
+func streamJsonl(name string, export func(ctx context.Context, w io.Writer) (int, error)) *huma.StreamResponse {
+	return &huma.StreamResponse{
+		Body: func(hctx huma.Context) {
+			hctx.SetHeader("Content-Type", contentTypeJsonl)
+			hctx.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".jsonl"))
+
+			n, err := export(hctx.Context(), flushWriter{hctx.BodyWriter()})
+			if err != nil {
+				slog.Error("Export failed", "collection", name, "records", n, "err", err)
+			}
+		},
+	}
+}
+
+func (a *Service) ragExport(ctx context.Context, req *exportRequest) (*huma.StreamResponse, error) {
+	namespaces, err := a.rag.ListNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ns := range req.Ns {
+		if !slices.ContainsFunc(namespaces, func(n rag.Namespace) bool { return n.Name == ns }) {
+			return nil, ragErr(fmt.Errorf("%w: %s", rag.ErrNamespaceNotFound, ns))
+		}
+	}
+
+	return streamJsonl("rag", func(ctx context.Context, w io.Writer) (int, error) {
+		return a.rag.Export(ctx, w, req.Ns, req.Embeddings)
+	}), nil
+}
+
+func (a *Service) ragImport(ctx context.Context, req *importRequest) (*importResponse, error) {
+	n, err := a.rag.Import(ctx, req.body)
+	if err != nil {
+		return nil, importErr(err)
+	}
+
+	ret := &importResponse{}
+	ret.Body.Imported = n
+
+	return ret, nil
+}
+
+func (a *Service) cacheExport(ctx context.Context, req *exportRequest) (*huma.StreamResponse, error) {
+	return streamJsonl("cache", func(ctx context.Context, w io.Writer) (int, error) {
+		return a.cache.Export(ctx, w, req.Embeddings)
+	}), nil
+}
+
+func (a *Service) cacheImport(ctx context.Context, req *importRequest) (*importResponse, error) {
+	n, err := a.cache.Import(ctx, req.body)
+	if err != nil {
+		return nil, importErr(err)
+	}
+
+	ret := &importResponse{}
+	ret.Body.Imported = n
+
+	return ret, nil
+}
+
+func (a *Service) setupApiExport(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagOpExportGet",
+		Method:      "GET",
+		Path:        "/api/v1/rag/op/export",
+		Description: "Exports rag facts as JSONL, every namespace unless ns is given",
+		Security:    scopes(apikey.ScopeRagWrite),
+	}, a.ragExport)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagOpImportPost",
+		Method:      "POST",
+		Path:        "/api/v1/rag/op/import",
+		Description: "Imports rag facts from a JSONL export, creating missing namespaces",
+		Security:    scopes(apikey.ScopeRagWrite),
+		RequestBody: jsonlBody,
+	}, a.ragImport)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1CacheOpExportGet",
+		Method:      "GET",
+		Path:        "/api/v1/cache/op/export",
+		Description: "Exports cache entries as JSONL",
+		Security:    scopes(apikey.ScopeCacheAdmin),
+	}, a.cacheExport)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1CacheOpImportPost",
+		Method:      "POST",
+		Path:        "/api/v1/cache/op/import",
+		Description: "Imports cache entries from a JSONL export",
+		Security:    scopes(apikey.ScopeCacheAdmin),
+		RequestBody: jsonlBody,
+	}, a.cacheImport)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// checkTimeout bounds each dependency check, so a hung dependency can't hang
+// the probes.
+const checkTimeout = 3 * time.Second
+
+// Check is a dependency probed for readiness. Optional ones are reported but
+// don't make the service unready.
+type Check struct {
+	Name     string
+	Optional bool
+	Probe    func(ctx context.Context) error
+}
+
+// WithCheck adds a dependency to the readiness checks.
+func WithCheck(c Check) Option {
+	return func(service *Service) {
+		service.checks = append(service.checks, c)
+	}
+}
+
+type checkResult struct {
+	Status    string  `json:"status" enum:"ok,fail"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// runChecks probes every dependency at once. It tells whether the required
+// ones are all ok.
+func (a *Service) runChecks(ctx context.Context) (map[string]checkResult, bool) {
+	ret := make(map[string]checkResult, len(a.checks))
+	ready := true
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, c := range a.checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.Probe(ctx)
+
+			res := checkResult{
+				Status:    "ok",
+				Optional:  c.Optional,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			ret[c.Name] = res
+			ready = ready && (err == nil || c.Optional)
+		}()
+	}
+
+	wg.Wait()
+
+	return ret, ready
+}
+
+type healthRequest struct{}
+
+type healthResponse struct {
+	Body struct {
+		Status string `json:"status"`
+	}
+}
+
+func (a *Service) healthz(_ context.Context, _ *healthRequest) (*healthResponse, error) {
+	ret := &healthResponse{}
+	ret.Body.Status = "ok"
+
+	return ret, nil
+}
+
+type readyRequest struct{}
+
+type readyResponse struct {
+	Status int
+	Body   struct {
+		Status string                 `json:"status" enum:"ready,unready"`
+		Checks map[string]checkResult `json:"checks"`
+	}
+}
+
+// readyz reports the checks without their errors, which may tell hosts and
+// addresses to anyone: /api/v1/status has them.
+func (a *Service) readyz(ctx context.Context, _ *readyRequest) (*readyResponse, error) {
+	checks, ready := a.runChecks(ctx)
+
+	ret := &readyResponse{Status: http.StatusOK}
+	ret.Body.Status = "ready"
+	ret.Body.Checks = checks
+
+	if !ready {
+		ret.Status = http.StatusServiceUnavailable
+		ret.Body.Status = "unready"
+	}
+
+	for name, res := range checks {
+		if res.Error != "" {
+			slog.Warn("Readiness check failed", "check", name, "optional", res.Optional, "err", res.Error)
+
+			res.Error = ""
+			checks[name] = res
+		}
+	}
+
+	return ret, nil
+}
+
+func (a *Service) setupApiHealth(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "healthzGet",
+		Method:      "GET",
+		Path:        "/healthz",
+		Description: "Liveness: the process is up and serving",
+		Security:    scopes(),
+	}, a.healthz)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "readyzGet",
+		Method:      "GET",
+		Path:        "/readyz",
+		Description: "Readiness: checks the llm, the vector db, the tool db and the otel collector, 503 when a required one fails",
+		Security:    scopes(),
+	}, a.readyz)
+}
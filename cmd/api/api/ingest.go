@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/ingest"
+)
+
+type ingestAddRequest struct {
+	Body ingest.Document
+}
+
+type ingestAddResponse struct {
+	Body ingest.Ingested
+}
+
+func (a *Service) ingestAdd(ctx context.Context, req *ingestAddRequest) (*ingestAddResponse, error) {
+	ret, err := a.ingest.Ingest(ctx, req.Body)
+	if errors.Is(err, ingest.ErrEmptyDocument) {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	if err != nil {
+		return nil, ragErr(err)
+	}
+
+	return &ingestAddResponse{Body: ret}, nil
+}
+
+type ingestDelRequest struct {
+	Id string `path:"id"`
+	Ns string `json:"ns" query:"ns"`
+}
+
+type ingestDelResponse struct{}
+
+func (a *Service) ingestDel(ctx context.Context, req *ingestDelRequest) (*ingestDelResponse, error) {
+	if err := a.ingest.Delete(ctx, req.Ns, req.Id); err != nil {
+		return nil, ragErr(err)
+	}
+
+	return &ingestDelResponse{}, nil
+}
+
+func (a *Service) setupApiIngest(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagDocumentPost",
+		Method:      "POST",
+		Path:        "/api/v1/rag/documents",
+		Description: "Splits a text, markdown or html document in chunks and adds them to rag, replacing previous chunks of the same document",
+		Security:    scopes(apikey.ScopeRagWrite),
+	}, a.ingestAdd)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagDocumentDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/rag/documents/{id}",
+		Description: "Dels every chunk of a document from rag",
+		Security:    scopes(apikey.ScopeRagWrite),
+	}, a.ingestDel)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+)
+
+var errAuthDisabled = errors.New("api key auth is disabled")
+
+func keyErr(err error) error {
+	switch {
+	case errors.Is(err, apikey.ErrNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, apikey.ErrExists):
+		return huma.Error409Conflict(err.Error())
+	case errors.Is(err, apikey.ErrInvalid), errors.Is(err, apikey.ErrInvalidScope):
+		return huma.Error400BadRequest(err.Error())
+	case errors.Is(err, errAuthDisabled):
+		return huma.Error503ServiceUnavailable(err.Error())
+	}
+
+	return err
+}
+
+func (a *Service) keys() (*apikey.Service, error) {
+	if a.apikey == nil {
+		return nil, keyErr(errAuthDisabled)
+	}
+
+	return a.apikey, nil
+}
+
+type keyListRequest struct{}
+
+type keyListResponse struct {
+	Body []apikey.Key
+}
+
+func (a *Service) keyList(ctx context.Context, _ *keyListRequest) (*keyListResponse, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := keys.List(ctx)
+	if err != nil {
+		return nil, keyErr(err)
+	}
+
+	return &keyListResponse{Body: ret}, nil
+}
+
+// keySecretResponse carries the secret of a key, shown only once.
+type keySecretResponse struct {
+	Body struct {
+		Key    apikey.Key `json:"key"`
+		Secret string     `json:"secret" doc:"Sent as Authorization: Bearer <secret>, it can't be retrieved again"`
+	}
+}
+
+func newKeySecretResponse(key apikey.Key, secret string) *keySecretResponse {
+	ret := &keySecretResponse{}
+	ret.Body.Key = key
+	ret.Body.Secret = secret
+
+	return ret
+}
+
+type keyAddRequest struct {
+	Body struct {
+		Name   string   `json:"name" minLength:"1" doc:"Also the key name in the tool policies"`
+		Scopes []string `json:"scopes" minItems:"1" enum:"query,rag:write,cache:admin,admin"`
+		Ttl    string   `json:"ttl,omitempty" doc:"Lifetime as a Go duration, ex 720h - never expires when empty"`
+	}
+}
+
+func (a *Service) keyAdd(ctx context.Context, req *keyAddRequest) (*keySecretResponse, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var ttl time.Duration
+
+	if req.Body.Ttl != "" {
+		ttl, err = time.ParseDuration(req.Body.Ttl)
+		if err != nil || ttl <= 0 {
+			return nil, huma.Error400BadRequest("ttl must be a positive duration, ex 720h")
+		}
+	}
+
+	key, secret, err := keys.Create(ctx, req.Body.Name, req.Body.Scopes, ttl)
+	if err != nil {
+		return nil, keyErr(err)
+	}
+
+	return newKeySecretResponse(key, secret), nil
+}
+
+type keyRotateRequest struct {
+	Id string `path:"id"`
+}
+
+func (a *Service) keyRotate(ctx context.Context, req *keyRotateRequest) (*keySecretResponse, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	key, secret, err := keys.Rotate(ctx, req.Id)
+	if err != nil {
+		return nil, keyErr(err)
+	}
+
+	return newKeySecretResponse(key, secret), nil
+}
+
+type keyDelRequest struct {
+	Id string `path:"id"`
+}
+
+type keyDelResponse struct{}
+
+func (a *Service) keyDel(ctx context.Context, req *keyDelRequest) (*keyDelResponse, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = keys.Revoke(ctx, req.Id); err != nil {
+		return nil, keyErr(err)
+	}
+
+	return &keyDelResponse{}, nil
+}
+
+func (a *Service) setupApiKeys(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KeyListGet",
+		Method:      "GET",
+		Path:        "/api/v1/keys",
+		Description: "Lists the api keys, revoked ones included",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.keyList)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KeyPost",
+		Method:      "POST",
+		Path:        "/api/v1/keys",
+		Description: "Creates an api key, returning its secret",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.keyAdd)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KeyOpRotatePost",
+		Method:      "POST",
+		Path:        "/api/v1/keys/{id}/op/rotate",
+		Description: "Replaces the secret of an api key, the old one stops working at once",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.keyRotate)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KeyDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/keys/{id}",
+		Description: "Revokes an api key",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.keyDel)
+}
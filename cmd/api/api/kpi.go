@@ -0,0 +1,293 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/tool"
+)
+
+const maxImportBytes = 256 * 1024 * 1024
+
+func kpiErr(err error) error {
+	switch {
+	case errors.Is(err, tool.ErrKpiNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, tool.ErrKpiInvalid):
+		return huma.Error400BadRequest(err.Error())
+	case errors.Is(err, tool.ErrNoDb):
+		return huma.Error503ServiceUnavailable(err.Error())
+	}
+
+	return err
+}
+
+// kpiRange is the period of the point operations, every point when empty.
+type kpiRange struct {
+	Kpi string    `path:"kpi"`
+	Ini time.Time `query:"ini" doc:"Start of the period, RFC3339"`
+	End time.Time `query:"end" doc:"End of the period, RFC3339"`
+}
+
+func (r kpiRange) bounds() (time.Time, time.Time) {
+	end := r.End
+	if end.IsZero() {
+		end = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+
+	return r.Ini, end
+}
+
+type kpiListRequest struct{}
+
+type kpiListResponse struct {
+	Body []tool.Kpi
+}
+
+func (a *Service) kpiList(ctx context.Context, _ *kpiListRequest) (*kpiListResponse, error) {
+	ret, err := a.tool.Kpis(ctx)
+	if err != nil {
+		return nil, kpiErr(err)
+	}
+
+	return &kpiListResponse{Body: ret}, nil
+}
+
+type kpiSaveRequest struct {
+	Kpi  string `path:"kpi"`
+	Body struct {
+		DisplayName string `json:"display_name,omitempty"`
+		Unit        string `json:"unit,omitempty"`
+		Description string `json:"description,omitempty" doc:"What the KPI measures, read by the llm to pick it"`
+	}
+}
+
+type kpiSaveResponse struct{}
+
+func (a *Service) kpiSave(ctx context.Context, req *kpiSaveRequest) (*kpiSaveResponse, error) {
+	err := a.tool.SaveKpi(ctx, tool.Kpi{
+		Kpi:         req.Kpi,
+		DisplayName: req.Body.DisplayName,
+		Unit:        req.Body.Unit,
+		Description: req.Body.Description,
+	})
+
+	return &kpiSaveResponse{}, kpiErr(err)
+}
+
+type kpiDelRequest struct {
+	Kpi string `path:"kpi"`
+}
+
+type kpiDelResponse struct{}
+
+func (a *Service) kpiDel(ctx context.Context, req *kpiDelRequest) (*kpiDelResponse, error) {
+	return &kpiDelResponse{}, kpiErr(a.tool.DeleteKpi(ctx, req.Kpi))
+}
+
+type kpiSeriesRequest struct {
+	kpiRange
+}
+
+type kpiSeriesResponse struct {
+	Body []tool.Point
+}
+
+func (a *Service) kpiSeries(ctx context.Context, req *kpiSeriesRequest) (*kpiSeriesResponse, error) {
+	ini, end := req.bounds()
+
+	ret, err := a.tool.Series(ctx, req.Kpi, ini, end)
+	if err != nil {
+		return nil, kpiErr(err)
+	}
+
+	return &kpiSeriesResponse{Body: ret}, nil
+}
+
+type kpiPointsUpsertRequest struct {
+	Kpi  string `path:"kpi"`
+	Body []struct {
+		Dt    time.Time `json:"dt"`
+		Value float64   `json:"value"`
+	}
+}
+
+type kpiPointsResponse struct {
+	Body struct {
+		Points int64 `json:"points"`
+	}
+}
+
+func (a *Service) kpiPointsUpsert(ctx context.Context, req *kpiPointsUpsertRequest) (*kpiPointsResponse, error) {
+	points := make([]tool.Point, 0, len(req.Body))
+	for _, p := range req.Body {
+		points = append(points, tool.Point{Kpi: req.Kpi, Dt: p.Dt, Value: p.Value})
+	}
+
+	if err := a.tool.UpsertPoints(ctx, points); err != nil {
+		return nil, kpiErr(err)
+	}
+
+	ret := &kpiPointsResponse{}
+	ret.Body.Points = int64(len(points))
+
+	return ret, nil
+}
+
+type kpiPointsDelRequest struct {
+	kpiRange
+}
+
+func (a *Service) kpiPointsDel(ctx context.Context, req *kpiPointsDelRequest) (*kpiPointsResponse, error) {
+	ini, end := req.bounds()
+
+	n, err := a.tool.DeleteRange(ctx, req.Kpi, ini, end)
+	if err != nil {
+		return nil, kpiErr(err)
+	}
+
+	ret := &kpiPointsResponse{}
+	ret.Body.Points = n
+
+	return ret, nil
+}
+
+type kpiImportRequest struct {
+	ContentType string `header:"Content-Type"`
+	RawBody     []byte `contentType:"text/csv"`
+}
+
+// parseKpiCsv reads kpi,dt,value rows. The header row is optional.
+func parseKpiCsv(r io.Reader) ([]tool.Point, error) {
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = 3
+	rd.TrimLeadingSpace = true
+
+	var ret []tool.Point
+
+	for line := 1; ; line++ {
+		rec, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && strings.EqualFold(rec[0], "kpi") {
+			continue
+		}
+
+		dt, err := time.Parse(time.RFC3339, rec[1])
+		if err != nil {
+			if dt, err = time.Parse(time.DateOnly, rec[1]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid dt: %s", line, rec[1])
+			}
+		}
+
+		val, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value: %s", line, rec[2])
+		}
+
+		ret = append(ret, tool.Point{Kpi: rec[0], Dt: dt, Value: val})
+	}
+}
+
+func (a *Service) kpiImport(ctx context.Context, req *kpiImportRequest) (*kpiPointsResponse, error) {
+	var (
+		points []tool.Point
+		err    error
+	)
+
+	switch {
+	case strings.Contains(req.ContentType, "json"):
+		err = json.Unmarshal(req.RawBody, &points)
+	default:
+		points, err = parseKpiCsv(bytes.NewReader(req.RawBody))
+	}
+
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	if err = a.tool.UpsertPoints(ctx, points); err != nil {
+		return nil, kpiErr(err)
+	}
+
+	ret := &kpiPointsResponse{}
+	ret.Body.Points = int64(len(points))
+
+	return ret, nil
+}
+
+func (a *Service) setupApiKpi(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiGet",
+		Method:      "GET",
+		Path:        "/api/v1/kpis",
+		Description: "Lists kpis with their catalog entries",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.kpiList)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiPut",
+		Method:      "PUT",
+		Path:        "/api/v1/kpis/{kpi}",
+		Description: "Creates or replaces the catalog entry of a kpi",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.kpiSave)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/kpis/{kpi}",
+		Description: "Drops a kpi, its catalog entry and all its values",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.kpiDel)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiPointsGet",
+		Method:      "GET",
+		Path:        "/api/v1/kpis/{kpi}/points",
+		Description: "Queries the values of a kpi within a period",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.kpiSeries)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiPointsPost",
+		Method:      "POST",
+		Path:        "/api/v1/kpis/{kpi}/points",
+		Description: "Adds values to a kpi, replacing the ones of the same dates",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.kpiPointsUpsert)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1KpiPointsDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/kpis/{kpi}/points",
+		Description: "Deletes the values of a kpi within a period",
+		Security:    scopes(apikey.ScopeAdmin),
+	}, a.kpiPointsDel)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID:  "apiV1KpiOpImportPost",
+		Method:       "POST",
+		Path:         "/api/v1/kpis/op/import",
+		Description:  "Imports kpi values from csv (kpi,dt,value) or a json array of points",
+		Security:     scopes(apikey.ScopeAdmin),
+		MaxBodyBytes: maxImportBytes,
+	}, a.kpiImport)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/limit"
+)
+
+// metaGenerates marks the operations that run a generation, which go through
+// the rate limit and the generation queue.
+const metaGenerates = "generates"
+
+func generates() map[string]any {
+	return map[string]any{metaGenerates: true}
+}
+
+// WithLimits rate limits clients and bounds concurrent generations. Without
+// it generations are unbounded.
+func WithLimits(l *limit.Service) Option {
+	return func(service *Service) {
+		service.limit = l
+	}
+}
+
+// client names who a request is from for the rate limit: the id of its api
+// key or, with auth disabled, its address.
+func client(hctx huma.Context) string {
+	if key, ok := apikey.KeyFrom(hctx.Context()); ok {
+		return "key:" + key.ID
+	}
+
+	host, _, err := net.SplitHostPort(hctx.RemoteAddr())
+	if err != nil {
+		host = hctx.RemoteAddr()
+	}
+
+	return "ip:" + host
+}
+
+// middlewareLimit holds a generation slot for the whole request, streamed
+// responses included. It goes after auth, to limit by api key.
+func (a *Service) middlewareLimit(humaApi huma.API) func(huma.Context, func(huma.Context)) {
+	return func(hctx huma.Context, next func(huma.Context)) {
+		if a.limit == nil || hctx.Operation().Metadata[metaGenerates] != true {
+			next(hctx)
+			return
+		}
+
+		release, err := a.limit.Acquire(hctx.Context(), client(hctx))
+
+		var rejected *limit.RejectedError
+
+		switch {
+		case errors.As(err, &rejected):
+			trace.SpanFromContext(hctx.Context()).SetAttributes(attribute.String("rejected", rejected.Err.Error()))
+
+			hctx.SetHeader("Retry-After", strconv.Itoa(int(math.Ceil(rejected.RetryAfter.Seconds()))))
+			huma.WriteErr(humaApi, hctx, http.StatusTooManyRequests, rejected.Error()) //nolint:errcheck
+
+			return
+		case err != nil:
+			// the client went away while queued
+			return
+		}
+
+		defer release()
+
+		next(hctx)
+	}
+}
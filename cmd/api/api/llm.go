@@ -6,15 +6,29 @@ import (
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/sse"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/llm"
 )
 
 type llmQueryRequest struct {
 	Body struct {
-		Query    string `json:"query,omitempty"`
-		Details  bool   `json:"details,omitempty"`
-		UseCache bool   `json:"use_cache,omitempty"`
+		Query      string   `json:"query,omitempty"`
+		Details    bool     `json:"details,omitempty"`
+		UseCache   bool     `json:"use_cache,omitempty"`
+		Namespaces []string `json:"namespaces,omitempty"`
+	}
+}
+
+func (r *llmQueryRequest) llmRequest() llm.Request {
+	return llm.Request{
+		Query:      r.Body.Query,
+		UseCache:   r.Body.UseCache,
+		Namespaces: r.Body.Namespaces,
 	}
 }
+
 type llmQueryResponse struct {
 	Body any
 }
@@ -26,9 +40,9 @@ func (a *Service) llmQuery(ctx context.Context, req *llmQueryRequest) (*llmQuery
 		a.metricResponseTime.Add(ctx, dur.Seconds())
 	}()
 
-	ret, err := a.llm.Query(ctx, req.Body.Query, req.Body.UseCache)
+	ret, err := a.llm.Query(ctx, req.llmRequest())
 	if err != nil {
-		return nil, err
+		return nil, ragErr(err)
 	}
 
 	if req.Body.Details {
@@ -38,11 +52,58 @@ func (a *Service) llmQuery(ctx context.Context, req *llmQueryRequest) (*llmQuery
 	return &llmQueryResponse{Body: ret.Response}, nil
 }
 
+type (
+	llmStreamToken struct {
+		Content string `json:"content"`
+	}
+	llmStreamResult struct {
+		Response llm.Response `json:"response"`
+		Tokens   llm.Tokens   `json:"tokens"`
+	}
+	llmStreamError struct {
+		Message string `json:"message"`
+	}
+)
+
+func (a *Service) llmQueryStream(ctx context.Context, req *llmQueryRequest, send sse.Sender) {
+	start := time.Now()
+	defer func() {
+		dur := time.Since(start)
+		a.metricResponseTime.Add(ctx, dur.Seconds())
+	}()
+
+	ret, tokens, err := a.llm.QueryStream(ctx, req.llmRequest(), llm.ResponseText(func(text string) error {
+		return send.Data(llmStreamToken{Content: text})
+	}))
+	if err != nil {
+		send.Data(llmStreamError{Message: err.Error()}) //nolint:errcheck
+
+		return
+	}
+
+	send.Data(llmStreamResult{Response: ret, Tokens: tokens}) //nolint:errcheck
+}
+
 func (a *Service) setupApiLlm(humaApi huma.API) {
 	huma.Register(humaApi, huma.Operation{
 		OperationID: "apiV1LlmQueryPost",
 		Method:      "POST",
 		Path:        "/api/v1/llm",
 		Description: "retrieves general status of this service",
+		Security:    scopes(apikey.ScopeQuery),
+		Metadata:    generates(),
 	}, a.llmQuery)
+
+	sse.Register(humaApi, huma.Operation{
+		OperationID: "apiV1LlmStreamPost",
+		Method:      "POST",
+		Path:        "/api/v1/llm/stream",
+		Description: "Queries the llm relaying the partial answer text as server sent events",
+		Security:    scopes(apikey.ScopeQuery),
+		Metadata:    generates(),
+	}, map[string]any{
+		"token":  llmStreamToken{},
+		"result": llmStreamResult{},
+		"error":  llmStreamError{},
+	}, a.llmQueryStream)
 }
@@ -0,0 +1,450 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/llm"
+)
+
+// The OpenAI compatible endpoints let clients written for the OpenAI api use
+// this one. The model asked for is ignored, answers always come from the
+// llm.Service pipeline and embeddings from the configured embedding model.
+
+const openaiOwner = "gophercon-2025"
+
+type openaiMessage struct {
+	Role    string `json:"role" enum:"system,user,assistant,tool,developer"`
+	Content any    `json:"content,omitempty" doc:"Text, or an array of content parts of which only the text ones are read"`
+}
+
+// text returns the text of the message, joining text parts.
+func (m openaiMessage) text() string {
+	switch content := m.Content.(type) {
+	case string:
+		return content
+	case []any:
+		parts := make([]string, 0, len(content))
+
+		for _, part := range content {
+			if p, ok := part.(map[string]any); ok && p["type"] == "text" {
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+
+		return strings.Join(parts, "\n")
+	}
+
+	return ""
+}
+
+type openaiChatRequest struct {
+	Body struct {
+		_             struct{}        `json:"-" additionalProperties:"true"`
+		Model         string          `json:"model,omitempty"`
+		Messages      []openaiMessage `json:"messages" minItems:"1"`
+		Stream        bool            `json:"stream,omitempty"`
+		StreamOptions *struct {
+			IncludeUsage bool `json:"include_usage,omitempty"`
+		} `json:"stream_options,omitempty"`
+		Namespaces []string `json:"namespaces,omitempty" doc:"Not in the OpenAI api: rag namespaces searched for context"`
+	}
+}
+
+// llmRequest turns the messages into a query, the last user message, and the
+// history before it. System messages are dropped, the pipeline has a system
+// prompt of its own. Single questions use the cache.
+func (r *openaiChatRequest) llmRequest() (llm.Request, error) {
+	msgs := r.Body.Messages
+
+	last := len(msgs) - 1
+	if last < 0 || msgs[last].Role != conversation.RoleUser {
+		return llm.Request{}, errors.New("the last message must be a user message")
+	}
+
+	ret := llm.Request{
+		Query:      msgs[last].text(),
+		Namespaces: r.Body.Namespaces,
+	}
+
+	if ret.Query == "" {
+		return llm.Request{}, errors.New("the last message has no text")
+	}
+
+	for _, msg := range msgs[:last] {
+		if msg.Role != conversation.RoleUser && msg.Role != conversation.RoleAssistant {
+			continue
+		}
+
+		ret.History = append(ret.History, conversation.Message{Role: msg.Role, Content: msg.text()})
+	}
+
+	ret.UseCache = len(ret.History) == 0
+
+	return ret, nil
+}
+
+type openaiUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newOpenaiUsage(tokens llm.Tokens) *openaiUsage {
+	return &openaiUsage{PromptTokens: tokens.In, CompletionTokens: tokens.Out, TotalTokens: tokens.In + tokens.Out}
+}
+
+// openaiDelta is the part of the message a streamed chunk adds.
+type openaiDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openaiChoice struct {
+	Index        int            `json:"index"`
+	Message      *openaiMessage `json:"message,omitempty"`
+	Delta        *openaiDelta   `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type openaiCompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openaiChoice `json:"choices"`
+	Usage   *openaiUsage   `json:"usage,omitempty"`
+}
+
+type openaiError struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Code    *string `json:"code"`
+	} `json:"error"`
+}
+
+// openaiStatusError is an error answered in the OpenAI shape, as its clients
+// don't read problem+json.
+type openaiStatusError struct {
+	status int
+	body   openaiError
+}
+
+func (e *openaiStatusError) Error() string { return e.body.Error.Message }
+
+func (e *openaiStatusError) GetStatus() int { return e.status }
+
+func (e *openaiStatusError) MarshalJSON() ([]byte, error) { return json.Marshal(e.body) }
+
+// openaiErrorTypes are the error types of the OpenAI api by status, others
+// are server errors.
+var openaiErrorTypes = map[int]string{
+	http.StatusBadRequest:          "invalid_request_error",
+	http.StatusUnprocessableEntity: "invalid_request_error",
+	http.StatusUnauthorized:        "authentication_error",
+	http.StatusForbidden:           "permission_error",
+	http.StatusNotFound:            "not_found_error",
+	http.StatusTooManyRequests:     "rate_limit_error",
+}
+
+// openaiErr converts err to the OpenAI shape, keeping the status of huma
+// errors.
+func openaiErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	ret := &openaiStatusError{status: http.StatusInternalServerError}
+
+	var se huma.StatusError
+	if errors.As(err, &se) {
+		ret.status = se.GetStatus()
+	}
+
+	ret.body.Error.Message = err.Error()
+	ret.body.Error.Type = openaiErrorTypes[ret.status]
+
+	if ret.body.Error.Type == "" {
+		ret.body.Error.Type = "server_error"
+	}
+
+	return ret
+}
+
+var finishStop = "stop"
+
+func (a *Service) newCompletion(object string) openaiCompletion {
+	return openaiCompletion{
+		ID:      "chatcmpl-" + uuid.NewString(),
+		Object:  object,
+		Created: time.Now().Unix(),
+		Model:   a.model,
+	}
+}
+
+// openaiChat answers either with a single completion or, when streaming, with
+// server sent events in the OpenAI format: unnamed events, a delta per chunk
+// and a final [DONE], which the huma sse package can't write.
+func (a *Service) openaiChat(ctx context.Context, req *openaiChatRequest) (*huma.StreamResponse, error) {
+	llmReq, err := req.llmRequest()
+	if err != nil {
+		return nil, openaiErr(huma.Error400BadRequest(err.Error()))
+	}
+
+	if req.Body.Stream {
+		includeUsage := req.Body.StreamOptions != nil && req.Body.StreamOptions.IncludeUsage
+
+		return &huma.StreamResponse{Body: func(hctx huma.Context) {
+			a.openaiChatStream(ctx, hctx, llmReq, includeUsage)
+		}}, nil
+	}
+
+	ret, tokens, err := a.llm.QueryStream(ctx, llmReq, nil)
+	if err != nil {
+		return nil, openaiErr(ragErr(err))
+	}
+
+	completion := a.newCompletion("chat.completion")
+	completion.Choices = []openaiChoice{{
+		Message:      &openaiMessage{Role: conversation.RoleAssistant, Content: ret.Response},
+		FinishReason: &finishStop,
+	}}
+	completion.Usage = newOpenaiUsage(tokens)
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		hctx.SetHeader("Content-Type", "application/json")
+		json.NewEncoder(hctx.BodyWriter()).Encode(completion) //nolint:errcheck
+	}}, nil
+}
+
+func (a *Service) openaiChatStream(ctx context.Context, hctx huma.Context, req llm.Request, includeUsage bool) {
+	hctx.SetHeader("Content-Type", "text/event-stream")
+	hctx.SetHeader("Cache-Control", "no-cache")
+
+	w := hctx.BodyWriter()
+
+	send := func(v any) error {
+		if err := writeEvent(w, v); err != nil {
+			return err
+		}
+
+		return flush(w)
+	}
+
+	chunk := a.newCompletion("chat.completion.chunk")
+
+	delta := func(msg openaiDelta, finish *string) openaiCompletion {
+		ret := chunk
+		ret.Choices = []openaiChoice{{Delta: &msg, FinishReason: finish}}
+
+		return ret
+	}
+
+	if err := send(delta(openaiDelta{Role: conversation.RoleAssistant}, nil)); err != nil {
+		return
+	}
+
+	_, tokens, err := a.llm.QueryStream(ctx, req, llm.ResponseText(func(text string) error {
+		return send(delta(openaiDelta{Content: text}, nil))
+	}))
+	if err != nil {
+		send(openaiErr(ragErr(err))) //nolint:errcheck
+
+		return
+	}
+
+	if err = send(delta(openaiDelta{}, &finishStop)); err != nil {
+		return
+	}
+
+	if includeUsage {
+		usage := chunk
+		usage.Choices = []openaiChoice{}
+		usage.Usage = newOpenaiUsage(tokens)
+
+		if err = send(usage); err != nil {
+			return
+		}
+	}
+
+	io.WriteString(w, "data: [DONE]\n\n") //nolint:errcheck
+	flush(w)                              //nolint:errcheck
+}
+
+// flush sends what was written so far, through whatever wraps the writer.
+func flush(w io.Writer) error {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		return http.NewResponseController(rw).Flush()
+	}
+
+	return nil
+}
+
+func writeEvent(w io.Writer, v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "data: %s\n\n", bs)
+
+	return err
+}
+
+type openaiEmbeddingsRequest struct {
+	Body struct {
+		_              struct{} `json:"-" additionalProperties:"true"`
+		Model          string   `json:"model,omitempty"`
+		Input          any      `json:"input" doc:"Text or array of texts to embed"`
+		EncodingFormat string   `json:"encoding_format,omitempty" enum:"float"`
+	}
+}
+
+func (r *openaiEmbeddingsRequest) inputs() ([]string, error) {
+	switch input := r.Body.Input.(type) {
+	case string:
+		return []string{input}, nil
+	case []any:
+		ret := make([]string, 0, len(input))
+
+		for _, in := range input {
+			text, ok := in.(string)
+			if !ok {
+				return nil, errors.New("input must be a string or an array of strings, token arrays are not supported")
+			}
+
+			ret = append(ret, text)
+		}
+
+		if len(ret) == 0 {
+			return nil, errors.New("input is empty")
+		}
+
+		return ret, nil
+	}
+
+	return nil, errors.New("input must be a string or an array of strings")
+}
+
+type openaiEmbedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type openaiEmbeddingsResponse struct {
+	Body struct {
+		Object string            `json:"object"`
+		Data   []openaiEmbedding `json:"data"`
+		Model  string            `json:"model"`
+		Usage  struct {
+			PromptTokens int `json:"prompt_tokens"`
+			TotalTokens  int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+}
+
+func (a *Service) openaiEmbeddings(ctx context.Context, req *openaiEmbeddingsRequest) (*openaiEmbeddingsResponse, error) {
+	inputs, err := req.inputs()
+	if err != nil {
+		return nil, openaiErr(huma.Error400BadRequest(err.Error()))
+	}
+
+	vecs, err := a.provider.Embed(ctx, a.embModel, inputs)
+	if err != nil {
+		return nil, openaiErr(err)
+	}
+
+	ret := &openaiEmbeddingsResponse{}
+	ret.Body.Object = "list"
+	ret.Body.Model = a.embModel
+
+	for i, vec := range vecs {
+		ret.Body.Data = append(ret.Body.Data, openaiEmbedding{Object: "embedding", Index: i, Embedding: vec})
+	}
+
+	if a.tokenizer != nil {
+		for _, in := range inputs {
+			n, err := a.tokenizer.Count(in)
+			if err != nil {
+				return nil, openaiErr(err)
+			}
+
+			ret.Body.Usage.PromptTokens += n
+		}
+	}
+
+	ret.Body.Usage.TotalTokens = ret.Body.Usage.PromptTokens
+
+	return ret, nil
+}
+
+type openaiModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type openaiModelsRequest struct{}
+
+type openaiModelsResponse struct {
+	Body struct {
+		Object string        `json:"object"`
+		Data   []openaiModel `json:"data"`
+	}
+}
+
+func (a *Service) openaiModels(_ context.Context, _ *openaiModelsRequest) (*openaiModelsResponse, error) {
+	ret := &openaiModelsResponse{}
+	ret.Body.Object = "list"
+
+	for _, model := range []string{a.model, a.embModel} {
+		if model != "" {
+			ret.Body.Data = append(ret.Body.Data, openaiModel{ID: model, Object: "model", OwnedBy: openaiOwner})
+		}
+	}
+
+	return ret, nil
+}
+
+func (a *Service) setupApiOpenai(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "v1ChatCompletionsPost",
+		Method:      "POST",
+		Path:        "/v1/chat/completions",
+		Description: "OpenAI compatible chat completions, answered through the rag, tools and cache pipeline. Streams chat.completion.chunk events when stream is set",
+		Security:    scopes(apikey.ScopeQuery),
+		Metadata:    generates(),
+	}, a.openaiChat)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "v1EmbeddingsPost",
+		Method:      "POST",
+		Path:        "/v1/embeddings",
+		Description: "OpenAI compatible embeddings, computed by the configured embedding model",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.openaiEmbeddings)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "v1ModelsGet",
+		Method:      "GET",
+		Path:        "/v1/models",
+		Description: "OpenAI compatible list of the models served",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.openaiModels)
+}
@@ -2,62 +2,130 @@ package api
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/philippgille/chromem-go"
-)
 
-type (
-	ragClearRequest  struct{}
-	ragClearResponse struct{}
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/rag"
 )
 
+func ragErr(err error) error {
+	switch {
+	case errors.Is(err, rag.ErrNamespaceNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, rag.ErrNamespaceExists):
+		return huma.Error409Conflict(err.Error())
+	case errors.Is(err, rag.ErrNamespaceInvalid):
+		return huma.Error400BadRequest(err.Error())
+	}
+
+	return err
+}
+
+type ragClearRequest struct {
+	Ns string `json:"ns" query:"ns"`
+}
+type ragClearResponse struct{}
+
 func (a *Service) ragClear(ctx context.Context, req *ragClearRequest) (*ragClearResponse, error) {
-	err := a.rag.Clear(ctx)
+	err := a.rag.Clear(ctx, req.Ns)
 
-	return &ragClearResponse{}, err
+	return &ragClearResponse{}, ragErr(err)
 }
 
 type ragAddRequest struct {
 	Body struct {
-		Fact string            `json:"fact,omitempty"`
-		Meta map[string]string `json:"meta,omitempty"`
+		Namespace string            `json:"namespace,omitempty"`
+		Fact      string            `json:"fact,omitempty"`
+		Meta      map[string]string `json:"meta,omitempty"`
 	}
 }
 type ragAddResponse struct{}
 
 func (a *Service) ragAdd(ctx context.Context, req *ragAddRequest) (*ragAddResponse, error) {
-	err := a.rag.Add(ctx, req.Body.Fact, req.Body.Meta)
+	err := a.rag.Add(ctx, req.Body.Namespace, req.Body.Fact, req.Body.Meta)
 
-	return &ragAddResponse{}, err
+	return &ragAddResponse{}, ragErr(err)
 }
 
 type ragQueryRequest struct {
-	Q string `json:"q" query:"q"`
-	E bool   `json:"e" query:"e"`
+	Q           string   `json:"q" query:"q"`
+	E           bool     `json:"e" query:"e"`
+	Ns          []string `json:"ns" query:"ns" doc:"Namespaces to search, the default one when empty"`
+	Where       []string `json:"where" query:"where" doc:"Metadata filters as key:value"`
+	Contains    string   `json:"contains" query:"contains" doc:"Only facts containing this text"`
+	NotContains string   `json:"not_contains" query:"not_contains" doc:"Only facts not containing this text"`
+	Scores      bool     `json:"scores" query:"scores" doc:"Returns the vector, lexical and fused scores of each fact"`
+}
+
+type ragQueryResult struct {
+	chromem.Result
+	Namespace string      `json:"namespace"`
+	Scores    *rag.Scores `json:"scores,omitempty"`
 }
 
 type ragQueryResponse struct {
-	Body []chromem.Result
+	Body []ragQueryResult
 }
 
 func (a *Service) ragQuery(ctx context.Context, req *ragQueryRequest) (*ragQueryResponse, error) {
-	docs, err := a.rag.Query(ctx, req.Q)
+	filter := rag.Filter{Namespaces: req.Ns}
+
+	for _, entry := range req.Where {
+		k, v, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, huma.Error400BadRequest("where entries must be key:value, got " + entry)
+		}
+
+		if filter.Where == nil {
+			filter.Where = map[string]string{}
+		}
+
+		filter.Where[k] = v
+	}
+
+	if req.Contains != "" || req.NotContains != "" {
+		filter.WhereDocument = map[string]string{}
+	}
+
+	if req.Contains != "" {
+		filter.WhereDocument["$contains"] = req.Contains
+	}
+
+	if req.NotContains != "" {
+		filter.WhereDocument["$not_contains"] = req.NotContains
+	}
+
+	scored, err := a.rag.QueryScored(ctx, req.Q, filter)
 	if err != nil {
-		return nil, err
+		return nil, ragErr(err)
 	}
 
-	if !req.E {
-		for i := range docs {
-			docs[i].Embedding = nil
+	docs := make([]ragQueryResult, 0, len(scored))
+
+	for _, sc := range scored {
+		doc := ragQueryResult{Result: sc.Result, Namespace: sc.Namespace}
+
+		if !req.E {
+			doc.Embedding = nil
+		}
+
+		if req.Scores {
+			doc.Scores = &sc.Scores
 		}
+
+		docs = append(docs, doc)
 	}
 
-	return &ragQueryResponse{Body: docs}, err
+	return &ragQueryResponse{Body: docs}, nil
 }
 
 type ragDelRequest struct {
 	Id string `path:"id"`
+	Ns string `json:"ns" query:"ns"`
 }
 
 type ragDelResponse struct {
@@ -65,20 +133,68 @@ type ragDelResponse struct {
 }
 
 func (a *Service) ragDel(ctx context.Context, req *ragDelRequest) (*ragDelResponse, error) {
-	err := a.rag.Del(ctx, req.Id)
+	err := a.rag.Del(ctx, req.Ns, req.Id)
 	if err != nil {
-		return nil, err
+		return nil, ragErr(err)
 	}
 
 	return &ragDelResponse{}, nil
 }
 
+type ragNamespaceListRequest struct{}
+
+type ragNamespaceListResponse struct {
+	Body []rag.Namespace
+}
+
+func (a *Service) ragNamespaceList(ctx context.Context, _ *ragNamespaceListRequest) (*ragNamespaceListResponse, error) {
+	ret, err := a.rag.ListNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ragNamespaceListResponse{Body: ret}, nil
+}
+
+type ragNamespaceAddRequest struct {
+	Body struct {
+		Name string `json:"name"`
+	}
+}
+
+type ragNamespaceAddResponse struct{}
+
+func (a *Service) ragNamespaceAdd(ctx context.Context, req *ragNamespaceAddRequest) (*ragNamespaceAddResponse, error) {
+	err := a.rag.CreateNamespace(ctx, req.Body.Name)
+	if err != nil {
+		return nil, ragErr(err)
+	}
+
+	return &ragNamespaceAddResponse{}, nil
+}
+
+type ragNamespaceDelRequest struct {
+	Name string `path:"name"`
+}
+
+type ragNamespaceDelResponse struct{}
+
+func (a *Service) ragNamespaceDel(ctx context.Context, req *ragNamespaceDelRequest) (*ragNamespaceDelResponse, error) {
+	err := a.rag.DropNamespace(ctx, req.Name)
+	if err != nil {
+		return nil, ragErr(err)
+	}
+
+	return &ragNamespaceDelResponse{}, nil
+}
+
 func (a *Service) setupApiRag(humaApi huma.API) {
 	huma.Register(humaApi, huma.Operation{
 		OperationID: "apiV1RagOpClearPost",
 		Method:      "POST",
 		Path:        "/api/v1/rag/op/clear",
 		Description: "Clears rag content",
+		Security:    scopes(apikey.ScopeRagWrite),
 	}, a.ragClear)
 
 	huma.Register(humaApi, huma.Operation{
@@ -86,6 +202,7 @@ func (a *Service) setupApiRag(humaApi huma.API) {
 		Method:      "GET",
 		Path:        "/api/v1/rag",
 		Description: "Queries rag",
+		Security:    scopes(apikey.ScopeQuery),
 	}, a.ragQuery)
 
 	huma.Register(humaApi, huma.Operation{
@@ -93,6 +210,7 @@ func (a *Service) setupApiRag(humaApi huma.API) {
 		Method:      "POST",
 		Path:        "/api/v1/rag",
 		Description: "Adds entry to rag",
+		Security:    scopes(apikey.ScopeRagWrite),
 	}, a.ragAdd)
 
 	huma.Register(humaApi, huma.Operation{
@@ -100,5 +218,30 @@ func (a *Service) setupApiRag(humaApi huma.API) {
 		Method:      "DELETE",
 		Path:        "/api/v1/rag/{id}",
 		Description: "Dels entry from rag",
+		Security:    scopes(apikey.ScopeRagWrite),
 	}, a.ragDel)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagNamespaceGet",
+		Method:      "GET",
+		Path:        "/api/v1/rag/namespaces",
+		Description: "Lists rag namespaces",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.ragNamespaceList)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagNamespacePost",
+		Method:      "POST",
+		Path:        "/api/v1/rag/namespaces",
+		Description: "Creates a rag namespace",
+		Security:    scopes(apikey.ScopeRagWrite),
+	}, a.ragNamespaceAdd)
+
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1RagNamespaceDelete",
+		Method:      "DELETE",
+		Path:        "/api/v1/rag/namespaces/{name}",
+		Description: "Drops a rag namespace and its facts",
+		Security:    scopes(apikey.ScopeRagWrite),
+	}, a.ragNamespaceDel)
 }
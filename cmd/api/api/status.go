@@ -2,39 +2,109 @@ package api
 
 import (
 	"context"
-	"os"
-	"os/user"
-	"slices"
+	"runtime"
+	"runtime/debug"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/rag"
 )
 
-type statusRequest struct {
-	Fname string `json:"fname"`
+// Version is the version of the api.
+const Version = "1.0.0"
+
+// WithConfig sets the configuration reported by the status route. It must
+// come redacted already.
+func WithConfig(config map[string]any) Option {
+	return func(service *Service) {
+		service.config = config
+	}
+}
+
+type statusBuild struct {
+	GoVersion   string `json:"go_version"`
+	Module      string `json:"module"`
+	Revision    string `json:"revision,omitempty"`
+	RevisionAt  string `json:"revision_at,omitempty"`
+	Modified    bool   `json:"modified,omitempty"`
+	Goroutines  int    `json:"goroutines"`
+	HeapAllocMb uint64 `json:"heap_alloc_mb"`
 }
+
+func buildInfo() statusBuild {
+	ret := statusBuild{GoVersion: runtime.Version(), Goroutines: runtime.NumGoroutine()}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	ret.HeapAllocMb = mem.HeapAlloc >> 20
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+
+	ret.Module = info.Main.Path
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			ret.Revision = setting.Value
+		case "vcs.time":
+			ret.RevisionAt = setting.Value
+		case "vcs.modified":
+			ret.Modified = setting.Value == "true"
+		}
+	}
+
+	return ret
+}
+
+type statusRequest struct{}
+
 type statusResponse struct {
-	Body map[string]any `json:"body"`
+	Body struct {
+		Version   string                 `json:"version"`
+		StartedAt time.Time              `json:"started_at"`
+		Build     statusBuild            `json:"build"`
+		Models    map[string]string      `json:"models"`
+		Rag       []rag.Namespace        `json:"rag"`
+		Cache     int                    `json:"cache" doc:"Cache entries, expired ones not swept yet included"`
+		Tools     int                    `json:"tools"`
+		Checks    map[string]checkResult `json:"checks"`
+		Config    map[string]any         `json:"config" doc:"Flags in effect, secrets redacted"`
+	}
 }
 
-func (a *Service) status(ctx context.Context, req *statusRequest) (*statusResponse, error) {
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, err
+func (a *Service) status(ctx context.Context, _ *statusRequest) (*statusResponse, error) {
+	ret := &statusResponse{}
+	ret.Body.Version = Version
+	ret.Body.StartedAt = a.startedAt
+	ret.Body.Build = buildInfo()
+	ret.Body.Models = map[string]string{"llm": a.model, "embedding": a.embModel}
+	ret.Body.Config = a.config
+	ret.Body.Checks, _ = a.runChecks(ctx)
+
+	if a.rag != nil {
+		namespaces, err := a.rag.ListNamespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Body.Rag = namespaces
 	}
 
-	usr, err := user.Current()
-	if err != nil {
-		return nil, err
+	if a.cache != nil {
+		ret.Body.Cache = a.cache.Count()
 	}
 
-	envData := os.Environ()
-	slices.Sort(envData)
+	if a.tool != nil {
+		ret.Body.Tools = len(a.tool.List())
+	}
 
-	return &statusResponse{Body: map[string]any{
-		"user": usr.Username,
-		"wd":   wd,
-		"env":  envData,
-	}}, nil
+	return ret, nil
 }
 
 func (a *Service) setupApiStatus(humaApi huma.API) {
@@ -42,6 +112,7 @@ func (a *Service) setupApiStatus(humaApi huma.API) {
 		OperationID: "apiV1StatusGet",
 		Method:      "GET",
 		Path:        "/api/v1/status",
-		Description: "retrieves general status of this service",
+		Description: "Reports version, build, models, collection sizes, dependency checks and the redacted configuration",
+		Security:    scopes(apikey.ScopeAdmin),
 	}, a.status)
 }
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"gophercon-2025/cmd/api/apikey"
+	"gophercon-2025/cmd/api/tool"
+)
+
+type toolListRequest struct{}
+
+type toolListResponse struct {
+	Body []tool.Descriptor
+}
+
+func (a *Service) toolList(_ context.Context, _ *toolListRequest) (*toolListResponse, error) {
+	return &toolListResponse{Body: a.tool.List()}, nil
+}
+
+func (a *Service) setupApiTool(humaApi huma.API) {
+	huma.Register(humaApi, huma.Operation{
+		OperationID: "apiV1ToolsGet",
+		Method:      "GET",
+		Path:        "/api/v1/tools",
+		Description: "Lists the registered tools with their params schema",
+		Security:    scopes(apikey.ScopeQuery),
+	}, a.toolList)
+}
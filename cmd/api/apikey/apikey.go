@@ -0,0 +1,283 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/sqldb"
+)
+
+// Scopes an operation may require. Admin grants every other one.
+const (
+	ScopeQuery      = "query"
+	ScopeRagWrite   = "rag:write"
+	ScopeCacheAdmin = "cache:admin"
+	ScopeAdmin      = "admin"
+)
+
+var Scopes = []string{ScopeQuery, ScopeRagWrite, ScopeCacheAdmin, ScopeAdmin}
+
+var (
+	ErrNotFound     = errors.New("api key not found")
+	ErrExists       = errors.New("api key already exists")
+	ErrInvalid      = errors.New("invalid api key")
+	ErrInvalidScope = errors.New("invalid scope")
+	ErrNoDb         = errors.New("api keys need the tool db")
+)
+
+// secretPrefix marks the secrets of this api, so they are easy to tell apart
+// in configs and to spot by secret scanners.
+const secretPrefix = "gck_"
+
+// lastUsedEvery is how stale last_used_at may get, sparing a write per request.
+const lastUsedEvery = time.Minute
+
+// Key is an api key. Only a hash of its secret is kept, the secret itself is
+// shown once, when created or rotated. Prefix is the start of the secret, to
+// tell keys apart.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Allows tells whether the key grants scope.
+func (k Key) Allows(scope string) bool {
+	return slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope)
+}
+
+type keyCtx struct{}
+
+// WithKey returns a context carrying the key the request was authenticated
+// with.
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, keyCtx{}, key)
+}
+
+// KeyFrom returns the key set by WithKey, if any.
+func KeyFrom(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(keyCtx{}).(Key)
+
+	return key, ok
+}
+
+type Service struct {
+	db     *sql.DB
+	tracer trace.Tracer
+}
+
+type Option func(*Service)
+
+// WithDb migrates the api key table of the tool db.
+func WithDb(db *sql.DB, dialect sqldb.Dialect) Option {
+	return func(s *Service) {
+		if db == nil {
+			return
+		}
+
+		if err := migrate(context.Background(), db, dialect); err != nil {
+			panic(err)
+		}
+
+		s.db = db
+	}
+}
+
+func WithTracer(tracer trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+func New(opts ...Option) (*Service, error) {
+	ret := &Service{}
+
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	if ret.db == nil {
+		return nil, ErrNoDb
+	}
+
+	if ret.tracer == nil {
+		return nil, errors.New("tracer was not initialized")
+	}
+
+	return ret, nil
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one is required", ErrInvalidScope)
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("%w: %s, expected one of %s", ErrInvalidScope, scope, strings.Join(Scopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+func newSecret() (secret string, prefix string, hash string) {
+	secret = secretPrefix + rand.Text()
+
+	return secret, secret[:len(secretPrefix)+8], hashSecret(secret)
+}
+
+// hashSecret is a plain sha256: secrets are random, so there is nothing for a
+// slow hash to protect.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Create adds a key named name granting scopes, expiring after ttl unless it
+// is zero. It returns the key and its secret.
+func (s *Service) Create(ctx context.Context, name string, scopes []string, ttl time.Duration) (ret Key, secret string, err error) {
+	ctx, span := s.tracer.Start(ctx, "apikey.Create", trace.WithAttributes(attribute.String("name", name)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if name == "" {
+		return Key{}, "", fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+	if err = validateScopes(scopes); err != nil {
+		return Key{}, "", err
+	}
+
+	if _, err = s.byName(ctx, name); err == nil {
+		return Key{}, "", fmt.Errorf("%w: %s", ErrExists, name)
+	} else if !errors.Is(err, ErrNotFound) {
+		return Key{}, "", err
+	}
+
+	secret, prefix, hash := newSecret()
+
+	ret = Key{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if ttl > 0 {
+		expires := ret.CreatedAt.Add(ttl)
+		ret.ExpiresAt = &expires
+	}
+
+	if err = s.insert(ctx, ret, hash); err != nil {
+		return Key{}, "", err
+	}
+
+	return ret, secret, nil
+}
+
+// List returns every key, revoked ones included.
+func (s *Service) List(ctx context.Context) (ret []Key, err error) {
+	ctx, span := s.tracer.Start(ctx, "apikey.List")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.list(ctx)
+}
+
+// Rotate replaces the secret of a key, which keeps its name and scopes. The
+// old secret stops working at once.
+func (s *Service) Rotate(ctx context.Context, id string) (ret Key, secret string, err error) {
+	ctx, span := s.tracer.Start(ctx, "apikey.Rotate", trace.WithAttributes(attribute.String("id", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	secret, prefix, hash := newSecret()
+
+	if err = s.rehash(ctx, id, prefix, hash); err != nil {
+		return Key{}, "", err
+	}
+
+	ret, err = s.byID(ctx, id)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	return ret, secret, nil
+}
+
+// Revoke disables a key for good.
+func (s *Service) Revoke(ctx context.Context, id string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "apikey.Revoke", trace.WithAttributes(attribute.String("id", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.revoke(ctx, id, time.Now().UTC())
+}
+
+// Verify returns the key of secret, failing with ErrInvalid when there is
+// none or it was revoked or expired.
+func (s *Service) Verify(ctx context.Context, secret string) (ret Key, err error) {
+	ctx, span := s.tracer.Start(ctx, "apikey.Verify")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ret, err = s.byHash(ctx, hashSecret(secret))
+	if errors.Is(err, ErrNotFound) {
+		return Key{}, ErrInvalid
+	}
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case ret.RevokedAt != nil:
+		return Key{}, fmt.Errorf("%w: revoked", ErrInvalid)
+	case ret.ExpiresAt != nil && ret.ExpiresAt.Before(now):
+		return Key{}, fmt.Errorf("%w: expired", ErrInvalid)
+	}
+
+	span.SetAttributes(attribute.String("name", ret.Name))
+
+	if ret.LastUsedAt == nil || now.Sub(*ret.LastUsedAt) > lastUsedEvery {
+		if err := s.touch(ctx, ret.ID, now); err != nil {
+			slog.Debug("Failed to record api key use", "key", ret.Name, "err", err)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,150 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"strings"
+	"time"
+
+	"gophercon-2025/cmd/api/sqldb"
+)
+
+//go:embed migrations/*.sql
+var embedMigrations embed.FS
+
+// migrate creates the api key table in the tool db. Its migrations are
+// tracked on their own goose table so they do not collide with the tool ones.
+func migrate(ctx context.Context, db *sql.DB, dialect sqldb.Dialect) error {
+	migrations, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	return sqldb.Migrate(ctx, db, dialect, migrations, "goose_apikey_version")
+}
+
+const keyColumns = "id, name, prefix, scopes, created_at, expires_at, revoked_at, last_used_at"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	ret := t.Time.UTC()
+
+	return &ret
+}
+
+func scanKey(row scanner) (Key, error) {
+	var (
+		ret                        Key
+		scopes                     string
+		expires, revoked, lastUsed sql.NullTime
+	)
+
+	err := row.Scan(&ret.ID, &ret.Name, &ret.Prefix, &scopes, &ret.CreatedAt, &expires, &revoked, &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	ret.Scopes = strings.Fields(scopes)
+	ret.CreatedAt = ret.CreatedAt.UTC()
+	ret.ExpiresAt = nullTime(expires)
+	ret.RevokedAt = nullTime(revoked)
+	ret.LastUsedAt = nullTime(lastUsed)
+
+	return ret, nil
+}
+
+func (s *Service) insert(ctx context.Context, key Key, hash string) error {
+	var expires sql.NullTime
+	if key.ExpiresAt != nil {
+		expires = sql.NullTime{Time: *key.ExpiresAt, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_keys (id, name, prefix, hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		key.ID, key.Name, key.Prefix, hash, strings.Join(key.Scopes, " "), key.CreatedAt, expires)
+
+	return err
+}
+
+func (s *Service) list(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+keyColumns+" FROM api_keys ORDER BY created_at, name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := []Key{}
+
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, key)
+	}
+
+	return ret, rows.Err()
+}
+
+func (s *Service) byID(ctx context.Context, id string) (Key, error) {
+	return scanKey(s.db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE id = $1", id))
+}
+
+func (s *Service) byName(ctx context.Context, name string) (Key, error) {
+	return scanKey(s.db.QueryRowContext(ctx,
+		"SELECT "+keyColumns+" FROM api_keys WHERE name = $1 and revoked_at is null", name))
+}
+
+func (s *Service) byHash(ctx context.Context, hash string) (Key, error) {
+	return scanKey(s.db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE hash = $1", hash))
+}
+
+// affected fails with ErrNotFound when res changed no row.
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) rehash(ctx context.Context, id string, prefix string, hash string) error {
+	return affected(s.db.ExecContext(ctx,
+		"UPDATE api_keys SET prefix = $1, hash = $2 WHERE id = $3 and revoked_at is null", prefix, hash, id))
+}
+
+func (s *Service) revoke(ctx context.Context, id string, at time.Time) error {
+	return affected(s.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = $1 WHERE id = $2 and revoked_at is null", at, id))
+}
+
+func (s *Service) touch(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", at, id)
+
+	return err
+}
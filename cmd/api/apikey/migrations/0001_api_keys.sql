@@ -0,0 +1,20 @@
+-- +goose Up
+
+create table api_keys
+(
+    id           text primary key,
+    name         text      not null,
+    prefix       text      not null,
+    hash         text      not null unique,
+    scopes       text      not null,
+    created_at   TIMESTAMP not null,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+create unique index api_keys_name on api_keys (name) where revoked_at is null;
+
+
+-- +goose Down
+drop table api_keys;
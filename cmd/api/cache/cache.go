@@ -4,17 +4,26 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/philippgille/chromem-go"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/vecdb"
 )
 
 const (
 	ColletionNameRag      = "cache"
 	EmbeddingModel        = "nomic-embed-text"
 	DefaultOllamaEndpoint = ""
+
+	// MetaNamespaces holds the RAG namespaces an answer was built from, so it
+	// is only reused for queries with the same scope.
+	MetaNamespaces   = "NAMESPACES"
+	DefaultNamespace = "default"
 )
 
 var defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(EmbeddingModel, DefaultOllamaEndpoint)
@@ -25,6 +34,18 @@ type Service struct {
 
 	embModel string
 	llmEp    string
+	embFunc  chromem.EmbeddingFunc
+
+	ttls       map[string]time.Duration
+	maxEntries int
+
+	indexMu sync.Mutex
+	index   *vecdb.Index
+
+	// hits are the last hit times not written to their entries yet
+	hitsMu  sync.Mutex
+	hits    map[string]time.Time
+	started time.Time
 }
 
 type Option func(*Service)
@@ -47,6 +68,12 @@ func WithOllamaEndpoint(endpoint string) Option {
 	}
 }
 
+func WithEmbeddingFunc(f chromem.EmbeddingFunc) Option {
+	return func(s *Service) {
+		s.embFunc = f
+	}
+}
+
 func WithTracer(tracer trace.Tracer) Option {
 	return func(s *Service) {
 		s.tracer = tracer
@@ -61,27 +88,60 @@ func (r *Service) Add(ctx context.Context, fact string, response, meta string) (
 	}()
 
 	metaMap := map[string]string{
-		"RESPONSE": response,
+		MetaResponse: response,
 	}
 
 	entries := strings.Split(meta, ",")
 
 	for _, entry := range entries {
 		kv := strings.Split(entry, ":")
-		if len(kv) != 2 || kv[0] == "RESPONSE" {
+		if len(kv) != 2 || kv[0] == MetaResponse {
 			continue
 		}
 
 		metaMap[kv[0]] = kv[1]
 	}
 
-	err = r.collection().AddDocument(ctx, chromem.Document{
+	return r.add(ctx, span, fact, metaMap)
+}
+
+func (r *Service) add(ctx context.Context, span trace.Span, fact string, meta map[string]string) error {
+	if meta[MetaNamespaces] == "" {
+		meta[MetaNamespaces] = DefaultNamespace
+	}
+
+	if meta[MetaSource] == "" {
+		meta[MetaSource] = SourceLlm
+	}
+
+	now := time.Now()
+	r.stamp(meta, now)
+
+	col := r.collection()
+
+	doc := chromem.Document{
 		ID:       uuid.NewString(),
-		Metadata: metaMap,
+		Metadata: meta,
 		Content:  fact,
-	})
+	}
+
+	if err := col.AddDocument(ctx, doc); err != nil {
+		return err
+	}
+
+	r.indexAdd(doc)
+
+	if r.maxEntries > 0 && col.Count() > r.maxEntries {
+		nExpired, nEvicted, err := r.sweep(ctx, now, r.maxEntries)
+		span.SetAttributes(
+			attribute.Int("expired", nExpired),
+			attribute.Int("evicted", nEvicted),
+		)
 
-	return err
+		return err
+	}
+
+	return nil
 }
 
 func (r *Service) Clear(ctx context.Context) (err error) {
@@ -91,12 +151,22 @@ func (r *Service) Clear(ctx context.Context) (err error) {
 		span.End()
 	}()
 
-	err = r.db.DeleteCollection(ColletionNameRag)
+	if err = r.db.DeleteCollection(ColletionNameRag); err != nil {
+		return err
+	}
+
+	r.indexMu.Lock()
+	r.index = vecdb.NewIndex()
+	r.indexMu.Unlock()
 
-	return err
+	r.hitsMu.Lock()
+	r.hits = map[string]time.Time{}
+	r.hitsMu.Unlock()
+
+	return nil
 }
 
-func (r *Service) Query(ctx context.Context, s string) (ret []chromem.Result, err error) {
+func (r *Service) Query(ctx context.Context, s string, where map[string]string) (ret []chromem.Result, err error) {
 	ctx, span := r.tracer.Start(ctx, "cache.Query", trace.WithAttributes(attribute.String("query", s)))
 	defer func() {
 		span.RecordError(err)
@@ -112,9 +182,21 @@ func (r *Service) Query(ctx context.Context, s string) (ret []chromem.Result, er
 		nresults = r.collection().Count()
 	}
 
-	ret, err = r.collection().Query(ctx, s, nresults, nil, nil)
+	res, err := r.collection().Query(ctx, s, nresults, where, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// expired entries are left for the janitor, but never served
+	now := time.Now()
 
-	return ret, err
+	for _, doc := range res {
+		if !r.expired(doc.Metadata, now) {
+			ret = append(ret, doc)
+		}
+	}
+
+	return ret, nil
 }
 
 func (r *Service) Del(ctx context.Context, id string) (err error) {
@@ -124,9 +206,64 @@ func (r *Service) Del(ctx context.Context, id string) (err error) {
 		span.End()
 	}()
 
-	err = r.collection().Delete(ctx, nil, nil, id)
+	return r.delete(ctx, id)
+}
+
+// delete removes entries from the collection and the index.
+func (r *Service) delete(ctx context.Context, ids ...string) error {
+	if err := r.collection().Delete(ctx, nil, nil, ids...); err != nil {
+		return err
+	}
 
-	return err
+	if idx := r.indexed(); idx != nil {
+		idx.Remove(ids...)
+	}
+
+	r.hitsMu.Lock()
+	for _, id := range ids {
+		delete(r.hits, id)
+	}
+	r.hitsMu.Unlock()
+
+	return nil
+}
+
+// entries returns the index of the cache entries, reading it back from the
+// collection on first use.
+func (r *Service) entries() (*vecdb.Index, error) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	if r.index == nil {
+		idx, err := vecdb.LoadIndex(r.db, r.collection().Name)
+		if err != nil {
+			return nil, err
+		}
+
+		r.index = idx
+	}
+
+	return r.index, nil
+}
+
+// indexed returns the index if it was loaded already, so changes can be
+// applied to it. An index not loaded yet sees them when read back.
+func (r *Service) indexed() *vecdb.Index {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	return r.index
+}
+
+func (r *Service) indexAdd(docs ...chromem.Document) {
+	if idx := r.indexed(); idx != nil {
+		idx.Add(docs...)
+	}
+}
+
+// Count returns the number of entries, expired ones not swept yet included.
+func (r *Service) Count() int {
+	return r.collection().Count()
 }
 
 func (r *Service) collection() *chromem.Collection {
@@ -144,7 +281,16 @@ func (r *Service) collection() *chromem.Collection {
 }
 
 func New(opts ...Option) (ret *Service, err error) {
-	ret = &Service{}
+	ret = &Service{
+		ttls: map[string]time.Duration{
+			SourceLlm:  DefaultTtlLlm,
+			SourceRag:  DefaultTtlRag,
+			SourceTool: DefaultTtlTool,
+		},
+		maxEntries: DefaultMaxEntries,
+		hits:       map[string]time.Time{},
+		started:    time.Now(),
+	}
 
 	for _, opt := range opts {
 		opt(ret)
@@ -154,7 +300,12 @@ func New(opts ...Option) (ret *Service, err error) {
 		return nil, errors.New("db was not initialized")
 	}
 
-	defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(ret.embModel, ret.llmEp+"/api")
+	switch {
+	case ret.embFunc != nil:
+		defaultEmbeddingFunc = ret.embFunc
+	default:
+		defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(ret.embModel, ret.llmEp+"/api")
+	}
 
 	return ret, nil
 }
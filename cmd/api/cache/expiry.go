@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Sources an answer can come from, each with its own default TTL.
+const (
+	SourceLlm  = "llm"
+	SourceRag  = "rag"
+	SourceTool = "tool"
+)
+
+// Metadata kept on every entry. Timestamps are RFC 3339 in UTC, an empty
+// EXPIRES_AT never expires. Entries without EXPIRES_AT, from before it was
+// kept, expire the TTL of their source after CREATED_AT.
+const (
+	MetaResponse  = "RESPONSE"
+	MetaSource    = "SOURCE"
+	MetaTtl       = "TTL"
+	MetaCreatedAt = "CREATED_AT"
+	MetaExpiresAt = "EXPIRES_AT"
+	MetaLastHit   = "LAST_HIT"
+)
+
+const (
+	DefaultTtlLlm     = 7 * 24 * time.Hour
+	DefaultTtlRag     = 24 * time.Hour
+	DefaultTtlTool    = 5 * time.Minute
+	DefaultMaxEntries = 1000
+)
+
+// WithTtl sets the TTL of answers from source, 0 keeping them forever.
+func WithTtl(source string, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.ttls[source] = ttl
+	}
+}
+
+// WithMaxEntries caps the cache, 0 leaving it unbounded. Once exceeded, the
+// least recently hit entries are evicted down to 90% of the cap, so the scan
+// is not repeated on every add.
+func WithMaxEntries(n int) Option {
+	return func(s *Service) {
+		s.maxEntries = n
+	}
+}
+
+func timeMeta(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func metaTime(meta map[string]string, key string) time.Time {
+	ret, err := time.Parse(time.RFC3339Nano, meta[key])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return ret
+}
+
+// ttl is the default TTL of the answers from source.
+func (r *Service) ttl(source string) time.Duration {
+	ret, ok := r.ttls[source]
+	if !ok {
+		ret = r.ttls[SourceLlm]
+	}
+
+	return ret
+}
+
+// expiresAt tells when an entry expires, zero meaning never. Entries without
+// EXPIRES_AT get it from CREATED_AT, or from when the service started when
+// that is missing too.
+func (r *Service) expiresAt(meta map[string]string) time.Time {
+	if _, ok := meta[MetaExpiresAt]; ok {
+		return metaTime(meta, MetaExpiresAt)
+	}
+
+	ttl := r.ttl(meta[MetaSource])
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	createdAt := metaTime(meta, MetaCreatedAt)
+	if createdAt.IsZero() {
+		createdAt = r.started
+	}
+
+	return createdAt.Add(ttl)
+}
+
+func (r *Service) expired(meta map[string]string, now time.Time) bool {
+	expiresAt := r.expiresAt(meta)
+
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// stamp fills the expiry metadata of a new entry. A TTL in the metadata wins
+// over the default TTL of its source.
+func (r *Service) stamp(meta map[string]string, now time.Time) {
+	ttl := r.ttl(meta[MetaSource])
+
+	if v, err := time.ParseDuration(meta[MetaTtl]); err == nil {
+		ttl = v
+	}
+
+	delete(meta, MetaTtl)
+
+	meta[MetaCreatedAt] = timeMeta(now)
+	meta[MetaLastHit] = timeMeta(now)
+	meta[MetaExpiresAt] = ""
+
+	if ttl > 0 {
+		meta[MetaExpiresAt] = timeMeta(now.Add(ttl))
+	}
+}
+
+// Hit marks an entry as used, so it is the last one to be evicted. Hits are
+// kept in memory and written by the janitor, not on every read.
+func (r *Service) Hit(ctx context.Context, id string) (err error) {
+	_, span := r.tracer.Start(ctx, "cache.Hit")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	idx, err := r.entries()
+	if err != nil {
+		return err
+	}
+
+	// an entry deleted since it was served is not brought back
+	if _, ok := idx.Meta(id); !ok {
+		return nil
+	}
+
+	r.hitsMu.Lock()
+	r.hits[id] = time.Now()
+	r.hitsMu.Unlock()
+
+	return nil
+}
+
+// lastHit is when an entry was last used, hits not written yet included. The
+// caller holds hitsMu.
+func (r *Service) lastHit(id string, meta map[string]string) time.Time {
+	ret := metaTime(meta, MetaLastHit)
+
+	if at, ok := r.hits[id]; ok && at.After(ret) {
+		ret = at
+	}
+
+	return ret
+}
+
+// writeHits writes the hits kept in memory to their entries. Entries deleted
+// meanwhile are skipped, and the hits not written are kept for the next time.
+func (r *Service) writeHits(ctx context.Context) (n int, err error) {
+	r.hitsMu.Lock()
+	hits := r.hits
+	r.hits = map[string]time.Time{}
+	r.hitsMu.Unlock()
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		r.hitsMu.Lock()
+		defer r.hitsMu.Unlock()
+
+		for id, at := range hits {
+			if cur, ok := r.hits[id]; !ok || at.After(cur) {
+				r.hits[id] = at
+			}
+		}
+	}()
+
+	col := r.collection()
+
+	for id, at := range hits {
+		// it only fails for entries no longer there
+		doc, err := col.GetByID(ctx, id)
+		if err != nil {
+			delete(hits, id)
+			continue
+		}
+
+		if at.After(metaTime(doc.Metadata, MetaLastHit)) {
+			doc.Metadata = maps.Clone(doc.Metadata)
+			doc.Metadata[MetaLastHit] = timeMeta(at)
+
+			// the embedding is kept, so re-adding does not embed again
+			if err := col.AddDocument(ctx, doc); err != nil {
+				return n, err
+			}
+
+			r.indexAdd(doc)
+			n++
+		}
+
+		delete(hits, id)
+	}
+
+	return n, nil
+}
+
+// Janitor removes expired entries, enforces the capacity and writes the hits
+// every interval, until ctx is done. The hits left are written on the way out.
+func (r *Service) Janitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if _, err := r.writeHits(context.WithoutCancel(ctx)); err != nil {
+				slog.Warn("Cache hits not written", "err", err)
+			}
+
+			return
+		case <-ticker.C:
+			if err := r.Sweep(ctx); err != nil {
+				slog.Warn("Cache sweep failed", "err", err)
+			}
+		}
+	}
+}
+
+// Sweep removes expired entries, then evicts the least recently hit ones
+// while the cache is over capacity. The hits of the entries left are written.
+func (r *Service) Sweep(ctx context.Context) (err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.Sweep")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	nExpired, nEvicted, err := r.sweep(ctx, time.Now(), r.maxEntries)
+	if err != nil {
+		return err
+	}
+
+	nHits, err := r.writeHits(ctx)
+
+	span.SetAttributes(
+		attribute.Int("expired", nExpired),
+		attribute.Int("evicted", nEvicted),
+		attribute.Int("hits", nHits),
+	)
+
+	return err
+}
+
+func (r *Service) sweep(ctx context.Context, now time.Time, maxEntries int) (nExpired int, nEvicted int, err error) {
+	idx, err := r.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type entry struct {
+		id      string
+		lastHit time.Time
+	}
+
+	var (
+		ids  []string
+		live []entry
+	)
+
+	r.hitsMu.Lock()
+
+	idx.Select(func(id string, meta map[string]string) bool {
+		switch {
+		case r.expired(meta, now):
+			ids = append(ids, id)
+		default:
+			live = append(live, entry{id: id, lastHit: r.lastHit(id, meta)})
+		}
+
+		return false
+	})
+
+	r.hitsMu.Unlock()
+
+	nExpired = len(ids)
+
+	if maxEntries > 0 && len(live) > maxEntries {
+		sort.SliceStable(live, func(i, j int) bool {
+			return live[i].lastHit.Before(live[j].lastHit)
+		})
+
+		keep := maxEntries - maxEntries/10
+
+		for _, e := range live[:len(live)-keep] {
+			ids = append(ids, e.id)
+		}
+
+		nEvicted = len(ids) - nExpired
+	}
+
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	err = r.delete(ctx, ids...)
+
+	return nExpired, nEvicted, err
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"gophercon-2025/cmd/api/provider"
+)
+
+func newTestService(t *testing.T, opts ...Option) *Service {
+	t.Helper()
+
+	ret, err := New(append([]Option{
+		WithDb(chromem.NewDB()),
+		WithEmbeddingFunc(provider.EmbeddingFunc(provider.NewFake(), "fake")),
+		WithTracer(tracenoop.NewTracerProvider().Tracer("")),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestSweepLegacyEntries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, WithTtl(SourceRag, time.Hour))
+	now := time.Now()
+
+	legacy := []chromem.Document{
+		{ID: "old", Content: "old", Metadata: map[string]string{MetaSource: SourceRag, MetaCreatedAt: timeMeta(now.Add(-2 * time.Hour))}},
+		{ID: "recent", Content: "recent", Metadata: map[string]string{MetaSource: SourceRag, MetaCreatedAt: timeMeta(now.Add(-time.Minute))}},
+		{ID: "unknown", Content: "unknown", Metadata: map[string]string{MetaSource: SourceRag}},
+		{ID: "forever", Content: "forever", Metadata: map[string]string{MetaSource: SourceRag, MetaExpiresAt: ""}},
+	}
+
+	if err := s.collection().AddDocuments(ctx, legacy, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	nExpired, _, err := s.sweep(ctx, now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nExpired != 1 {
+		t.Fatalf("expired %d entries, want 1", nExpired)
+	}
+
+	if _, err := s.collection().GetByID(ctx, "old"); err == nil {
+		t.Fatal("entry past created at + ttl was kept")
+	}
+
+	// without created at the ttl counts from when the service started
+	if nExpired, _, err = s.sweep(ctx, now.Add(2*time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if nExpired != 2 {
+		t.Fatalf("expired %d entries, want recent and unknown", nExpired)
+	}
+
+	if s.Count() != 1 {
+		t.Fatalf("%d entries left, want forever only", s.Count())
+	}
+}
+
+func TestHit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+
+	if err := s.Add(ctx, "qual o horario", "das 8 as 18", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := s.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := idx.Select(nil)[0]
+
+	before, err := s.collection().GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Hit(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := s.collection().GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Metadata[MetaLastHit] != before.Metadata[MetaLastHit] {
+		t.Fatal("hit was written on read")
+	}
+
+	if err := s.Sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err = s.collection().GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !metaTime(doc.Metadata, MetaLastHit).After(metaTime(before.Metadata, MetaLastHit)) {
+		t.Fatal("hit was not written by the sweep")
+	}
+
+	// hits on deleted entries must not bring them back
+	if err := s.Hit(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Del(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Hit(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Count() != 0 {
+		t.Fatal("deleted entry came back")
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"io"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/vecdb"
+)
+
+// addConcurrency bounds the embedding calls made while importing.
+const addConcurrency = 4
+
+// Export writes every cache entry as JSONL, a page at a time, the answer being
+// kept in the RESPONSE metadata. Pending hits are written first, so the
+// export has them.
+func (r *Service) Export(ctx context.Context, w io.Writer, embeddings bool) (n int, err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.Export", trace.WithAttributes(attribute.Bool("embeddings", embeddings)))
+	defer func() {
+		span.SetAttributes(attribute.Int("entries", n))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	idx, err := r.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = r.writeHits(ctx); err != nil {
+		return 0, err
+	}
+
+	return vecdb.WriteDocuments(ctx, w, r.collection(), idx.Select(nil), "", embeddings)
+}
+
+// Import adds the entries of a JSONL export. Entries keep their ids, so
+// importing the same export twice replaces them.
+func (r *Service) Import(ctx context.Context, rd io.Reader) (n int, err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.Import")
+	defer func() {
+		span.SetAttributes(attribute.Int("entries", n))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	n, err = vecdb.ReadRecords(ctx, rd, func(batch []vecdb.Record) error {
+		docs := make([]chromem.Document, 0, len(batch))
+
+		for _, rec := range batch {
+			doc := rec.Document()
+			if doc.Metadata == nil {
+				doc.Metadata = map[string]string{}
+			}
+
+			if doc.Metadata[MetaNamespaces] == "" {
+				doc.Metadata[MetaNamespaces] = DefaultNamespace
+			}
+
+			docs = append(docs, doc)
+		}
+
+		if err := r.collection().AddDocuments(ctx, docs, addConcurrency); err != nil {
+			return err
+		}
+
+		r.indexAdd(docs...)
+
+		return nil
+	})
+
+	return n, err
+}
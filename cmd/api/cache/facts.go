@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MetaFacts holds the rag facts an answer was built from, as a JSON list of
+// namespace/id, so the answer can be dropped when any of them changes.
+const MetaFacts = "FACTS"
+
+// Answer is an llm answer to be cached along with where it came from.
+type Answer struct {
+	Query      string
+	Response   string
+	Namespaces string
+	Source     string
+	Facts      []FactRef
+}
+
+type FactRef struct {
+	Namespace string
+	ID        string
+}
+
+func (f FactRef) String() string {
+	return f.Namespace + "/" + f.ID
+}
+
+func (r *Service) AddAnswer(ctx context.Context, a Answer) (err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.AddAnswer", trace.WithAttributes(
+		attribute.String("source", a.Source),
+		attribute.Int("facts", len(a.Facts)),
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	meta := map[string]string{
+		MetaResponse:   a.Response,
+		MetaNamespaces: a.Namespaces,
+		MetaSource:     a.Source,
+	}
+
+	if len(a.Facts) > 0 {
+		refs := make([]string, 0, len(a.Facts))
+		for _, f := range a.Facts {
+			refs = append(refs, f.String())
+		}
+
+		bs, err := json.Marshal(refs)
+		if err != nil {
+			return err
+		}
+
+		meta[MetaFacts] = string(bs)
+	}
+
+	return r.add(ctx, span, a.Query, meta)
+}
+
+func entryFacts(meta map[string]string) []string {
+	var ret []string
+
+	if err := json.Unmarshal([]byte(meta[MetaFacts]), &ret); err != nil {
+		return nil
+	}
+
+	return ret
+}
+
+// dependsOn tells whether an entry was built from any of ids in namespace,
+// or from any fact of namespace when ids is empty.
+func dependsOn(meta map[string]string, namespace string, ids []string) bool {
+	for _, ref := range entryFacts(meta) {
+		ns, id, _ := strings.Cut(ref, "/")
+		if ns != namespace {
+			continue
+		}
+
+		if len(ids) == 0 || slices.Contains(ids, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dependents returns the ids of the entries built from ids of namespace.
+func (r *Service) dependents(namespace string, ids []string) ([]string, error) {
+	idx, err := r.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.Select(func(_ string, meta map[string]string) bool {
+		return dependsOn(meta, namespace, ids)
+	}), nil
+}
+
+// Dependents returns the entries built from fact id of namespace.
+func (r *Service) Dependents(ctx context.Context, namespace string, id string) (ret []chromem.Document, err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.Dependents", trace.WithAttributes(
+		attribute.String("namespace", namespace),
+		attribute.String("id", id),
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ids, err := r.dependents(namespace, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	col := r.collection()
+
+	for _, entryId := range ids {
+		// it only fails for entries deleted meanwhile
+		doc, err := col.GetByID(ctx, entryId)
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, doc)
+	}
+
+	return ret, nil
+}
+
+// InvalidateFacts deletes the entries built from ids of namespace, or from any
+// fact of namespace when no ids are given.
+func (r *Service) InvalidateFacts(ctx context.Context, namespace string, ids ...string) (n int, err error) {
+	ctx, span := r.tracer.Start(ctx, "cache.InvalidateFacts", trace.WithAttributes(
+		attribute.String("namespace", namespace),
+		attribute.Int("facts", len(ids)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("invalidated", n))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	entryIds, err := r.dependents(namespace, ids)
+	if err != nil || len(entryIds) == 0 {
+		return 0, err
+	}
+
+	if err = r.delete(ctx, entryIds...); err != nil {
+		return 0, err
+	}
+
+	return len(entryIds), nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	collectionRag   = "rag"
+	collectionCache = "cache"
+)
+
+type exportFlags struct {
+	namespaces []string
+	embeddings bool
+	out        string
+}
+
+func exportCommand(f *flags) *cli.Command {
+	ef := &exportFlags{}
+
+	return &cli.Command{
+		Name:      "export",
+		Usage:     "Exports the rag or the cache as JSONL",
+		ArgsUsage: "rag|cache",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "namespace",
+				Usage:       "rag namespaces to export - every one when empty",
+				Destination: &ef.namespaces,
+			},
+			&cli.BoolFlag{
+				Name:        "embeddings",
+				Usage:       "includes embeddings, sparing the embedding calls on import",
+				Destination: &ef.embeddings,
+			},
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "file to write - <collection>.jsonl when empty",
+				Destination: &ef.out,
+			},
+		},
+		Action: func(ctx context.Context, command *cli.Command) error {
+			return runExport(ctx, f, ef, command.Args().First())
+		},
+	}
+}
+
+func runExport(ctx context.Context, f *flags, ef *exportFlags, collection string) (err error) {
+	if collection != collectionRag && collection != collectionCache {
+		return fmt.Errorf("unknown collection %q, expected rag or cache", collection)
+	}
+
+	out := ef.out
+	if out == "" {
+		out = collection + ".jsonl"
+	}
+
+	otelShutdown, err := setupCliTelemetry(ctx, f, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	defer otelShutdown()
+
+	vs, err := newVecStores(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	// logs go to stdout, so exports always go to a file
+	fout, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := fout.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := bufio.NewWriter(fout)
+
+	var n int
+
+	switch collection {
+	case collectionRag:
+		n, err = vs.rag.Export(ctx, w, ef.namespaces, ef.embeddings)
+	case collectionCache:
+		n, err = vs.cache.Export(ctx, w, ef.embeddings)
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Collection exported", "collection", collection, "records", n, "out", out)
+
+	return nil
+}
+
+func importCommand(f *flags) *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Usage:     "Imports a JSONL export into the rag or the cache",
+		ArgsUsage: "rag|cache <file>... (- reads stdin)",
+		Action: func(ctx context.Context, command *cli.Command) error {
+			return runImport(ctx, f, command.Args().First(), command.Args().Tail())
+		},
+	}
+}
+
+func runImport(ctx context.Context, f *flags, collection string, files []string) error {
+	if collection != collectionRag && collection != collectionCache {
+		return fmt.Errorf("unknown collection %q, expected rag or cache", collection)
+	}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	otelShutdown, err := setupCliTelemetry(ctx, f, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	defer otelShutdown()
+
+	vs, err := newVecStores(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	for _, fname := range files {
+		n, err := importFile(ctx, vs, collection, fname)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+
+		slog.Info("Collection imported", "collection", collection, "records", n, "file", fname)
+	}
+
+	return nil
+}
+
+func importFile(ctx context.Context, vs *vecStores, collection string, fname string) (int, error) {
+	var r io.Reader = os.Stdin
+
+	if fname != "-" {
+		fin, err := os.Open(fname)
+		if err != nil {
+			return 0, err
+		}
+		defer fin.Close()
+
+		r = fin
+	}
+
+	if collection == collectionCache {
+		return vs.cache.Import(ctx, r)
+	}
+
+	return vs.rag.Import(ctx, r)
+}
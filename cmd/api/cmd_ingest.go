@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"gophercon-2025/cmd/api/ingest"
+	"gophercon-2025/cmd/api/telemetry"
+	"gophercon-2025/cmd/api/tokenizer"
+)
+
+type ingestFlags struct {
+	namespace string
+	format    string
+	strategy  string
+	source    string
+	server    string
+	apiKey    string
+}
+
+func ingestCommand(f *flags) *cli.Command {
+	inf := &ingestFlags{}
+
+	return &cli.Command{
+		Name:      "ingest",
+		Usage:     "Splits documents in chunks and adds them to rag",
+		ArgsUsage: "<file>... (- reads stdin)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "namespace",
+				Destination: &inf.namespace,
+			},
+			&cli.StringFlag{
+				Name:        "format",
+				Usage:       "text, markdown or html - guessed from the file extension when empty",
+				Destination: &inf.format,
+			},
+			&cli.StringFlag{
+				Name:        "strategy",
+				Value:       ingest.StrategyTokens,
+				Usage:       "tokens or headings",
+				Destination: &inf.strategy,
+			},
+			&cli.StringFlag{
+				Name:        "source",
+				Usage:       "source recorded on chunks - the file name when empty",
+				Destination: &inf.source,
+			},
+			&cli.StringFlag{
+				Name:        "server",
+				Usage:       "url of the running api to ingest through, ex http://localhost:8080 - when empty the vector db is written directly, which needs the api stopped",
+				Destination: &inf.server,
+				Sources:     cli.EnvVars("API_SERVER"),
+			},
+			&cli.StringFlag{
+				Name:        "api-key",
+				Usage:       "api key with the rag:write scope, for --server",
+				Destination: &inf.apiKey,
+				Sources:     cli.EnvVars("API_KEY"),
+			},
+		},
+		Action: func(ctx context.Context, command *cli.Command) error {
+			return runIngest(ctx, f, inf, command.Args().Slice())
+		},
+	}
+}
+
+// ingestFunc ingests a single document, locally or through the api.
+type ingestFunc func(ctx context.Context, doc ingest.Document) (ingest.Ingested, error)
+
+func runIngest(ctx context.Context, f *flags, inf *ingestFlags, files []string) error {
+	if len(files) == 0 {
+		return errors.New("no documents given")
+	}
+
+	otelShutdown, err := setupCliTelemetry(ctx, f, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	defer otelShutdown()
+
+	ingestFn := remoteIngest(inf)
+
+	if inf.server == "" {
+		ingestFn, err = localIngest(ctx, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fname := range files {
+		var bs []byte
+
+		switch fname {
+		case "-":
+			bs, err = io.ReadAll(os.Stdin)
+		default:
+			bs, err = os.ReadFile(fname)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		doc := ingest.Document{
+			Source:    inf.source,
+			Namespace: inf.namespace,
+			Format:    inf.format,
+			Strategy:  inf.strategy,
+			Content:   string(bs),
+		}
+
+		if doc.Source == "" {
+			doc.Source = fname
+		}
+
+		if doc.Format == "" {
+			doc.Format = ingest.FormatFromFilename(fname)
+		}
+
+		res, err := ingestFn(ctx, doc)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Document ingested", "source", doc.Source, "id", res.DocumentId, "namespace", res.Namespace, "chunks", res.Chunks)
+	}
+
+	return nil
+}
+
+// localIngest writes the vector db directly. A running api keeps its
+// collections and lexical indexes in memory and would not see the chunks, so
+// it refuses to when the api answers at the listening address.
+func localIngest(ctx context.Context, f *flags) (ingestFunc, error) {
+	if addr, running := apiRunning(ctx, f.listeningAddr); running {
+		return nil, fmt.Errorf("the api is running at %s and would not see the chunks: ingest through it with --server or stop it", addr)
+	}
+
+	vs, err := newVecStores(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	ingestService, err := ingest.New(
+		ingest.WithRag(vs.rag),
+		ingest.WithTokenizer(tokenizer.New(tokenizer.WithPretrainedFromCache(f.tokenizerModel, f.tokenizerCache))),
+		ingest.WithTracer(telemetry.Tracer),
+		ingest.WithChunkTokens(int(f.chunkTokens)),
+		ingest.WithOverlapTokens(int(f.overlapTokens)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ingestService.Ingest, nil
+}
+
+// apiRunning tells whether an api answers its liveness probe at addr.
+func apiRunning(ctx context.Context, addr string) (string, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", false
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	base := "http://" + net.JoinHostPort(host, port)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/healthz", nil)
+	if err != nil {
+		return "", false
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false
+	}
+
+	defer res.Body.Close()
+
+	return base, res.StatusCode == http.StatusOK
+}
+
+// remoteIngest posts documents to the ingest endpoint of a running api.
+func remoteIngest(inf *ingestFlags) ingestFunc {
+	return func(ctx context.Context, doc ingest.Document) (ingest.Ingested, error) {
+		bs, err := json.Marshal(doc)
+		if err != nil {
+			return ingest.Ingested{}, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimSuffix(inf.server, "/")+"/api/v1/rag/documents", bytes.NewReader(bs))
+		if err != nil {
+			return ingest.Ingested{}, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		if inf.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+inf.apiKey)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return ingest.Ingested{}, err
+		}
+
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+			return ingest.Ingested{}, fmt.Errorf("ingesting %s: %s: %s", doc.Source, res.Status, bytes.TrimSpace(msg))
+		}
+
+		ret := ingest.Ingested{}
+		err = json.NewDecoder(res.Body).Decode(&ret)
+
+		return ret, err
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"gophercon-2025/cmd/api/apikey"
+)
+
+type keysFlags struct {
+	name   string
+	scopes []string
+	ttl    time.Duration
+}
+
+func keysCommand(f *flags) *cli.Command {
+	kf := &keysFlags{}
+
+	return &cli.Command{
+		Name:  "keys",
+		Usage: "Manages the api keys of the tool db",
+		Commands: []*cli.Command{
+			{
+				Name:  "create",
+				Usage: "Creates a key and prints its secret, which can't be retrieved again",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "name",
+						Usage:       "key name, also its name in the tool policies",
+						Required:    true,
+						Destination: &kf.name,
+					},
+					&cli.StringSliceFlag{
+						Name:        "scope",
+						Usage:       "scopes granted: " + strings.Join(apikey.Scopes, ", "),
+						Value:       []string{apikey.ScopeQuery},
+						Destination: &kf.scopes,
+					},
+					&cli.DurationFlag{
+						Name:        "ttl",
+						Usage:       "lifetime of the key, 0 never expires",
+						Destination: &kf.ttl,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					return runKeys(ctx, f, func(keys *apikey.Service) error {
+						key, secret, err := keys.Create(ctx, kf.name, kf.scopes, kf.ttl)
+						if err != nil {
+							return err
+						}
+
+						printSecret(key, secret)
+
+						return nil
+					})
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "Lists the keys, revoked ones included",
+				Action: func(ctx context.Context, command *cli.Command) error {
+					return runKeys(ctx, f, func(keys *apikey.Service) error {
+						list, err := keys.List(ctx)
+						if err != nil {
+							return err
+						}
+
+						printKeys(list)
+
+						return nil
+					})
+				},
+			},
+			{
+				Name:      "rotate",
+				Usage:     "Replaces the secret of a key and prints the new one",
+				ArgsUsage: "id",
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id := command.Args().First()
+					if id == "" {
+						return errors.New("the key id is required")
+					}
+
+					return runKeys(ctx, f, func(keys *apikey.Service) error {
+						key, secret, err := keys.Rotate(ctx, id)
+						if err != nil {
+							return err
+						}
+
+						printSecret(key, secret)
+
+						return nil
+					})
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "Revokes a key",
+				ArgsUsage: "id",
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id := command.Args().First()
+					if id == "" {
+						return errors.New("the key id is required")
+					}
+
+					return runKeys(ctx, f, func(keys *apikey.Service) error {
+						return keys.Revoke(ctx, id)
+					})
+				},
+			},
+		},
+	}
+}
+
+// runKeys opens the api keys of the tool db for fn. Logs go to stderr, so
+// stdout carries just the output, secrets included.
+func runKeys(ctx context.Context, f *flags, fn func(keys *apikey.Service) error) error {
+	otelShutdown, err := setupCliTelemetry(ctx, f, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	defer otelShutdown()
+
+	db, dialect, err := openToolDb(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	if db == nil {
+		return errors.New("api keys need the tool db, set --tool-db")
+	}
+
+	defer db.Close()
+
+	keys, err := openApiKeys(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	return fn(keys)
+}
+
+func printSecret(key apikey.Key, secret string) {
+	fmt.Printf("id:     %s\nname:   %s\nscopes: %s\nsecret: %s\n", key.ID, key.Name, strings.Join(key.Scopes, " "), secret)
+}
+
+func printKeys(keys []apikey.Key) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tEXPIRES\tLAST USED\tSTATUS")
+
+	stamp := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+
+		return t.Local().Format(time.DateTime)
+	}
+
+	for _, k := range keys {
+		status := "active"
+
+		switch {
+		case k.RevokedAt != nil:
+			status = "revoked"
+		case k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now()):
+			status = "expired"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, " "),
+			stamp(&k.CreatedAt), stamp(k.ExpiresAt), stamp(k.LastUsedAt), status)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"gophercon-2025/cmd/api/mcp"
+	"gophercon-2025/cmd/api/telemetry"
+)
+
+func mcpCommand(f *flags) *cli.Command {
+	return &cli.Command{
+		Name:  "mcp",
+		Usage: "Serves the tools and the rag as an mcp server over stdio",
+		Action: func(ctx context.Context, command *cli.Command) error {
+			return runMcp(ctx, f)
+		},
+	}
+}
+
+// runMcp serves a single mcp client over stdio. Stdout carries the protocol,
+// so logs go to stderr.
+func runMcp(ctx context.Context, f *flags) error {
+	otelShutdown, err := setupCliTelemetry(ctx, f, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	defer otelShutdown()
+
+	db, dialect, err := openToolDb(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	if db != nil {
+		defer db.Close()
+	}
+
+	toolSvc := newToolService(f, db, dialect)
+	defer toolSvc.Close()
+
+	vs, err := newVecStores(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	mcpService, err := mcp.New(
+		mcp.WithTool(toolSvc),
+		mcp.WithRag(vs.rag),
+		mcp.WithTracer(telemetry.Tracer),
+	)
+	if err != nil {
+		return err
+	}
+
+	toolSvc.OnChange(mcpService.Sync)
+
+	if f.toolsReload > 0 {
+		go toolSvc.Watch(ctx, f.toolsReload)
+	}
+
+	slog.Info("Serving mcp over stdio")
+
+	return mcpService.RunStdio(ctx)
+}
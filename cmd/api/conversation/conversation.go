@@ -0,0 +1,153 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+var ErrNotFound = errors.New("conversation not found")
+
+type Message struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Tokens    int       `json:"tokens"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Conversation struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Messages  []Message `json:"messages,omitempty"`
+}
+
+// Store persists conversations and their message history. List does not need
+// to fill Messages, Get must return them in the order they were appended.
+type Store interface {
+	Create(ctx context.Context, c Conversation) error
+	Get(ctx context.Context, id string) (Conversation, error)
+	List(ctx context.Context) ([]Conversation, error)
+	Append(ctx context.Context, id string, msgs ...Message) error
+	Delete(ctx context.Context, id string) error
+}
+
+type Service struct {
+	store  Store
+	tracer trace.Tracer
+}
+
+type Option func(*Service)
+
+func WithStore(store Store) Option {
+	return func(s *Service) {
+		s.store = store
+	}
+}
+
+func WithTracer(tracer trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+func (s *Service) Create(ctx context.Context, title string) (ret Conversation, err error) {
+	ctx, span := s.tracer.Start(ctx, "conversation.Create")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	now := time.Now()
+
+	ret = Conversation{
+		ID:        uuid.NewString(),
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	span.SetAttributes(attribute.String("id", ret.ID))
+
+	if err = s.store.Create(ctx, ret); err != nil {
+		return Conversation{}, err
+	}
+
+	return ret, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (ret Conversation, err error) {
+	ctx, span := s.tracer.Start(ctx, "conversation.Get", trace.WithAttributes(attribute.String("id", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.store.Get(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context) (ret []Conversation, err error) {
+	ctx, span := s.tracer.Start(ctx, "conversation.List")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.store.List(ctx)
+}
+
+func (s *Service) Append(ctx context.Context, id string, msgs ...Message) (err error) {
+	ctx, span := s.tracer.Start(ctx, "conversation.Append", trace.WithAttributes(attribute.String("id", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	now := time.Now()
+
+	for i := range msgs {
+		if msgs[i].CreatedAt.IsZero() {
+			msgs[i].CreatedAt = now
+		}
+	}
+
+	return s.store.Append(ctx, id, msgs...)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "conversation.Delete", trace.WithAttributes(attribute.String("id", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.store.Delete(ctx, id)
+}
+
+func New(opts ...Option) (ret *Service, err error) {
+	ret = &Service{}
+
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	if ret.store == nil {
+		ret.store = NewMemoryStore()
+	}
+
+	if ret.tracer == nil {
+		return nil, errors.New("tracer was not initialized")
+	}
+
+	return ret, nil
+}
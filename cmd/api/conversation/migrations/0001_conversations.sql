@@ -0,0 +1,26 @@
+-- +goose Up
+
+create table conversations
+(
+    id         text primary key,
+    title      text,
+    created_at TIMESTAMP not null,
+    updated_at TIMESTAMP not null
+);
+
+create table conversation_messages
+(
+    id              BIGSERIAL primary key,
+    conversation_id text      not null references conversations (id) on delete cascade,
+    role            text      not null,
+    content         text      not null,
+    tokens          INTEGER   not null default 0,
+    created_at      TIMESTAMP not null
+);
+
+create index conversation_messages_conversation_id on conversation_messages (conversation_id, id);
+
+
+-- +goose Down
+drop table conversation_messages;
+drop table conversations;
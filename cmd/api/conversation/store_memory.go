@@ -0,0 +1,89 @@
+package conversation
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mtx           sync.RWMutex
+	conversations map[string]*Conversation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{conversations: map[string]*Conversation{}}
+}
+
+func (m *MemoryStore) Create(_ context.Context, c Conversation) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.conversations[c.ID] = &c
+
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (Conversation, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	c, ok := m.conversations[id]
+	if !ok {
+		return Conversation{}, ErrNotFound
+	}
+
+	ret := *c
+	ret.Messages = slices.Clone(c.Messages)
+
+	return ret, nil
+}
+
+func (m *MemoryStore) List(_ context.Context) ([]Conversation, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	ret := make([]Conversation, 0, len(m.conversations))
+
+	for _, c := range m.conversations {
+		item := *c
+		item.Messages = nil
+		ret = append(ret, item)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].UpdatedAt.After(ret[j].UpdatedAt)
+	})
+
+	return ret, nil
+}
+
+func (m *MemoryStore) Append(_ context.Context, id string, msgs ...Message) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	c, ok := m.conversations[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	c.Messages = append(c.Messages, msgs...)
+	c.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, id string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.conversations[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.conversations, id)
+
+	return nil
+}
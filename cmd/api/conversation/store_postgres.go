@@ -0,0 +1,157 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"time"
+
+	"gophercon-2025/cmd/api/sqldb"
+)
+
+//go:embed migrations/*.sql
+var embedMigrations embed.FS
+
+// PostgresStore keeps conversations in the tool db. Its migrations are tracked
+// on their own goose table so they do not collide with the tool migrations.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*PostgresStore, error) {
+	migrations, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = sqldb.Migrate(ctx, db, sqldb.DialectPostgres, migrations, "goose_conversation_version"); err != nil {
+		return nil, err
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+func (p *PostgresStore) Create(ctx context.Context, c Conversation) error {
+	_, err := p.db.ExecContext(ctx,
+		"INSERT INTO conversations (id, title, created_at, updated_at) VALUES ($1, $2, $3, $4)",
+		c.ID, c.Title, c.CreatedAt, c.UpdatedAt)
+
+	return err
+}
+
+func (p *PostgresStore) Get(ctx context.Context, id string) (Conversation, error) {
+	ret := Conversation{}
+
+	err := p.db.QueryRowContext(ctx,
+		"SELECT id, title, created_at, updated_at FROM conversations WHERE id = $1", id).
+		Scan(&ret.ID, &ret.Title, &ret.CreatedAt, &ret.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Conversation{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT role, content, tokens, created_at FROM conversation_messages WHERE conversation_id = $1 order by id",
+		id)
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		msg := Message{}
+
+		if err = rows.Scan(&msg.Role, &msg.Content, &msg.Tokens, &msg.CreatedAt); err != nil {
+			return Conversation{}, err
+		}
+
+		ret.Messages = append(ret.Messages, msg)
+	}
+
+	return ret, rows.Err()
+}
+
+func (p *PostgresStore) List(ctx context.Context) ([]Conversation, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT id, title, created_at, updated_at FROM conversations order by updated_at desc")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := []Conversation{}
+
+	for rows.Next() {
+		c := Conversation{}
+
+		if err = rows.Scan(&c.ID, &c.Title, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, c)
+	}
+
+	return ret, rows.Err()
+}
+
+func (p *PostgresStore) Append(ctx context.Context, id string, msgs ...Message) (err error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, "UPDATE conversations SET updated_at = $1 WHERE id = $2", time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	for _, msg := range msgs {
+		if _, err = tx.ExecContext(ctx,
+			"INSERT INTO conversation_messages (conversation_id, role, content, tokens, created_at) VALUES ($1, $2, $3, $4, $5)",
+			id, msg.Role, msg.Content, msg.Tokens, msg.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgresStore) Delete(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, "DELETE FROM conversations WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
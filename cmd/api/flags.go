@@ -2,20 +2,46 @@ package main
 
 import (
 	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/urfave/cli/v3"
 )
 
 type flags struct {
 	listeningAddr      string
+	mcpPath            string
+	auth               bool
 	vecDbPath          string
 	llmModel           string
 	embModel           string
 	minConfidenceRag   float64
 	minConfidenceTool  float64
 	minConfidenceCache float64
+	minScoreLexical    float64
 	temperature        float64
 	toolDb             string
+	toolsFile          string
+	toolsReload        time.Duration
+	toolTimeout        time.Duration
+	toolMaxOutput      int64
+	toolConcurrency    int64
+	conversationStore  string
+	historyTokens      int64
+	agentMaxSteps      int64
+	chunkTokens        int64
+	overlapTokens      int64
+	ragLexicalWeight   float64
+	ragRrfK            int64
+
+	cacheTtlLlm          time.Duration
+	cacheTtlRag          time.Duration
+	cacheTtlTool         time.Duration
+	cacheMaxEntries      int64
+	cacheJanitorInterval time.Duration
+	cacheToolAnswers     bool
 
 	tokenizerModel string
 	tokenizerCache string
@@ -23,6 +49,15 @@ type flags struct {
 	slogLevel string
 	otelEp    string
 	llmEp     string
+
+	llmProvider string
+	llmApiKey   string
+
+	rateLimit       float64
+	rateBurst       int64
+	llmConcurrency  int64
+	llmQueue        int64
+	llmQueueTimeout time.Duration
 }
 
 func (f *flags) SlogLevel() slog.Level {
@@ -40,6 +75,51 @@ func (f *flags) SlogLevel() slog.Level {
 	}
 }
 
+// secretFlags hold credentials, the status route only tells they are set.
+var secretFlags = []string{"llm-api-key"}
+
+// dsnPassword matches the password of key=value dsns and url queries.
+var dsnPassword = regexp.MustCompile(`(?i)(password=)[^\s&]+`)
+
+// redactedConfig returns the value of every flag of command, for the status
+// route. Secrets are masked and passwords dropped from urls and dsns.
+func redactedConfig(command *cli.Command) map[string]any {
+	ret := map[string]any{}
+
+	for _, fl := range command.Flags {
+		name := fl.Names()[0]
+		if name == "help" {
+			continue
+		}
+
+		v := command.Value(name)
+
+		switch value := v.(type) {
+		case time.Duration:
+			v = value.String()
+		case string:
+			switch {
+			case slices.Contains(secretFlags, name) && value != "":
+				v = "[redacted]"
+			case value != "":
+				v = redactDsn(value)
+			}
+		}
+
+		ret[name] = v
+	}
+
+	return ret
+}
+
+func redactDsn(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		s = u.Redacted()
+	}
+
+	return dsnPassword.ReplaceAllString(s, "${1}xxxxx")
+}
+
 func (f *flags) build() []cli.Flag {
 	return []cli.Flag{
 		&cli.StringFlag{
@@ -49,6 +129,22 @@ func (f *flags) build() []cli.Flag {
 			DefaultText: ":8080",
 			Sources:     cli.EnvVars("ADDR"),
 		},
+		&cli.StringFlag{
+			Name:        "mcp-path",
+			Value:       "/mcp",
+			Usage:       "path the mcp server is served at over streamable http, empty disables it",
+			Destination: &f.mcpPath,
+			DefaultText: "/mcp",
+			Sources:     cli.EnvVars("MCP_PATH"),
+		},
+		&cli.BoolFlag{
+			Name:        "auth",
+			Value:       true,
+			Usage:       "requires an api key, created with the keys command, on every route but the public ones. Off by default without a --tool-db to keep the keys in",
+			Destination: &f.auth,
+			DefaultText: "true with a --tool-db",
+			Sources:     cli.EnvVars("AUTH"),
+		},
 		&cli.StringFlag{
 			Name:        "db",
 			Value:       "./db",
@@ -91,6 +187,14 @@ func (f *flags) build() []cli.Flag {
 			DefaultText: "0.9",
 			Sources:     cli.EnvVars("MIN_CONFIDENCE_CACHE"),
 		},
+		&cli.FloatFlag{
+			Name:        "min-score-lexical",
+			Value:       2.0,
+			Usage:       "BM25 score for a fact found by its words to be used as context, 0 only uses similarity",
+			Destination: &f.minScoreLexical,
+			DefaultText: "2.0",
+			Sources:     cli.EnvVars("MIN_SCORE_LEXICAL"),
+		},
 		&cli.FloatFlag{
 			Name:        "temperature",
 			Value:       0.5,
@@ -129,10 +233,148 @@ func (f *flags) build() []cli.Flag {
 		&cli.StringFlag{
 			Name:        "tool-db",
 			Value:       "./data/db.sqlite",
+			Usage:       "postgres:// dsn, sqlite file path, memory for an in-memory sqlite or none to disable kpi tools",
 			Destination: &f.toolDb,
 			DefaultText: "./data/db.sqlite",
 			Sources:     cli.EnvVars("TOOL_DB"),
 		},
+		&cli.StringFlag{
+			Name:        "tools-file",
+			Value:       "tools.yaml",
+			Usage:       "yaml file defining exec and http tools, ignored when missing",
+			Destination: &f.toolsFile,
+			DefaultText: "tools.yaml",
+			Sources:     cli.EnvVars("TOOLS_FILE"),
+		},
+		&cli.DurationFlag{
+			Name:        "tools-reload-interval",
+			Value:       5 * time.Second,
+			Usage:       "how often the tools file is checked for changes, 0 disables reloading",
+			Destination: &f.toolsReload,
+			DefaultText: "5s",
+			Sources:     cli.EnvVars("TOOLS_RELOAD_INTERVAL"),
+		},
+		&cli.DurationFlag{
+			Name:        "tool-timeout",
+			Value:       30 * time.Second,
+			Usage:       "how long a tool may run, unless the tools file limits it, 0 for no limit",
+			Destination: &f.toolTimeout,
+			DefaultText: "30s",
+			Sources:     cli.EnvVars("TOOL_TIMEOUT"),
+		},
+		&cli.IntFlag{
+			Name:        "tool-max-output",
+			Value:       16 * 1024,
+			Usage:       "bytes of tool output kept for the llm, the rest is truncated",
+			Destination: &f.toolMaxOutput,
+			DefaultText: "16384",
+			Sources:     cli.EnvVars("TOOL_MAX_OUTPUT"),
+		},
+		&cli.IntFlag{
+			Name:        "tool-concurrency",
+			Value:       8,
+			Usage:       "tools running at once, 0 is unbounded",
+			Destination: &f.toolConcurrency,
+			DefaultText: "8",
+			Sources:     cli.EnvVars("TOOL_CONCURRENCY"),
+		},
+		&cli.StringFlag{
+			Name:        "conversation-store",
+			Value:       "memory",
+			Destination: &f.conversationStore,
+			DefaultText: "memory",
+			Sources:     cli.EnvVars("CONVERSATION_STORE"),
+		},
+		&cli.IntFlag{
+			Name:        "history-tokens",
+			Value:       2048,
+			Destination: &f.historyTokens,
+			DefaultText: "2048",
+			Sources:     cli.EnvVars("HISTORY_TOKENS"),
+		},
+		&cli.IntFlag{
+			Name:        "agent-max-steps",
+			Value:       3,
+			Destination: &f.agentMaxSteps,
+			DefaultText: "3",
+			Sources:     cli.EnvVars("AGENT_MAX_STEPS"),
+		},
+		&cli.IntFlag{
+			Name:        "chunk-tokens",
+			Value:       256,
+			Destination: &f.chunkTokens,
+			DefaultText: "256",
+			Sources:     cli.EnvVars("CHUNK_TOKENS"),
+		},
+		&cli.IntFlag{
+			Name:        "overlap-tokens",
+			Value:       32,
+			Destination: &f.overlapTokens,
+			DefaultText: "32",
+			Sources:     cli.EnvVars("OVERLAP_TOKENS"),
+		},
+		&cli.FloatFlag{
+			Name:        "rag-lexical-weight",
+			Value:       0.5,
+			Usage:       "share of BM25 in the rag ranking, 0 disables lexical search",
+			Destination: &f.ragLexicalWeight,
+			DefaultText: "0.5",
+			Sources:     cli.EnvVars("RAG_LEXICAL_WEIGHT"),
+		},
+		&cli.IntFlag{
+			Name:        "rag-rrf-k",
+			Value:       60,
+			Usage:       "reciprocal rank fusion constant, higher values flatten the ranks",
+			Destination: &f.ragRrfK,
+			DefaultText: "60",
+			Sources:     cli.EnvVars("RAG_RRF_K"),
+		},
+		&cli.DurationFlag{
+			Name:        "cache-ttl-llm",
+			Value:       7 * 24 * time.Hour,
+			Usage:       "ttl of cached answers from the llm alone, 0 never expires",
+			Destination: &f.cacheTtlLlm,
+			DefaultText: "168h",
+			Sources:     cli.EnvVars("CACHE_TTL_LLM"),
+		},
+		&cli.DurationFlag{
+			Name:        "cache-ttl-rag",
+			Value:       24 * time.Hour,
+			Usage:       "ttl of cached answers built from rag facts",
+			Destination: &f.cacheTtlRag,
+			DefaultText: "24h",
+			Sources:     cli.EnvVars("CACHE_TTL_RAG"),
+		},
+		&cli.DurationFlag{
+			Name:        "cache-ttl-tool",
+			Value:       5 * time.Minute,
+			Usage:       "ttl of cached answers built from tool output, see cache-tool-answers",
+			Destination: &f.cacheTtlTool,
+			DefaultText: "5m",
+			Sources:     cli.EnvVars("CACHE_TTL_TOOL"),
+		},
+		&cli.IntFlag{
+			Name:        "cache-max-entries",
+			Value:       1000,
+			Usage:       "least recently hit entries are evicted past it, 0 is unbounded",
+			Destination: &f.cacheMaxEntries,
+			DefaultText: "1000",
+			Sources:     cli.EnvVars("CACHE_MAX_ENTRIES"),
+		},
+		&cli.DurationFlag{
+			Name:        "cache-janitor-interval",
+			Value:       time.Minute,
+			Destination: &f.cacheJanitorInterval,
+			DefaultText: "1m",
+			Sources:     cli.EnvVars("CACHE_JANITOR_INTERVAL"),
+		},
+		&cli.BoolFlag{
+			Name:        "cache-tool-answers",
+			Usage:       "caches answers built from tool output, with the tool ttl",
+			Destination: &f.cacheToolAnswers,
+			DefaultText: "false",
+			Sources:     cli.EnvVars("CACHE_TOOL_ANSWERS"),
+		},
 		&cli.StringFlag{
 			Name:        "llm-ep",
 			Value:       "localhost:11434",
@@ -140,5 +382,59 @@ func (f *flags) build() []cli.Flag {
 			DefaultText: "localhost:11434",
 			Sources:     cli.EnvVars("LLM_ENDPOINT"),
 		},
+		&cli.StringFlag{
+			Name:        "llm-provider",
+			Value:       "ollama",
+			Destination: &f.llmProvider,
+			DefaultText: "ollama",
+			Sources:     cli.EnvVars("LLM_PROVIDER"),
+		},
+		&cli.StringFlag{
+			Name:        "llm-api-key",
+			Value:       "",
+			Destination: &f.llmApiKey,
+			DefaultText: "",
+			Sources:     cli.EnvVars("LLM_API_KEY"),
+		},
+		&cli.FloatFlag{
+			Name:        "rate-limit",
+			Value:       1,
+			Usage:       "generations per second each api key, or address without auth, may request, 0 disables the limit",
+			Destination: &f.rateLimit,
+			DefaultText: "1",
+			Sources:     cli.EnvVars("RATE_LIMIT"),
+		},
+		&cli.IntFlag{
+			Name:        "rate-burst",
+			Value:       10,
+			Usage:       "generations a client may request at once, over the rate limit",
+			Destination: &f.rateBurst,
+			DefaultText: "10",
+			Sources:     cli.EnvVars("RATE_BURST"),
+		},
+		&cli.IntFlag{
+			Name:        "llm-concurrency",
+			Value:       4,
+			Usage:       "generations running at once, 0 is unbounded",
+			Destination: &f.llmConcurrency,
+			DefaultText: "4",
+			Sources:     cli.EnvVars("LLM_CONCURRENCY"),
+		},
+		&cli.IntFlag{
+			Name:        "llm-queue",
+			Value:       16,
+			Usage:       "generations waiting for a slot, more are rejected with 429",
+			Destination: &f.llmQueue,
+			DefaultText: "16",
+			Sources:     cli.EnvVars("LLM_QUEUE"),
+		},
+		&cli.DurationFlag{
+			Name:        "llm-queue-timeout",
+			Value:       30 * time.Second,
+			Usage:       "how long a generation waits for a slot before being rejected with 429",
+			Destination: &f.llmQueueTimeout,
+			DefaultText: "30s",
+			Sources:     cli.EnvVars("LLM_QUEUE_TIMEOUT"),
+		},
 	}
 }
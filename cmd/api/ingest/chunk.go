@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"strings"
+	"unicode"
+)
+
+type chunk struct {
+	heading string
+	text    string
+}
+
+// word is where a word starts and ends in the text being split.
+type word struct {
+	ini, end int
+}
+
+// words finds the words of text as strings.Fields does, but keeps where they
+// are, so chunks are slices of text keeping its line breaks and indentation.
+func words(text string) []word {
+	var ret []word
+
+	ini := -1
+
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r) && ini >= 0:
+			ret = append(ret, word{ini, i})
+			ini = -1
+		case !unicode.IsSpace(r) && ini < 0:
+			ini = i
+		}
+	}
+
+	if ini >= 0 {
+		ret = append(ret, word{ini, len(text)})
+	}
+
+	return ret
+}
+
+// splitTokens breaks text in windows of at most chunkTokens tokens, each one
+// repeating the last overlapTokens tokens of the previous window. Words are
+// never split, a single word larger than the window becomes its own chunk.
+// Chunks keep the whitespace between their words, so lists, tables and code
+// keep their layout.
+func (s *Service) splitTokens(text string, heading string) ([]chunk, error) {
+	words := words(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	prefix := 0
+	if heading != "" {
+		var err error
+
+		prefix, err = s.tokenizer.Count(heading)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	budget := max(s.chunkTokens-prefix, 1)
+
+	counts := make([]int, len(words))
+	known := map[string]int{}
+
+	for i, wd := range words {
+		w := text[wd.ini:wd.end]
+
+		n, ok := known[w]
+		if !ok {
+			var err error
+
+			n, err = s.tokenizer.Count(w)
+			if err != nil {
+				return nil, err
+			}
+
+			known[w] = n
+		}
+
+		counts[i] = n
+	}
+
+	var ret []chunk
+
+	for ini := 0; ini < len(words); {
+		end := ini
+		total := 0
+
+		for end < len(words) && (end == ini || total+counts[end] <= budget) {
+			total += counts[end]
+			end++
+		}
+
+		body := text[words[ini].ini:words[end-1].end]
+		if heading != "" {
+			body = heading + "\n" + body
+		}
+
+		ret = append(ret, chunk{heading: heading, text: body})
+
+		if end == len(words) {
+			break
+		}
+
+		next := end
+		overlap := 0
+
+		for next-1 > ini && overlap+counts[next-1] <= s.overlapTokens {
+			next--
+			overlap += counts[next]
+		}
+
+		ini = next
+	}
+
+	return ret, nil
+}
+
+// splitHeadings breaks markdown in its sections, prefixing every chunk with
+// the path of headings it belongs to. Sections larger than chunkTokens are
+// split further by tokens.
+func (s *Service) splitHeadings(text string) ([]chunk, error) {
+	var (
+		ret     []chunk
+		path    []string
+		section strings.Builder
+		fenced  bool
+	)
+
+	flush := func() error {
+		titles := make([]string, 0, len(path))
+		for _, title := range path {
+			if title != "" {
+				titles = append(titles, title)
+			}
+		}
+
+		chunks, err := s.splitTokens(section.String(), strings.Join(titles, " > "))
+		if err != nil {
+			return err
+		}
+
+		ret = append(ret, chunks...)
+		section.Reset()
+
+		return nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+
+		level, title, ok := markdownHeading(line)
+		if fenced || !ok {
+			section.WriteString(line + "\n")
+
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+
+		if level <= len(path) {
+			path = path[:level-1]
+		}
+
+		for len(path) < level-1 {
+			path = append(path, "")
+		}
+
+		path = append(path, title)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func markdownHeading(line string) (int, string, bool) {
+	trimmed := strings.TrimLeft(line, "#")
+	level := len(line) - len(trimmed)
+
+	if level == 0 || level > 6 || !strings.HasPrefix(trimmed, " ") {
+		return 0, "", false
+	}
+
+	return level, strings.TrimSpace(trimmed), true
+}
@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToText keeps the visible text of an html document. Headings become
+// markdown headings, so the headings strategy also works for html.
+func htmlToText(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+
+	var walk func(n *html.Node)
+
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Head, atom.Template:
+				return
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				level := int(n.Data[1] - '0')
+				sb.WriteString("\n" + strings.Repeat("#", level) + " ")
+			case atom.Br:
+				sb.WriteString("\n")
+			case atom.Li:
+				sb.WriteString("\n - ")
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if n.Type == html.ElementNode && isBlock(n.DataAtom) {
+			sb.WriteString("\n")
+		}
+	}
+
+	walk(doc)
+
+	lines := strings.Split(sb.String(), "\n")
+	kept := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+
+	return strings.Join(kept, "\n"), nil
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Nav,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Table, atom.Tr, atom.Pre, atom.Blockquote:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,242 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/tokenizer"
+)
+
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHtml     = "html"
+
+	StrategyTokens   = "tokens"
+	StrategyHeadings = "headings"
+
+	MetaSource     = "source"
+	MetaDocumentId = "document_id"
+	MetaChunkIndex = "chunk_index"
+	MetaHeading    = "heading"
+)
+
+var ErrEmptyDocument = errors.New("document has no content")
+
+// Document is a text to be split into chunks and stored in the rag. When ID is
+// empty it is derived from Source, so ingesting the same source again
+// replaces its previous chunks.
+type Document struct {
+	ID        string            `json:"id,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Format    string            `json:"format,omitempty" enum:"text,markdown,html"`
+	Strategy  string            `json:"strategy,omitempty" enum:"tokens,headings"`
+	Content   string            `json:"content"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+type Ingested struct {
+	DocumentId string `json:"document_id"`
+	Namespace  string `json:"namespace"`
+	Chunks     int    `json:"chunks"`
+}
+
+type Service struct {
+	rag       *rag.Service
+	tokenizer *tokenizer.Service
+	tracer    trace.Tracer
+
+	chunkTokens   int
+	overlapTokens int
+}
+
+type Option func(*Service)
+
+func WithRag(r *rag.Service) Option {
+	return func(s *Service) {
+		s.rag = r
+	}
+}
+
+func WithTokenizer(tk *tokenizer.Service) Option {
+	return func(s *Service) {
+		s.tokenizer = tk
+	}
+}
+
+func WithTracer(tracer trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+func WithChunkTokens(n int) Option {
+	return func(s *Service) {
+		s.chunkTokens = n
+	}
+}
+
+func WithOverlapTokens(n int) Option {
+	return func(s *Service) {
+		s.overlapTokens = n
+	}
+}
+
+// FormatFromFilename guesses the document format from its extension.
+func FormatFromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".html", ".htm":
+		return FormatHtml
+	default:
+		return FormatText
+	}
+}
+
+func DocumentId(source string) string {
+	sum := sha1.Sum([]byte(source))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) Ingest(ctx context.Context, doc Document) (ret Ingested, err error) {
+	ctx, span := s.tracer.Start(ctx, "ingest.Ingest", trace.WithAttributes(
+		attribute.String("source", doc.Source),
+		attribute.String("format", doc.Format),
+		attribute.String("strategy", doc.Strategy),
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if doc.ID == "" {
+		if doc.Source == "" {
+			return Ingested{}, errors.New("document needs an id or a source")
+		}
+
+		doc.ID = DocumentId(doc.Source)
+	}
+
+	text := doc.Content
+
+	switch doc.Format {
+	case FormatHtml:
+		text, err = htmlToText(text)
+		if err != nil {
+			return Ingested{}, err
+		}
+	case "", FormatText, FormatMarkdown:
+	default:
+		return Ingested{}, fmt.Errorf("unknown format: %s", doc.Format)
+	}
+
+	var chunks []chunk
+
+	switch doc.Strategy {
+	case "", StrategyTokens:
+		chunks, err = s.splitTokens(strings.TrimSpace(text), "")
+	case StrategyHeadings:
+		chunks, err = s.splitHeadings(text)
+	default:
+		return Ingested{}, fmt.Errorf("unknown strategy: %s", doc.Strategy)
+	}
+
+	if err != nil {
+		return Ingested{}, err
+	}
+
+	if len(chunks) == 0 {
+		return Ingested{}, ErrEmptyDocument
+	}
+
+	facts := make([]rag.Fact, 0, len(chunks))
+
+	for i, c := range chunks {
+		meta := maps.Clone(doc.Meta)
+		if meta == nil {
+			meta = map[string]string{}
+		}
+
+		meta[MetaSource] = doc.Source
+		meta[MetaDocumentId] = doc.ID
+		meta[MetaChunkIndex] = strconv.Itoa(i)
+
+		if c.heading != "" {
+			meta[MetaHeading] = c.heading
+		}
+
+		facts = append(facts, rag.Fact{Content: c.text, Meta: meta})
+	}
+
+	span.SetAttributes(attribute.String("document-id", doc.ID), attribute.Int("chunks", len(chunks)))
+
+	previous, err := s.rag.Facts(ctx, doc.Namespace, map[string]string{MetaDocumentId: doc.ID})
+	if err != nil {
+		return Ingested{}, err
+	}
+
+	// the previous chunks go only once the new ones are in, so a failed
+	// embedding leaves the document as it was
+	if err = s.rag.AddMany(ctx, doc.Namespace, facts); err != nil {
+		return Ingested{}, err
+	}
+
+	ids := make([]string, 0, len(previous))
+	for _, p := range previous {
+		ids = append(ids, p.ID)
+	}
+
+	if err = s.rag.Del(ctx, doc.Namespace, ids...); err != nil {
+		return Ingested{}, err
+	}
+
+	namespace := doc.Namespace
+	if namespace == "" {
+		namespace = rag.DefaultNamespace
+	}
+
+	return Ingested{DocumentId: doc.ID, Namespace: namespace, Chunks: len(chunks)}, nil
+}
+
+// Delete removes every chunk previously ingested for the document.
+func (s *Service) Delete(ctx context.Context, namespace string, id string) error {
+	return s.rag.DelWhere(ctx, namespace, map[string]string{MetaDocumentId: id})
+}
+
+func New(opts ...Option) (*Service, error) {
+	ret := &Service{
+		chunkTokens:   256,
+		overlapTokens: 32,
+	}
+
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	switch {
+	case ret.rag == nil:
+		return nil, errors.New("rag was not initialized")
+	case ret.tokenizer == nil:
+		return nil, errors.New("tokenizer was not initialized")
+	case ret.chunkTokens <= 0:
+		return nil, errors.New("chunk tokens must be positive")
+	case ret.overlapTokens < 0 || ret.overlapTokens >= ret.chunkTokens:
+		return nil, errors.New("overlap tokens must be between zero and chunk tokens")
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,299 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+const (
+	DefaultRate         = 1.0
+	DefaultBurst        = 10
+	DefaultConcurrency  = 4
+	DefaultQueue        = 16
+	DefaultQueueTimeout = 30 * time.Second
+)
+
+var (
+	ErrRateLimited  = errors.New("rate limit exceeded")
+	ErrQueueFull    = errors.New("too many queued generations")
+	ErrQueueTimeout = errors.New("timed out waiting for a generation slot")
+)
+
+// RejectedError is a request turned away, either by the rate limit of its
+// client or because the server is busy. RetryAfter is when trying again is
+// likely to succeed.
+type RejectedError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// sweepEvery is how often buckets idle long enough to be full again are
+// dropped, so one off clients don't pile up.
+const sweepEvery = time.Minute
+
+// bucket is the token bucket of a client. Tokens are refilled on use, from
+// the time elapsed since the last one.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Service rate limits each client with a token bucket and bounds how many
+// generations run at once. Requests over the bound wait in a queue, which is
+// bounded too.
+type Service struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	slots        chan struct{}
+	queue        int
+	queueTimeout time.Duration
+	waiting      atomic.Int64
+
+	holdMu  sync.Mutex
+	avgHold time.Duration
+
+	metricQueueDepth metric.Int64UpDownCounter
+	metricInFlight   metric.Int64UpDownCounter
+	metricRejected   metric.Int64Counter
+	metricQueueWait  metric.Float64Histogram
+}
+
+type Option func(*Service)
+
+// WithRate lets each client make rate requests per second, up to burst at
+// once. A rate of 0 disables the rate limit.
+func WithRate(rate float64, burst int) Option {
+	return func(service *Service) {
+		service.rate = rate
+		service.burst = max(burst, 1)
+	}
+}
+
+// WithConcurrency caps how many generations run at once, 0 is unbounded.
+func WithConcurrency(n int) Option {
+	return func(service *Service) {
+		service.slots = nil
+		if n > 0 {
+			service.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithQueue sets how many requests may wait for a generation slot, the
+// others are rejected at once.
+func WithQueue(n int) Option {
+	return func(service *Service) {
+		service.queue = max(n, 0)
+	}
+}
+
+// WithQueueTimeout sets how long a request waits for a generation slot.
+func WithQueueTimeout(d time.Duration) Option {
+	return func(service *Service) {
+		service.queueTimeout = d
+	}
+}
+
+func WithMetrics(meter metric.Meter) Option {
+	return func(s *Service) {
+		var err error
+
+		s.metricQueueDepth, err = meter.Int64UpDownCounter("llm_queue_depth")
+		if err != nil {
+			panic(err)
+		}
+
+		s.metricInFlight, err = meter.Int64UpDownCounter("llm_in_flight")
+		if err != nil {
+			panic(err)
+		}
+
+		s.metricRejected, err = meter.Int64Counter("llm_rejected")
+		if err != nil {
+			panic(err)
+		}
+
+		s.metricQueueWait, err = meter.Float64Histogram("llm_queue_wait_sec")
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func New(opts ...Option) *Service {
+	ret := &Service{
+		rate:         DefaultRate,
+		burst:        DefaultBurst,
+		buckets:      map[string]*bucket{},
+		slots:        make(chan struct{}, DefaultConcurrency),
+		queue:        DefaultQueue,
+		queueTimeout: DefaultQueueTimeout,
+	}
+
+	WithMetrics(noop.NewMeterProvider().Meter(""))(ret)
+
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	return ret
+}
+
+// allow takes a token from the bucket of client. When there is none it tells
+// how long until there is.
+func (s *Service) allow(client string, now time.Time) time.Duration {
+	if s.rate <= 0 {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(s.burst), last: now}
+		s.buckets[client] = b
+	}
+
+	b.tokens = min(float64(s.burst), b.tokens+now.Sub(b.last).Seconds()*s.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / s.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that refilled, they are the same as new ones. The
+// caller holds mu.
+func (s *Service) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepEvery {
+		return
+	}
+
+	s.lastSweep = now
+	full := time.Duration(float64(s.burst) / s.rate * float64(time.Second))
+
+	for client, b := range s.buckets {
+		if now.Sub(b.last) >= full {
+			delete(s.buckets, client)
+		}
+	}
+}
+
+// busyRetryAfter guesses when a slot frees up, from how long generations
+// have been taking and how many requests are ahead.
+func (s *Service) busyRetryAfter() time.Duration {
+	s.holdMu.Lock()
+	hold := s.avgHold
+	s.holdMu.Unlock()
+
+	ahead := s.waiting.Load() + 1
+
+	return max(time.Second, hold*time.Duration(ahead)/time.Duration(cap(s.slots)))
+}
+
+func (s *Service) reject(ctx context.Context, err error, retryAfter time.Duration) error {
+	reason := "rate"
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		reason = "queue_full"
+	case errors.Is(err, ErrQueueTimeout):
+		reason = "queue_timeout"
+	}
+
+	s.metricRejected.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+
+	return &RejectedError{Err: err, RetryAfter: retryAfter}
+}
+
+// held marks a slot taken. The release it returns frees it, once.
+func (s *Service) held(ctx context.Context) func() {
+	s.metricInFlight.Add(ctx, 1)
+	start := time.Now()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			<-s.slots
+			s.metricInFlight.Add(ctx, -1)
+
+			// moving average of the last ~10 generations
+			s.holdMu.Lock()
+			s.avgHold += (time.Since(start) - s.avgHold) / 10
+			s.holdMu.Unlock()
+		})
+	}
+}
+
+// Acquire admits a generation of client, waiting in the queue for a slot
+// when all are taken. Requests over the rate of their client, or finding the
+// queue full, fail at once with a RejectedError. The caller must call release
+// when the generation is done.
+func (s *Service) Acquire(ctx context.Context, client string) (release func(), err error) {
+	if wait := s.allow(client, time.Now()); wait > 0 {
+		return nil, s.reject(ctx, ErrRateLimited, wait)
+	}
+
+	if s.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return s.held(ctx), nil
+	default:
+	}
+
+	if s.waiting.Add(1) > int64(s.queue) {
+		s.waiting.Add(-1)
+		return nil, s.reject(ctx, ErrQueueFull, s.busyRetryAfter())
+	}
+
+	s.metricQueueDepth.Add(ctx, 1)
+	start := time.Now()
+
+	defer func() {
+		s.waiting.Add(-1)
+		s.metricQueueDepth.Add(ctx, -1)
+		s.metricQueueWait.Record(ctx, time.Since(start).Seconds())
+	}()
+
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return s.held(ctx), nil
+	case <-timer.C:
+		return nil, s.reject(ctx, ErrQueueTimeout, s.busyRetryAfter())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,228 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// step is a request of client at a time after t0, and how long it should
+	// wait for a token
+	type step struct {
+		client string
+		at     time.Duration
+		want   time.Duration
+	}
+
+	for _, tt := range []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{
+			name: "burst then refill", rate: 2, burst: 3,
+			steps: []step{
+				{"a", 0, 0},
+				{"a", 0, 0},
+				{"a", 0, 0},
+				{"a", 0, 500 * time.Millisecond},
+				{"a", 250 * time.Millisecond, 250 * time.Millisecond},
+				{"a", 500 * time.Millisecond, 0},
+				{"a", 500 * time.Millisecond, 500 * time.Millisecond},
+				// other clients have buckets of their own
+				{"b", 500 * time.Millisecond, 0},
+			},
+		},
+		{
+			name: "refill caps at burst", rate: 1, burst: 2,
+			steps: []step{
+				{"a", 0, 0},
+				{"a", 0, 0},
+				{"a", 10 * time.Second, 0},
+				{"a", 10 * time.Second, 0},
+				{"a", 10 * time.Second, time.Second},
+			},
+		},
+		{
+			name: "disabled", rate: 0, burst: 1,
+			steps: []step{
+				{"a", 0, 0},
+				{"a", 0, 0},
+				{"a", 0, 0},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(WithRate(tt.rate, tt.burst))
+
+			for i, step := range tt.steps {
+				if got := s.allow(step.client, t0.Add(step.at)); got != step.want {
+					t.Fatalf("step %d: %s at %s waits %s, want %s", i, step.client, step.at, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := New(WithRate(1, 2))
+
+	s.allow("a", t0)
+	s.allow("b", t0.Add(60*time.Second))
+	// a minute after the last sweep, a is full again and b is not
+	s.allow("c", t0.Add(61*time.Second))
+
+	var clients []string
+	for client := range s.buckets {
+		clients = append(clients, client)
+	}
+
+	slices.Sort(clients)
+
+	if !slices.Equal(clients, []string{"b", "c"}) {
+		t.Fatalf("buckets of %v, want [b c]", clients)
+	}
+}
+
+func TestBusyRetryAfter(t *testing.T) {
+	s := New(WithConcurrency(2))
+
+	if got := s.busyRetryAfter(); got != time.Second {
+		t.Fatalf("without history got %s, want the 1s floor", got)
+	}
+
+	s.avgHold = 10 * time.Second
+	s.waiting.Store(3)
+
+	// 4 generations ahead, counting this one, on 2 slots
+	if got := s.busyRetryAfter(); got != 20*time.Second {
+		t.Fatalf("got %s, want 20s", got)
+	}
+}
+
+// rejected fails unless err turns the request away for want, telling when to
+// retry.
+func rejected(t *testing.T, err error, want error) {
+	t.Helper()
+
+	var ret *RejectedError
+	if !errors.As(err, &ret) || !errors.Is(err, want) {
+		t.Fatalf("err = %v, want rejected with %v", err, want)
+	}
+
+	if ret.RetryAfter <= 0 {
+		t.Fatalf("retry after %s", ret.RetryAfter)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rate", func(t *testing.T) {
+		s := New(WithRate(1, 1))
+
+		release, err := s.Acquire(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		release()
+
+		_, err = s.Acquire(ctx, "a")
+		rejected(t, err, ErrRateLimited)
+
+		if _, err = s.Acquire(ctx, "b"); err != nil {
+			t.Fatalf("other client: %v", err)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		s := New(WithRate(0, 1), WithConcurrency(1), WithQueue(0))
+
+		release, err := s.Acquire(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Acquire(ctx, "b")
+		rejected(t, err, ErrQueueFull)
+
+		// releasing twice frees a single slot
+		release()
+		release()
+
+		if _, err = s.Acquire(ctx, "b"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Acquire(ctx, "c")
+		rejected(t, err, ErrQueueFull)
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		s := New(WithRate(0, 1), WithConcurrency(1), WithQueue(1), WithQueueTimeout(20*time.Millisecond))
+
+		if _, err := s.Acquire(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.Acquire(ctx, "b")
+		rejected(t, err, ErrQueueTimeout)
+
+		if n := s.waiting.Load(); n != 0 {
+			t.Fatalf("%d still waiting", n)
+		}
+	})
+
+	t.Run("queued until released", func(t *testing.T) {
+		s := New(WithRate(0, 1), WithConcurrency(1), WithQueue(1), WithQueueTimeout(5*time.Second))
+
+		release, err := s.Acquire(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error)
+
+		go func() {
+			_, err := s.Acquire(ctx, "b")
+			done <- err
+		}()
+
+		for s.waiting.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the queue holds one
+		_, err = s.Acquire(ctx, "c")
+		rejected(t, err, ErrQueueFull)
+
+		release()
+
+		if err = <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("canceled while queued", func(t *testing.T) {
+		s := New(WithRate(0, 1), WithConcurrency(1), WithQueue(1))
+
+		if _, err := s.Acquire(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		if _, err := s.Acquire(cctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want the context error", err)
+		}
+	})
+}
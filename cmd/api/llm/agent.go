@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/provider"
+)
+
+const TypeTool = "TOOL"
+
+// Step is a single tool execution requested by the llm while answering.
+type Step struct {
+	Tool     string            `json:"tool"`
+	Params   map[string]string `json:"params,omitempty"`
+	Result   string            `json:"result,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration"`
+}
+
+// finalPrompt closes the agent loop once the step limit is reached.
+const finalPrompt = "O limite de TOOLs foi atingido, não peça outro TOOL. " +
+	"Responda agora com type FINAL, usando apenas os dados do contexto."
+
+// typeField finds the type of a response while it is still being generated.
+var typeField = regexp.MustCompile(`"type"\s*:\s*"([A-Z]+)"`)
+
+// finalStream relays to fn the chunks of a step that turns out not to be a
+// tool request. Chunks are held until the type of the response is known, so
+// clients never see the tool requests of intermediate steps.
+type finalStream struct {
+	fn      StreamFunc
+	buf     strings.Builder
+	decided bool
+	relay   bool
+}
+
+func (f *finalStream) write(chunk string) error {
+	if f.decided {
+		if f.relay {
+			return f.fn(chunk)
+		}
+
+		return nil
+	}
+
+	f.buf.WriteString(chunk)
+	held := f.buf.String()
+
+	switch trimmed := strings.TrimSpace(held); {
+	case trimmed == "":
+		return nil
+	case trimmed[0] != '{' && trimmed[0] != '`':
+		// not json, so not a tool request either
+		f.decided, f.relay = true, true
+	default:
+		m := typeField.FindStringSubmatch(held)
+		if m == nil {
+			return nil
+		}
+
+		f.decided, f.relay = true, m[1] != TypeTool
+	}
+
+	if f.relay {
+		return f.fn(held)
+	}
+
+	return nil
+}
+
+// finish relays the answer of a final step whose type could not be told while
+// streaming, as when the llm had to repair its json.
+func (f *finalStream) finish(ret Response) error {
+	if f.decided || ret.Type == TypeTool {
+		return nil
+	}
+
+	return f.fn(ret.Response)
+}
+
+// step asks the llm for the next response, complying with format. Only final
+// responses are streamed to fn.
+func (s *Service) step(ctx context.Context, span trace.Span, messages []provider.Message, format json.RawMessage, fn StreamFunc) (ret Response, generated string, err error) {
+	var stream *finalStream
+	var chunkFn StreamFunc
+
+	if fn != nil {
+		stream = &finalStream{fn: fn}
+		chunkFn = stream.write
+	}
+
+	generated, err = s.chat(ctx, messages, format, chunkFn)
+	if err != nil {
+		return Response{}, "", err
+	}
+
+	ret, err = s.parse(ctx, span, messages, format, generated)
+	if err != nil {
+		return Response{}, "", err
+	}
+
+	if stream != nil {
+		if err = stream.finish(ret); err != nil {
+			return Response{}, "", err
+		}
+	}
+
+	return ret, generated, nil
+}
+
+// finalStep asks the llm for an answer without tool requests, closing the
+// agent loop.
+func (s *Service) finalStep(ctx context.Context, span trace.Span, messages []provider.Message, fn StreamFunc) (Response, error) {
+	messages = append(messages[:len(messages):len(messages)], provider.Message{Role: provider.RoleUser, Content: finalPrompt})
+
+	ret, _, err := s.step(ctx, span, messages, finalSchema, fn)
+	if err != nil {
+		return Response{}, err
+	}
+
+	// the schema forbids it, but not every provider enforces schemas
+	if ret.Type == TypeTool {
+		ret.Type = "FINAL"
+	}
+
+	return ret, nil
+}
+
+// runAgent asks the llm for an answer and, while it replies with a TOOL
+// response, runs the requested tool and feeds its result back. After
+// maxAgentSteps tools the llm is asked for a last answer, no longer allowed to
+// request tools.
+func (s *Service) runAgent(octx context.Context, q string, messages []provider.Message, fn StreamFunc) (ret Response, err error) {
+	ctx, span := s.tracer.Start(octx, "llm.runAgent")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	var steps []Step
+
+	for i := 0; ; i++ {
+		if i >= s.maxAgentSteps {
+			span.AddEvent("step limit reached", trace.WithAttributes(attribute.Int("steps", i)))
+
+			if ret, err = s.finalStep(ctx, span, messages, fn); err != nil {
+				return Response{}, err
+			}
+
+			break
+		}
+
+		var generated string
+
+		ret, generated, err = s.step(ctx, span, messages, responseSchema, fn)
+		if err != nil {
+			return Response{}, err
+		}
+
+		if ret.Type != TypeTool {
+			break
+		}
+
+		if ret.Tool == "" {
+			span.AddEvent("tool request without tool")
+
+			if ret, err = s.finalStep(ctx, span, messages, fn); err != nil {
+				return Response{}, err
+			}
+
+			break
+		}
+
+		step := s.runStep(ctx, i, ret.Tool, ret.Params)
+		steps = append(steps, step)
+
+		messages = append(messages,
+			provider.Message{Role: provider.RoleAssistant, Content: generated},
+			provider.Message{Role: provider.RoleUser, Content: stepPrompt(step, q)},
+		)
+	}
+
+	span.SetAttributes(attribute.Int("steps", len(steps)))
+
+	ret.Steps = steps
+
+	return ret, nil
+}
+
+func (s *Service) runStep(octx context.Context, i int, tool string, params map[string]string) (ret Step) {
+	ctx, span := s.tracer.Start(octx, "llm.agentStep", trace.WithAttributes(
+		attribute.Int("step", i),
+		attribute.String("tool", tool),
+	))
+	defer span.End()
+
+	toolParams := make(map[string]string, len(params))
+	for k, v := range params {
+		toolParams[strings.ToLower(k)] = v
+	}
+
+	ret = Step{Tool: tool, Params: params}
+
+	start := time.Now()
+	result, err := s.tool.Query(ctx, tool, toolParams)
+	ret.Duration = time.Since(start).String()
+
+	if err != nil {
+		span.RecordError(err)
+		s.logger.Warn("Agent step failed", "tool", tool, "err", err)
+
+		ret.Error = err.Error()
+
+		return ret
+	}
+
+	ret.Result = result
+
+	return ret
+}
+
+func stepPrompt(step Step, q string) string {
+	sb := strings.Builder{}
+
+	switch {
+	case step.Error != "":
+		sb.WriteString(fmt.Sprintf("O TOOL %s falhou com o erro: %s\n", step.Tool, step.Error))
+	default:
+		sb.WriteString(fmt.Sprintf("Seu contexto contem dados do TOOL %s:\n - %s\n", step.Tool, step.Result))
+	}
+
+	sb.WriteString("Agora responda: " + q)
+
+	return sb.String()
+}
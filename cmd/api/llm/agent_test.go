@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gophercon-2025/cmd/api/provider"
+	"gophercon-2025/cmd/api/tool"
+)
+
+const (
+	toolDate     = `{"type": "TOOL", "tool": "date", "confidence": 0.9}`
+	toolHostname = `{"type": "TOOL", "tool": "hostname", "confidence": 0.9}`
+	finalDate    = `{"type": "FINAL", "response": "hoje e sexta", "confidence": 0.9}`
+)
+
+func lastMessage(req provider.ChatRequest) string {
+	return req.Messages[len(req.Messages)-1].Content
+}
+
+func TestAgentLoop(t *testing.T) {
+	ctx := context.Background()
+	q := "Que dia e hoje?"
+
+	t.Run("tool then final", func(t *testing.T) {
+		fake := provider.NewFake(toolDate, finalDate)
+		s := newTestService(t, fake, nil)
+
+		ret, err := s.Query(ctx, Request{Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret.Response != "hoje e sexta" || len(ret.Steps) != 1 || ret.Steps[0].Result == "" {
+			t.Fatalf("unexpected answer: %+v", ret)
+		}
+
+		if got := lastMessage(fake.Calls()[1]); !strings.Contains(got, "dados do TOOL date") {
+			t.Fatalf("tool result not fed back: %q", got)
+		}
+	})
+
+	t.Run("step limit", func(t *testing.T) {
+		// the last one ignores the final schema, as some providers do
+		fake := provider.NewFake(toolDate, toolDate, toolDate)
+		s := newTestService(t, fake, nil, WithMaxAgentSteps(2))
+
+		ret, err := s.Query(ctx, Request{Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret.Type != "FINAL" || len(ret.Steps) != 2 {
+			t.Fatalf("got %s after %d steps, want FINAL after 2", ret.Type, len(ret.Steps))
+		}
+
+		calls := fake.Calls()
+		if len(calls) != 3 {
+			t.Fatalf("llm called %d times, want 3", len(calls))
+		}
+
+		if string(calls[2].Format) != string(finalSchema) || lastMessage(calls[2]) != finalPrompt {
+			t.Fatal("last call does not forbid tools")
+		}
+	})
+
+	t.Run("tool request without tool", func(t *testing.T) {
+		fake := provider.NewFake(`{"type": "TOOL", "confidence": 0.9}`, finalDate)
+		s := newTestService(t, fake, nil)
+
+		ret, err := s.Query(ctx, Request{Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret.Response != "hoje e sexta" || len(ret.Steps) != 0 {
+			t.Fatalf("unexpected answer: %+v", ret)
+		}
+
+		if lastMessage(fake.Calls()[1]) != finalPrompt {
+			t.Fatal("tool request without tool did not end the loop")
+		}
+	})
+
+	t.Run("stream only the final step", func(t *testing.T) {
+		fake := provider.NewFake(toolDate, finalDate)
+		s := newTestService(t, fake, nil)
+
+		var streamed strings.Builder
+
+		if _, _, err := s.QueryStream(ctx, Request{Query: q}, func(chunk string) error {
+			streamed.WriteString(chunk)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if streamed.String() != finalDate {
+			t.Fatalf("streamed %q, want the final step only", streamed.String())
+		}
+	})
+}
+
+func TestAgentToolPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+
+	err := os.WriteFile(path, []byte(`
+policies:
+  default:
+    deny: [ifconfig]
+  namespaces:
+    publico:
+      allow: [date]
+  keys:
+    key-1:
+      deny: [date]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		script     string
+		namespaces []string
+		keyID      string
+		denied     bool
+	}{
+		{name: "allowed", script: toolHostname},
+		{name: "denied by default", script: `{"type": "TOOL", "tool": "ifconfig"}`, denied: true},
+		{name: "allowed in namespace", script: toolDate, namespaces: []string{"publico"}},
+		{name: "denied in namespace", script: toolHostname, namespaces: []string{"publico"}, denied: true},
+		{name: "denied for key", script: toolDate, namespaces: []string{"publico"}, keyID: "key-1", denied: true},
+		{name: "allowed for other key", script: toolDate, namespaces: []string{"publico"}, keyID: "key-2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := provider.NewFake(tt.script)
+			s := newTestService(t, fake, nil, WithTool(tool.New(tool.WithTracer(testTracer), tool.WithConfig(path))))
+
+			ctx := tool.WithScope(context.Background(), tool.Scope{KeyID: tt.keyID})
+
+			if err := s.rag.CreateNamespace(ctx, "publico"); err != nil {
+				t.Fatal(err)
+			}
+
+			ret, err := s.Query(ctx, Request{Query: "Qual o nome desta maquina?", Namespaces: tt.namespaces})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ret.Steps) != 1 {
+				t.Fatalf("%d steps, want 1", len(ret.Steps))
+			}
+
+			step := ret.Steps[0]
+
+			if denied := strings.Contains(step.Error, tool.ErrDenied.Error()); denied != tt.denied {
+				t.Fatalf("denied = %v, want %v: %+v", denied, tt.denied, step)
+			}
+
+			if !tt.denied && step.Result == "" {
+				t.Fatalf("allowed tool returned nothing: %+v", step)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/conversation"
+)
+
+// Converse answers req in the context of the conversation identified by id and
+// appends both the question and the answer to its history. Answers depend on
+// the history, so the cache is neither checked nor fed regardless of UseCache.
+func (s *Service) Converse(ctx context.Context, id string, req Request, fn StreamFunc) (ret Response, tokens Tokens, err error) {
+	ctx, span := s.tracer.Start(ctx, "llm.Converse", trace.WithAttributes(attribute.String("conversation", id)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	conv, err := s.conversation.Get(ctx, id)
+	if err != nil {
+		return Response{}, Tokens{}, err
+	}
+
+	history, err := s.truncateHistory(conv.Messages)
+	if err != nil {
+		return Response{}, Tokens{}, err
+	}
+
+	span.SetAttributes(
+		attribute.Int("history-total", len(conv.Messages)),
+		attribute.Int("history-used", len(history)),
+	)
+
+	ret, tokens, err = s.query(ctx, req, history, fn)
+	if err != nil {
+		return Response{}, Tokens{}, err
+	}
+
+	if err = s.conversation.Append(ctx, id,
+		conversation.Message{Role: conversation.RoleUser, Content: req.Query, Tokens: tokens.In},
+		conversation.Message{Role: conversation.RoleAssistant, Content: ret.Response, Tokens: tokens.Out},
+	); err != nil {
+		return Response{}, Tokens{}, err
+	}
+
+	return ret, tokens, nil
+}
+
+// truncateHistory keeps the most recent messages that fit in historyTokens.
+// A budget of zero or less keeps the whole history.
+func (s *Service) truncateHistory(msgs []conversation.Message) ([]conversation.Message, error) {
+	if s.historyTokens <= 0 {
+		return msgs, nil
+	}
+
+	budget := s.historyTokens
+	first := len(msgs)
+
+	for i := len(msgs) - 1; i >= 0; i-- {
+		tokens := msgs[i].Tokens
+		if tokens == 0 {
+			var err error
+
+			tokens, err = s.tokenizer.Count(msgs[i].Content)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if tokens > budget {
+			break
+		}
+
+		budget -= tokens
+		first = i
+	}
+
+	return msgs[first:], nil
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
-	ollama_api "github.com/ollama/ollama/api"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
 	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/provider"
 	"gophercon-2025/cmd/api/rag"
 	"gophercon-2025/cmd/api/tokenizer"
 	"gophercon-2025/cmd/api/tool"
@@ -27,6 +31,9 @@ type Response struct {
 	Tool       string            `json:"tool"`
 	Params     map[string]string `json:"params"`
 	Confidence float64           `json:"confidence"`
+	Steps      []Step            `json:"steps,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Provenance Provenance        `json:"provenance"`
 }
 
 func cleanJson(s string) string {
@@ -50,64 +57,123 @@ func loadFromJson(s string) (Response, error) {
 type Service struct {
 	rag                *rag.Service
 	cache              *cache.Service
+	conversation       *conversation.Service
 	tokenizer          *tokenizer.Service
 	tool               *tool.Service
-	ollama             *ollama_api.Client
+	provider           provider.Provider
 	logger             *slog.Logger
 	tracer             trace.Tracer
 	llmModel           string
 	minConfidenceRag   float64
 	minConfidenceTool  float64
 	minConfidenceCache float64
+	minScoreLexical    float64
 	temperature        float64
+	historyTokens      int
+	maxAgentSteps      int
+	cacheToolAnswers   bool
 
 	metricTokensInLlm    metric.Int64Counter
 	metricTokensOutLlm   metric.Int64Counter
 	metricTokensInCache  metric.Int64Counter
 	metricTokensOutCache metric.Int64Counter
 	metricCantAnswer     metric.Int64Counter
+	metricParse          metric.Int64Counter
+	metricCacheSkipped   metric.Int64Counter
 }
 
-func (s *Service) Query(ctx context.Context, q string, useCache bool) (ret Response, err error) {
+// Tokens holds the token counts recorded for a single answer and whether it
+// came from the llm or from the cache.
+type Tokens struct {
+	Source string `json:"source"`
+	In     int    `json:"in"`
+	Out    int    `json:"out"`
+}
+
+// StreamFunc receives each partial chunk generated by the llm.
+type StreamFunc func(chunk string) error
+
+// Request is a single question to be answered. Namespaces are the RAG
+// namespaces searched for context, the default one when empty. History holds
+// the previous turns when the caller keeps the conversation itself, answers
+// then depend on it and the cache is neither checked nor fed.
+type Request struct {
+	Query      string
+	UseCache   bool
+	Namespaces []string
+	History    []conversation.Message
+}
+
+func (s *Service) Query(ctx context.Context, req Request) (ret Response, err error) {
 	ctx, span := s.tracer.Start(ctx, "llm.Query")
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
+	ret, _, err = s.answer(ctx, span, req, nil)
+
+	return ret, err
+}
+
+// QueryStream works as Query, but relays every chunk generated by the llm to fn
+// before returning the parsed response. Cached answers are relayed as a single
+// chunk.
+func (s *Service) QueryStream(ctx context.Context, req Request, fn StreamFunc) (ret Response, tokens Tokens, err error) {
+	ctx, span := s.tracer.Start(ctx, "llm.QueryStream")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return s.answer(ctx, span, req, fn)
+}
+
+func (s *Service) answer(ctx context.Context, span trace.Span, req Request, fn StreamFunc) (ret Response, tokens Tokens, err error) {
+	q := req.Query
+	cacheScope := cacheNamespaces(req.Namespaces)
+	useCache := req.UseCache && len(req.History) == 0
+
 	if useCache {
-		response, err := s.checkCache(ctx, q)
+		response, err := s.checkCache(ctx, q, cacheScope)
 		if err != nil {
-			return Response{}, err
+			return Response{}, Tokens{}, err
 		}
 
 		if response != "" {
-			if err = s.addCacheMetrics(ctx, span, q, response); err != nil {
-				return Response{}, err
+			if fn != nil {
+				if err = fn(response); err != nil {
+					return Response{}, Tokens{}, err
+				}
+			}
+
+			tokens, err = s.addCacheMetrics(ctx, span, q, response)
+			if err != nil {
+				return Response{}, Tokens{}, err
 			}
 
 			return Response{
 				Type:     "FINAL",
 				Response: response,
-			}, nil
+			}, tokens, nil
 		}
 	}
 
-	ret, err = s.query(ctx, q)
+	ret, tokens, err = s.query(ctx, req, req.History, fn)
 	if err != nil {
-		return Response{}, err
+		return Response{}, Tokens{}, err
 	}
 
 	switch {
 	case strings.HasSuffix(ret.Response, "\nRAG"):
 		s.metricCantAnswer.Add(ctx, 1)
 	case useCache && ret.Confidence > s.minConfidenceCache:
-		if err = s.cache.Add(ctx, q, ret.Response, ""); err != nil {
-			return Response{}, err
+		if err = s.addCache(ctx, span, q, cacheScope, ret); err != nil {
+			return Response{}, Tokens{}, err
 		}
 	}
 
-	return ret, nil
+	return ret, tokens, nil
 }
 
 func New(options ...Option) *Service {
@@ -123,17 +189,21 @@ func New(options ...Option) *Service {
 //go:embed system.txt
 var system string
 
-func (s *Service) query(octx context.Context, q string) (Response, error) {
+func (s *Service) query(octx context.Context, req Request, history []conversation.Message, fn StreamFunc) (Response, Tokens, error) {
 	ctx, span := s.tracer.Start(octx, "llm.query")
 	defer func() {
 		span.End()
 	}()
 
-	s.logger.Debug("Querying RAG", "query", q)
+	q := req.Query
+
+	ctx = tool.WithScope(ctx, toolScope(ctx, req.Namespaces))
+
+	s.logger.Debug("Querying RAG", "query", q, "namespaces", req.Namespaces)
 
-	ragResSet, err := s.rag.Query(ctx, q)
+	ragResSet, err := s.rag.QueryScored(ctx, q, rag.Filter{Namespaces: req.Namespaces})
 	if err != nil {
-		return Response{}, err
+		return Response{}, Tokens{}, err
 	}
 
 	sb := strings.Builder{}
@@ -144,21 +214,35 @@ func (s *Service) query(octx context.Context, q string) (Response, error) {
 
 	span.AddEvent("rag returned", trace.WithAttributes(attribute.Int("results", len(ragResSet))))
 
+	var prov Provenance
+
 	for _, ragRes := range ragResSet {
 		switch {
 		case ragRes.Similarity > float32(s.minConfidenceTool) && ragRes.Metadata != nil && ragRes.Metadata["type"] == "TOOL":
 			ret, err := s.queryTool(ctx, q, ragRes.Metadata["name"])
+			if errors.Is(err, tool.ErrDenied) || errors.Is(err, tool.ErrUnknownTool) {
+				s.logger.Debug("RAG: tool skipped", "query", q, "tool", ragRes.Metadata["name"], "err", err)
+
+				continue
+			}
+
 			if err != nil {
-				return Response{}, err
+				return Response{}, Tokens{}, err
 			}
 
 			sb.WriteString(" - " + ret + "\n")
 
+			prov.addTool(ragRes.Metadata["name"])
+
 			continue
 
-		case ragRes.Similarity > float32(s.minConfidenceRag):
+		case ragRes.Similarity > float32(s.minConfidenceRag),
+			s.minScoreLexical > 0 && ragRes.Scores.Lexical > s.minScoreLexical && ragRes.Metadata["type"] != "TOOL":
 			prepareHeaderFunc()
-			s.logger.Debug("RAG: add responses", "query", q, "content", ragRes.Content, "similarity", ragRes.Similarity)
+
+			prov.Facts = append(prov.Facts, FactRef{ID: ragRes.ID, Namespace: ragRes.Namespace, Similarity: ragRes.Similarity, Lexical: ragRes.Scores.Lexical})
+
+			s.logger.Debug("RAG: add responses", "query", q, "content", ragRes.Content, "similarity", ragRes.Similarity, "lexical", ragRes.Scores.Lexical)
 			sb.WriteString(" - " + ragRes.Content + "\n")
 		}
 	}
@@ -170,98 +254,158 @@ func (s *Service) query(octx context.Context, q string) (Response, error) {
 		sb.WriteString(q)
 	}
 
-	ollamaReq := &ollama_api.GenerateRequest{
-		Model:  s.llmModel,
-		Prompt: sb.String(),
-		System: system,
-		Stream: new(bool),
-		Options: map[string]any{
-			"temperature": s.temperature,
-		},
+	messages := make([]provider.Message, 0, len(history)+2)
+	messages = append(messages, provider.Message{Role: provider.RoleSystem, Content: system})
+
+	for _, msg := range history {
+		messages = append(messages, provider.Message{Role: msg.Role, Content: msg.Content})
 	}
 
-	var ret Response
+	messages = append(messages, provider.Message{Role: provider.RoleUser, Content: sb.String()})
 
-	respFunc := func(resp ollama_api.GenerateResponse) error {
-		svcResp, err := loadFromJson(resp.Response)
-		if err != nil {
-			return err
-		}
+	span.SetAttributes(attribute.Int("history", len(history)))
 
-		ret = svcResp
+	s.logger.Debug("Generating LLM response", "query", q, "stream", fn != nil)
 
-		return nil
+	ret, err := s.runAgent(ctx, q, messages, fn)
+	if err != nil {
+		return Response{}, Tokens{}, err
 	}
 
-	s.logger.Debug("Generating LLM response", "query", q)
-
-	if err = s.ollama.Generate(ctx, ollamaReq, respFunc); err != nil {
-		return Response{}, err
+	for _, step := range ret.Steps {
+		prov.addTool(step.Tool)
 	}
 
-	if err := s.addLlmMetrics(ctx, span, q, ret.Response); err != nil {
-		return Response{}, err
+	ret.Provenance = prov
+	ret.Source = prov.source()
+
+	span.SetAttributes(
+		attribute.Int("provenance-facts", len(prov.Facts)),
+		attribute.StringSlice("provenance-tools", prov.Tools),
+	)
+
+	tokens, err := s.addLlmMetrics(ctx, span, q, ret.Response)
+	if err != nil {
+		return Response{}, Tokens{}, err
 	}
 
-	return ret, nil
+	return ret, tokens, nil
+}
+
+func (s *Service) chat(ctx context.Context, messages []provider.Message, format json.RawMessage, fn StreamFunc) (string, error) {
+	return s.provider.Chat(ctx, provider.ChatRequest{
+		Model:       s.llmModel,
+		Messages:    messages,
+		Temperature: s.temperature,
+		Format:      format,
+	}, provider.StreamFunc(fn))
 }
 
 //go:embed llm_tool_prompt.txt
-var llmToolPrompt string
+var llmToolPromptText string
+
+var llmToolPrompt = template.Must(template.New("tool").Parse(llmToolPromptText))
+
+// toolPrompt asks the llm to extract from q the params declared by the tool
+// schema.
+func toolPrompt(desc tool.Descriptor, q string) (string, error) {
+	sb := strings.Builder{}
+
+	err := llmToolPrompt.Execute(&sb, map[string]any{
+		"Now":         time.Now().String(),
+		"Name":        desc.Name,
+		"Description": desc.Description,
+		"Params":      tool.Properties(desc.Schema),
+		"Query":       q,
+	})
+
+	return sb.String(), err
+}
 
-func (s *Service) queryTool(octx context.Context, q string, tool string) (ret string, err error) {
-	ctx, span := s.tracer.Start(octx, "llm.queryTool", trace.WithAttributes(attribute.String("q", q)))
+func (s *Service) queryTool(octx context.Context, q string, name string) (ret string, err error) {
+	ctx, span := s.tracer.Start(octx, "llm.queryTool", trace.WithAttributes(
+		attribute.String("q", q),
+		attribute.String("tool", name),
+	))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	sb := strings.Builder{}
-	sb.WriteString(fmt.Sprintf("Considere que a data de hoje é: %s\n", time.Now().String()))
-	sb.WriteString(llmToolPrompt)
-	sb.WriteString(q)
-
-	ollamaReq := &ollama_api.GenerateRequest{
-		Model:  s.llmModel,
-		Prompt: sb.String(),
-		Stream: new(bool),
-		Options: map[string]any{
-			"temperature": 0.0,
-		},
+	if err = s.tool.Check(ctx, name); err != nil {
+		return "", err
 	}
 
-	respFunc := func(resp ollama_api.GenerateResponse) error {
-		jsonStr := cleanJson(resp.Response)
+	desc, ok := s.tool.Describe(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", tool.ErrUnknownTool, name)
+	}
 
-		params := map[string]string{}
-		if err = json.Unmarshal([]byte(jsonStr), &params); err != nil {
-			return err
-		}
+	params := map[string]string{}
 
-		for k, v := range params {
-			params[strings.ToLower(k)] = v
-		}
+	if !tool.HasParams(desc.Schema) {
+		return s.tool.Query(ctx, name, params)
+	}
 
-		ret, err = s.tool.Query(ctx, tool, params)
+	prompt, err := toolPrompt(desc, q)
+	if err != nil {
+		return "", err
+	}
 
-		return err
+	generated, err := s.provider.Generate(ctx, provider.GenerateRequest{
+		Model:       s.llmModel,
+		Prompt:      prompt,
+		Temperature: 0.0,
+		Format:      desc.Schema,
+	}, nil)
+	if err != nil {
+		return "", err
 	}
 
-	if err = s.ollama.Generate(ctx, ollamaReq, respFunc); err != nil {
+	extracted := map[string]string{}
+	if err = json.Unmarshal([]byte(cleanJson(generated)), &extracted); err != nil {
 		return "", err
 	}
 
-	return ret, nil
+	for k, v := range extracted {
+		params[strings.ToLower(k)] = v
+	}
+
+	return s.tool.Query(ctx, name, params)
 }
 
-func (s *Service) checkCache(ctx context.Context, q string) (ret string, err error) {
+// toolScope keeps the api key already in ctx and adds the namespaces of the
+// query, so the tool policies of both apply.
+func toolScope(ctx context.Context, namespaces []string) tool.Scope {
+	scope := tool.ScopeFrom(ctx)
+
+	scope.Namespaces = namespaces
+	if len(namespaces) == 0 {
+		scope.Namespaces = []string{rag.DefaultNamespace}
+	}
+
+	return scope
+}
+
+func cacheNamespaces(namespaces []string) string {
+	if len(namespaces) == 0 {
+		return cache.DefaultNamespace
+	}
+
+	sorted := slices.Clone(namespaces)
+	slices.Sort(sorted)
+
+	return strings.Join(slices.Compact(sorted), "|")
+}
+
+func (s *Service) checkCache(ctx context.Context, q string, scope string) (ret string, err error) {
 	ctx, span := s.tracer.Start(ctx, "llm.checkCache", trace.WithAttributes(attribute.String("q", q)))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	res, err := s.cache.Query(ctx, q)
+	res, err := s.cache.Query(ctx, q, map[string]string{cache.MetaNamespaces: scope})
 	if err != nil {
 		return "", err
 	}
@@ -276,6 +420,10 @@ func (s *Service) checkCache(ctx context.Context, q string) (ret string, err err
 		if ares.Similarity > float32(s.minConfidenceCache) {
 			span.AddEvent("using cache", trace.WithAttributes(attribute.Int("i", i)))
 
+			if err := s.cache.Hit(ctx, ares.ID); err != nil {
+				s.logger.Warn("Failed to record cache hit", "id", ares.ID, "err", err)
+			}
+
 			return ares.Metadata["RESPONSE"], nil
 		}
 	}
@@ -287,10 +435,10 @@ func (s *Service) checkCache(ctx context.Context, q string) (ret string, err err
 	return "", nil
 }
 
-func (s *Service) addCacheMetrics(ctx context.Context, span trace.Span, in string, out string) error {
+func (s *Service) addCacheMetrics(ctx context.Context, span trace.Span, in string, out string) (Tokens, error) {
 	tokensIn, err := s.tokenizer.Count(in)
 	if err != nil {
-		return err
+		return Tokens{}, err
 	}
 
 	s.metricTokensInCache.Add(ctx, int64(tokensIn))
@@ -298,19 +446,19 @@ func (s *Service) addCacheMetrics(ctx context.Context, span trace.Span, in strin
 
 	tokensOut, err := s.tokenizer.Count(out)
 	if err != nil {
-		return err
+		return Tokens{}, err
 	}
 
 	s.metricTokensOutCache.Add(ctx, int64(tokensOut))
 	span.SetAttributes(attribute.Int64("tokens-out-cache", int64(tokensOut)))
 
-	return nil
+	return Tokens{Source: "cache", In: tokensIn, Out: tokensOut}, nil
 }
 
-func (s *Service) addLlmMetrics(ctx context.Context, span trace.Span, in string, out string) error {
+func (s *Service) addLlmMetrics(ctx context.Context, span trace.Span, in string, out string) (Tokens, error) {
 	tokensIn, err := s.tokenizer.Count(in)
 	if err != nil {
-		return err
+		return Tokens{}, err
 	}
 
 	s.metricTokensInLlm.Add(ctx, int64(tokensIn))
@@ -318,11 +466,11 @@ func (s *Service) addLlmMetrics(ctx context.Context, span trace.Span, in string,
 
 	tokensOut, err := s.tokenizer.Count(out)
 	if err != nil {
-		return err
+		return Tokens{}, err
 	}
 
 	s.metricTokensOutLlm.Add(ctx, int64(tokensOut))
 	span.SetAttributes(attribute.Int64("tokens-out-llm", int64(tokensOut)))
 
-	return nil
+	return Tokens{Source: "llm", In: tokensIn, Out: tokensOut}, nil
 }
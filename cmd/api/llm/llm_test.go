@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/provider"
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/tokenizer"
+	"gophercon-2025/cmd/api/tool"
+)
+
+var testTracer = tracenoop.NewTracerProvider().Tracer("")
+
+// newTestService builds a service answering through p, with in-memory stores
+// seeded with facts. Cached answers are invalidated with their facts, as the
+// api wires it.
+func newTestService(t *testing.T, p provider.Provider, facts []string, opts ...Option) *Service {
+	t.Helper()
+
+	embed := provider.EmbeddingFunc(p, "fake")
+
+	ragService, err := rag.New(
+		rag.WithDb(chromem.NewDB()),
+		rag.WithEmbeddingFunc(embed),
+		rag.WithTracer(testTracer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheService := newTestCache(t, p)
+
+	ragService.OnChange(func(ctx context.Context, change rag.Change) error {
+		_, err := cacheService.InvalidateFacts(ctx, change.Namespace, change.IDs...)
+		return err
+	})
+
+	for _, fact := range facts {
+		if err := ragService.Add(context.Background(), "", fact, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return New(append([]Option{
+		WithProvider(p),
+		WithRag(ragService),
+		WithCache(cacheService),
+		WithTool(tool.New(tool.WithTracer(testTracer))),
+		WithTokenizer(tokenizer.New(tokenizer.WithWhitespace())),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithTracer(testTracer),
+		WithMetrics(metricnoop.NewMeterProvider().Meter("")),
+		WithMinConfidenceRag(0.8),
+		WithMinConfidenceTool(0.6),
+		WithMinConfidenceCache(0.9),
+		WithMaxAgentSteps(4),
+	}, opts...)...)
+}
+
+func newTestCache(t *testing.T, p provider.Provider, opts ...cache.Option) *cache.Service {
+	t.Helper()
+
+	ret, err := cache.New(append([]cache.Option{
+		cache.WithDb(chromem.NewDB()),
+		cache.WithEmbeddingFunc(provider.EmbeddingFunc(p, "fake")),
+		cache.WithTracer(testTracer),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+// prompt is the last user message of the first llm call.
+func prompt(t *testing.T, fake *provider.Fake) string {
+	t.Helper()
+
+	calls := fake.Calls()
+	if len(calls) == 0 {
+		t.Fatal("llm was not called")
+	}
+
+	messages := calls[0].Messages
+
+	return messages[len(messages)-1].Content
+}
+
+func TestQueryLexicalOnlyFact(t *testing.T) {
+	facts := []string{
+		"O indicador ACD042 mede acidentes com afastamento na fabrica de Campinas",
+		"A meta de vendas do trimestre foi batida pela equipe do sul",
+		"O estoque de pecas de reposicao e revisado toda segunda feira",
+		"Reunioes de planejamento acontecem na primeira semana do mes",
+		"O indice de satisfacao dos clientes subiu no ultimo semestre",
+		"Treinamentos de seguranca sao obrigatorios para novos funcionarios",
+	}
+	q := "Qual o valor atual do ACD042?"
+
+	for _, tt := range []struct {
+		name     string
+		minScore float64
+		want     bool
+	}{
+		{name: "lexical threshold", minScore: 2, want: true},
+		{name: "similarity only", minScore: 0, want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := provider.NewFake()
+			s := newTestService(t, fake, facts, WithMinScoreLexical(tt.minScore))
+
+			ret, err := s.Query(context.Background(), Request{Query: q})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Contains(prompt(t, fake), facts[0]); got != tt.want {
+				t.Fatalf("fact in prompt = %v, want %v; prompt:\n%s", got, tt.want, prompt(t, fake))
+			}
+
+			if got := len(ret.Provenance.Facts) == 1 && ret.Provenance.Facts[0].Similarity <= 0.8; got != tt.want {
+				t.Fatalf("lexical only fact in provenance = %v, want %v: %+v", got, tt.want, ret.Provenance.Facts)
+			}
+		})
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	q := "Qual o horario de funcionamento do suporte?"
+
+	t.Run("hit", func(t *testing.T) {
+		fake := provider.NewFake()
+		s := newTestService(t, fake, nil)
+
+		for range 2 {
+			if _, err := s.Query(ctx, Request{Query: q, UseCache: true}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := len(fake.Calls()); n != 1 {
+			t.Fatalf("llm called %d times, want the second answer from the cache", n)
+		}
+
+		_, tokens, err := s.QueryStream(ctx, Request{Query: q, UseCache: true}, func(string) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tokens.Source != "cache" {
+			t.Fatalf("answer came from %s, want cache", tokens.Source)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		fake := provider.NewFake()
+		s := newTestService(t, fake, nil, WithCache(newTestCache(t, fake, cache.WithTtl(cache.SourceLlm, 20*time.Millisecond))))
+
+		if _, err := s.Query(ctx, Request{Query: q, UseCache: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		if _, err := s.Query(ctx, Request{Query: q, UseCache: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(fake.Calls()); n != 2 {
+			t.Fatalf("llm called %d times, want an expired answer to be generated again", n)
+		}
+	})
+
+	t.Run("fact invalidation", func(t *testing.T) {
+		fake := provider.NewFake()
+		fact := "O suporte funciona de segunda a sexta das 8 as 18 horas"
+		s := newTestService(t, fake, []string{fact}, WithMinConfidenceRag(0.1))
+
+		ret, err := s.Query(ctx, Request{Query: q, UseCache: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ret.Provenance.Facts) != 1 {
+			t.Fatalf("answer built from %d facts, want 1", len(ret.Provenance.Facts))
+		}
+
+		if err = s.rag.Del(ctx, "", ret.Provenance.Facts[0].ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = s.Query(ctx, Request{Query: q, UseCache: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(fake.Calls()); n != 2 {
+			t.Fatalf("llm called %d times, want the answer of a deleted fact dropped from the cache", n)
+		}
+	})
+
+	t.Run("history skips the cache", func(t *testing.T) {
+		fake := provider.NewFake()
+		s := newTestService(t, fake, nil)
+
+		history := []conversation.Message{{Role: provider.RoleUser, Content: "oi"}, {Role: provider.RoleAssistant, Content: "ola"}}
+
+		for range 2 {
+			if _, err := s.Query(ctx, Request{Query: q, UseCache: true, History: history}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := len(fake.Calls()); n != 2 {
+			t.Fatalf("llm called %d times, want answers depending on history never cached", n)
+		}
+	})
+}
@@ -3,11 +3,12 @@ package llm
 import (
 	"log/slog"
 
-	ollama_api "github.com/ollama/ollama/api"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
 	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/conversation"
+	"gophercon-2025/cmd/api/provider"
 	"gophercon-2025/cmd/api/rag"
 	"gophercon-2025/cmd/api/tokenizer"
 	"gophercon-2025/cmd/api/tool"
@@ -33,15 +34,32 @@ func WithMinConfidenceCache(minConfidenceCache float64) Option {
 	}
 }
 
+// WithMinScoreLexical sets the BM25 score a fact the vector search finds
+// unlike the query needs to be used as context anyway, as happens with codes
+// and rare terms. 0 only uses facts above the rag confidence.
+func WithMinScoreLexical(minScoreLexical float64) Option {
+	return func(s *Service) {
+		s.minScoreLexical = minScoreLexical
+	}
+}
+
+// WithCacheToolAnswers allows caching answers built from tool output, which
+// are otherwise never cached.
+func WithCacheToolAnswers(b bool) Option {
+	return func(s *Service) {
+		s.cacheToolAnswers = b
+	}
+}
+
 func WithLlmModel(llmModel string) Option {
 	return func(s *Service) {
 		s.llmModel = llmModel
 	}
 }
 
-func WithOllama(c *ollama_api.Client) Option {
+func WithProvider(p provider.Provider) Option {
 	return func(s *Service) {
-		s.ollama = c
+		s.provider = p
 	}
 }
 
@@ -109,6 +127,16 @@ func WithMetrics(meter metric.Meter) Option {
 		if err != nil {
 			panic(err)
 		}
+
+		s.metricParse, err = meter.Int64Counter("llm_response_parse")
+		if err != nil {
+			panic(err)
+		}
+
+		s.metricCacheSkipped, err = meter.Int64Counter("llm_cache_skipped")
+		if err != nil {
+			panic(err)
+		}
 	}
 }
 
@@ -117,3 +145,21 @@ func WithTool(tool *tool.Service) Option {
 		s.tool = tool
 	}
 }
+
+func WithConversation(c *conversation.Service) Option {
+	return func(s *Service) {
+		s.conversation = c
+	}
+}
+
+func WithHistoryTokens(n int) Option {
+	return func(s *Service) {
+		s.historyTokens = n
+	}
+}
+
+func WithMaxAgentSteps(n int) Option {
+	return func(s *Service) {
+		s.maxAgentSteps = n
+	}
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/provider"
+)
+
+const (
+	parseOk        = "ok"
+	parseExtracted = "extracted"
+	parseRepaired  = "repaired"
+	parseFallback  = "fallback"
+	parseFailed    = "failed"
+)
+
+//go:embed response_schema.json
+var responseSchema json.RawMessage
+
+// finalSchema is responseSchema without tool requests, for answers that must
+// be final.
+//
+//go:embed final_schema.json
+var finalSchema json.RawMessage
+
+const repairPrompt = `Sua resposta anterior não é um objeto json valido (erro: %s).
+Responda novamente com o mesmo conteúdo, mas apenas com o objeto json valido, nada além disso.`
+
+// extractJson returns the outermost json object found in s, ignoring any prose
+// the llm may have added around it.
+func extractJson(s string) (string, bool) {
+	ini := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+
+	if ini < 0 || end <= ini {
+		return "", false
+	}
+
+	return s[ini : end+1], true
+}
+
+// parse turns the generated text into a Response. When it is not valid json
+// the llm is asked once to repair it, complying with format, and, if that also
+// fails, the raw text is taken as a FINAL answer. Errors are those of the
+// repair request, as a canceled context or an unreachable provider.
+func (s *Service) parse(ctx context.Context, span trace.Span, messages []provider.Message, format json.RawMessage, generated string) (Response, error) {
+	ret, err := loadFromJson(generated)
+	if err == nil {
+		s.recordParse(ctx, span, parseOk, nil)
+
+		return ret, nil
+	}
+
+	if extracted, ok := extractJson(generated); ok {
+		if ret, exErr := loadFromJson(extracted); exErr == nil {
+			s.recordParse(ctx, span, parseExtracted, err)
+
+			return ret, nil
+		}
+	}
+
+	repairMessages := append(messages[:len(messages):len(messages)],
+		provider.Message{Role: provider.RoleAssistant, Content: generated},
+		provider.Message{Role: provider.RoleUser, Content: fmt.Sprintf(repairPrompt, err.Error())},
+	)
+
+	repaired, repairErr := s.chat(ctx, repairMessages, format, nil)
+	if repairErr != nil {
+		s.recordParse(ctx, span, parseFailed, repairErr)
+
+		return Response{}, repairErr
+	}
+
+	if ret, repairErr = loadFromJson(repaired); repairErr == nil {
+		s.recordParse(ctx, span, parseRepaired, err)
+
+		return ret, nil
+	}
+
+	s.recordParse(ctx, span, parseFallback, repairErr)
+
+	return Response{
+		Type:     "FINAL",
+		Response: strings.TrimSpace(cleanJson(generated)),
+	}, nil
+}
+
+func (s *Service) recordParse(ctx context.Context, span trace.Span, outcome string, err error) {
+	attrs := []attribute.KeyValue{attribute.String("outcome", outcome)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+
+	span.AddEvent("response parsed", trace.WithAttributes(attrs...))
+	s.metricParse.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+
+	if outcome != parseOk {
+		s.logger.Warn("LLM response was not valid json", "outcome", outcome, "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gophercon-2025/cmd/api/provider"
+)
+
+var errUnreachable = errors.New("provider unreachable")
+
+// failingProvider answers the first n chats through the fake and fails the
+// others, as a provider going away would.
+type failingProvider struct {
+	*provider.Fake
+	n     int64
+	chats atomic.Int64
+}
+
+func (p *failingProvider) Chat(ctx context.Context, req provider.ChatRequest, fn provider.StreamFunc) (string, error) {
+	if p.chats.Add(1) > p.n {
+		return "", errUnreachable
+	}
+
+	return p.Fake.Chat(ctx, req, fn)
+}
+
+func TestQueryParse(t *testing.T) {
+	const final = `{"type": "FINAL", "response": "o suporte abre as 8", "confidence": 0.9}`
+
+	for _, tt := range []struct {
+		name   string
+		script []string
+		want   string
+		calls  int
+	}{
+		{name: "ok", script: []string{final}, want: "o suporte abre as 8", calls: 1},
+		{name: "fenced", script: []string{"```json\n" + final + "\n```"}, want: "o suporte abre as 8", calls: 1},
+		{name: "extracted", script: []string{"Claro! " + final + " Espero ter ajudado."}, want: "o suporte abre as 8", calls: 1},
+		{name: "repaired", script: []string{`{"type": "FINAL", "response": "o suporte`, final}, want: "o suporte abre as 8", calls: 2},
+		{name: "fallback", script: []string{"o suporte abre as 8", "continua sem json"}, want: "o suporte abre as 8", calls: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := provider.NewFake(tt.script...)
+			s := newTestService(t, fake, nil)
+
+			ret, err := s.Query(context.Background(), Request{Query: "Quando o suporte abre?"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret.Type != "FINAL" || ret.Response != tt.want {
+				t.Fatalf("got %s %q, want FINAL %q", ret.Type, ret.Response, tt.want)
+			}
+
+			calls := fake.Calls()
+			if len(calls) != tt.calls {
+				t.Fatalf("llm called %d times, want %d", len(calls), tt.calls)
+			}
+
+			if tt.calls < 2 {
+				return
+			}
+
+			repair := calls[1].Messages
+			if got := repair[len(repair)-2]; got.Role != provider.RoleAssistant || got.Content != tt.script[0] {
+				t.Fatalf("repair does not show the broken answer: %+v", got)
+			}
+
+			if got := repair[len(repair)-1].Content; !strings.Contains(got, "json valido") {
+				t.Fatalf("repair prompt missing: %q", got)
+			}
+
+			if string(calls[1].Format) != string(responseSchema) {
+				t.Fatal("repair does not ask for the response schema")
+			}
+		})
+	}
+}
+
+func TestQueryRepairError(t *testing.T) {
+	p := &failingProvider{Fake: provider.NewFake("isso nao e json"), n: 1}
+	s := newTestService(t, p, nil)
+
+	_, err := s.Query(context.Background(), Request{Query: "Quando o suporte abre?"})
+	if !errors.Is(err, errUnreachable) {
+		t.Fatalf("err = %v, want the repair request error instead of the raw text", err)
+	}
+}
@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/cache"
+)
+
+// FactRef is a rag fact that was added to the prompt of an answer.
+type FactRef struct {
+	ID         string  `json:"id"`
+	Namespace  string  `json:"namespace"`
+	Similarity float32 `json:"similarity"`
+	Lexical    float64 `json:"lexical,omitempty"`
+}
+
+// Provenance lists what an answer was built from, beyond the llm itself.
+type Provenance struct {
+	Facts []FactRef `json:"facts,omitempty"`
+	Tools []string  `json:"tools,omitempty"`
+}
+
+func (p *Provenance) addTool(name string) {
+	if !slices.Contains(p.Tools, name) {
+		p.Tools = append(p.Tools, name)
+	}
+}
+
+// source classifies an answer for the cache, tools winning over facts.
+func (p Provenance) source() string {
+	switch {
+	case len(p.Tools) > 0:
+		return cache.SourceTool
+	case len(p.Facts) > 0:
+		return cache.SourceRag
+	default:
+		return cache.SourceLlm
+	}
+}
+
+// addCache caches an answer unless its provenance rules it out. Tool output
+// is usually time sensitive (date, df, KPI rows), so those answers are only
+// cached when explicitly allowed.
+func (s *Service) addCache(ctx context.Context, span trace.Span, q string, scope string, ret Response) error {
+	if ret.Source == cache.SourceTool && !s.cacheToolAnswers {
+		span.AddEvent("cache skipped", trace.WithAttributes(attribute.StringSlice("tools", ret.Provenance.Tools)))
+		s.metricCacheSkipped.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", cache.SourceTool)))
+
+		return nil
+	}
+
+	answer := cache.Answer{
+		Query:      q,
+		Response:   ret.Response,
+		Namespaces: scope,
+		Source:     ret.Source,
+	}
+
+	for _, f := range ret.Provenance.Facts {
+		answer.Facts = append(answer.Facts, cache.FactRef{Namespace: f.Namespace, ID: f.ID})
+	}
+
+	return s.cache.AddAnswer(ctx, answer)
+}
@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ResponseText adapts fn to receive only the text of the response field of
+// the json the llm generates, decoded, instead of the raw json. Each json
+// object generated, one per agent step, is scanned anew. Chunks that are not
+// json, such as cached answers, are relayed as they are.
+func ResponseText(fn StreamFunc) StreamFunc {
+	rs := &responseScanner{}
+
+	return func(chunk string) error {
+		out := rs.feed(chunk)
+		if out == "" {
+			return nil
+		}
+
+		return fn(out)
+	}
+}
+
+// responseScanner is a minimal json scanner that tracks just enough of the
+// structure to find the top level response string.
+type responseScanner struct {
+	started bool
+	fence   bool
+	plain   bool
+	depth   int
+
+	inStr     bool
+	esc       bool
+	isKey     bool
+	emitting  bool
+	afterKey  bool
+	key       strings.Builder
+	lastKey   string
+	hex       []byte
+	surrogate rune
+
+	out     []byte
+	pending []byte
+}
+
+func (r *responseScanner) feed(chunk string) string {
+	if r.plain {
+		return chunk
+	}
+
+	for i := 0; i < len(chunk); i++ {
+		c := chunk[i]
+
+		if !r.started {
+			switch {
+			case c == '{':
+				r.started = true
+				r.fence = false
+			case c == '`':
+				// the llm wraps json in a markdown fence now and then
+				r.fence = true
+				continue
+			case r.fence, c == ' ', c == '\t', c == '\n', c == '\r':
+				continue
+			default:
+				r.plain = true
+
+				return string(r.flush()) + chunk[i:]
+			}
+		}
+
+		switch {
+		case r.inStr:
+			r.str(c)
+		case c == '"':
+			r.inStr = true
+			r.isKey = r.depth == 1 && !r.afterKey
+			r.emitting = r.depth == 1 && r.afterKey && r.lastKey == "response"
+			r.key.Reset()
+		case c == '{' || c == '[':
+			r.depth++
+		case c == '}' || c == ']':
+			r.depth--
+
+			if r.depth == 0 {
+				r.started = false
+				r.afterKey = false
+			}
+		case c == ':' && r.depth == 1:
+			r.afterKey = true
+		case c == ',' && r.depth == 1:
+			r.afterKey = false
+		}
+	}
+
+	return string(r.flush())
+}
+
+// str handles a byte within a string literal.
+func (r *responseScanner) str(c byte) {
+	switch {
+	case r.hex != nil:
+		r.hex = append(r.hex, c)
+		if len(r.hex) == 4 {
+			r.unicode()
+		}
+
+	case r.esc:
+		r.esc = false
+
+		switch c {
+		case 'u':
+			r.hex = make([]byte, 0, 4)
+		case 'n':
+			r.emit('\n')
+		case 't':
+			r.emit('\t')
+		case 'r':
+			r.emit('\r')
+		case 'b':
+			r.emit('\b')
+		case 'f':
+			r.emit('\f')
+		default:
+			r.emit(c)
+		}
+
+	case c == '\\':
+		r.esc = true
+
+	case c == '"':
+		r.inStr = false
+
+		if r.isKey {
+			r.lastKey = r.key.String()
+		} else if r.depth == 1 {
+			r.afterKey = false
+		}
+
+		r.emitting = false
+
+	default:
+		r.emit(c)
+	}
+}
+
+func (r *responseScanner) unicode() {
+	n, err := strconv.ParseUint(string(r.hex), 16, 32)
+	r.hex = nil
+
+	if err != nil {
+		return
+	}
+
+	cp := rune(n)
+
+	switch {
+	case utf16.IsSurrogate(cp) && r.surrogate == 0:
+		r.surrogate = cp
+
+		return
+	case r.surrogate != 0:
+		cp = utf16.DecodeRune(r.surrogate, cp)
+		r.surrogate = 0
+	}
+
+	var buf [utf8.UTFMax]byte
+	for _, b := range buf[:utf8.EncodeRune(buf[:], cp)] {
+		r.emit(b)
+	}
+}
+
+func (r *responseScanner) emit(c byte) {
+	switch {
+	case r.isKey:
+		r.key.WriteByte(c)
+	case r.emitting:
+		r.out = append(r.out, c)
+	}
+}
+
+// flush returns the text decoded so far, holding back a trailing rune split
+// across chunks.
+func (r *responseScanner) flush() []byte {
+	buf := append(r.pending, r.out...)
+	r.out = r.out[:0]
+
+	cut := len(buf)
+	for back := 1; back < utf8.UTFMax && back <= len(buf); back++ {
+		if utf8.RuneStart(buf[len(buf)-back]) {
+			if !utf8.FullRune(buf[len(buf)-back:]) {
+				cut = len(buf) - back
+			}
+
+			break
+		}
+	}
+
+	ret := buf[:cut]
+	r.pending = append([]byte(nil), buf[cut:]...)
+
+	return ret
+}
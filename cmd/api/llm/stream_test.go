@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponseText(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "final", in: `{"type": "FINAL", "response": "o suporte abre as 8", "confidence": 0.9}`, want: "o suporte abre as 8"},
+		{name: "escapes", in: `{"response": "linha\nnova \"aspas\" é \u00e9 \ud83d\ude00 \\"}`, want: "linha\nnova \"aspas\" é é 😀 \\"},
+		{name: "nested response key", in: `{"params": {"response": "nao"}, "tool": "response", "response": "sim"}`, want: "sim"},
+		{name: "fenced", in: "```json\n{\"response\": \"cercado\"}\n```", want: "cercado"},
+		{name: "not json", in: "resposta em cache", want: "resposta em cache"},
+		{name: "one object after the other", in: `{"response": "um "}{"response": "dois"}`, want: "um dois"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// whole, then a byte at a time, splitting escapes and runes
+			for _, size := range []int{len(tt.in), 1} {
+				var got strings.Builder
+
+				fn := ResponseText(func(text string) error {
+					got.WriteString(text)
+					return nil
+				})
+
+				for i := 0; i < len(tt.in); i += size {
+					if err := fn(tt.in[i:min(i+size, len(tt.in))]); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if got.String() != tt.want {
+					t.Fatalf("chunks of %d: got %q, want %q", size, got.String(), tt.want)
+				}
+			}
+		})
+	}
+}
@@ -4,33 +4,40 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
-	_ "github.com/lib/pq"
-	ollama_api "github.com/ollama/ollama/api"
 	"github.com/philippgille/chromem-go"
 	"github.com/urfave/cli/v3"
 	"go.opentelemetry.io/otel"
 
 	"gophercon-2025/cmd/api/api"
+	"gophercon-2025/cmd/api/apikey"
 	"gophercon-2025/cmd/api/cache"
+	"gophercon-2025/cmd/api/conversation"
 	"gophercon-2025/cmd/api/env"
+	"gophercon-2025/cmd/api/ingest"
+	"gophercon-2025/cmd/api/limit"
 	"gophercon-2025/cmd/api/llm"
+	"gophercon-2025/cmd/api/mcp"
+	"gophercon-2025/cmd/api/provider"
 	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/sqldb"
 	"gophercon-2025/cmd/api/telemetry"
 	"gophercon-2025/cmd/api/tokenizer"
 	"gophercon-2025/cmd/api/tool"
 )
 
-func run(ctx context.Context, f *flags) (err error) {
-	otelShutdown, err := telemetry.Setup(ctx, f.otelEp, f.SlogLevel())
+func run(ctx context.Context, f *flags, command *cli.Command) (err error) {
+	otelShutdown, err := telemetry.Setup(ctx, f.otelEp, f.SlogLevel(), os.Stdout)
 	if err != nil {
 		return err
 	}
@@ -43,91 +50,105 @@ func run(ctx context.Context, f *flags) (err error) {
 
 	_, span := telemetry.Tracer.Start(ctx, "startup")
 
-	vecDb, err := chromem.NewPersistentDB(f.vecDbPath, true)
+	db, dialect, err := openToolDb(ctx, f)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if db != nil {
+		defer db.Close()
 	}
 
-	db, err := sql.Open("postgres", f.toolDb)
+	toolSvc := newToolService(f, db, dialect)
+	defer toolSvc.Close()
+
+	apiKeys, err := newApiKeys(ctx, f, command.IsSet("auth"), db, dialect)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	rs, err := db.Query("select version()")
+	l, err := net.Listen("tcp", f.listeningAddr)
 	if err != nil {
 		return err
 	}
-	defer rs.Close()
 
-	if rs.Err() != nil {
+	vs, err := newVecStores(ctx, f)
+	if err != nil {
 		return err
 	}
 
-	if !rs.Next() {
-		return errors.New("could not retrieve db version")
+	ragService, cacheService, llmProvider := vs.rag, vs.cache, vs.provider
+
+	if err = seedTools(ctx, ragService, toolSvc); err != nil {
+		slog.Warn("Failed to seed tool descriptors", "err", err)
 	}
 
-	var dbVersion string
-	if err = rs.Scan(&dbVersion); err != nil {
-		return err
+	toolSvc.OnChange(func(ctx context.Context) error {
+		return seedTools(ctx, ragService, toolSvc)
+	})
+
+	if f.toolsReload > 0 {
+		go toolSvc.Watch(ctx, f.toolsReload)
 	}
 
-	slog.Info("Using tool db", "version", dbVersion)
+	if f.cacheJanitorInterval > 0 {
+		go cacheService.Janitor(ctx, f.cacheJanitorInterval)
+	}
 
-	toolSvc := tool.New(
-		tool.WithDb(db),
-		tool.WithTracer(telemetry.Tracer),
-	)
+	var conversationStore conversation.Store
 
-	l, err := net.Listen("tcp", f.listeningAddr)
-	if err != nil {
-		return err
+	switch f.conversationStore {
+	case "memory":
+		conversationStore = conversation.NewMemoryStore()
+	case "postgres":
+		if dialect != sqldb.DialectPostgres {
+			return errors.New("the postgres conversation store needs a postgres tool db")
+		}
+
+		conversationStore, err = conversation.NewPostgresStore(ctx, db)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown conversation store: %s", f.conversationStore)
 	}
 
-	ragService, err := rag.New(
-		rag.WithDb(vecDb),
-		rag.WithEmbModel(f.embModel),
-		rag.WithTracer(telemetry.Tracer),
-		rag.WithOllamaEndpoint(f.llmEp),
+	conversationService, err := conversation.New(
+		conversation.WithStore(conversationStore),
+		conversation.WithTracer(telemetry.Tracer),
 	)
 	if err != nil {
 		return err
 	}
 
-	cacheService, err := cache.New(
-		cache.WithDb(vecDb),
-		cache.WithEmbModel(f.embModel),
-		cache.WithTracer(telemetry.Tracer),
-		cache.WithOllamaEndpoint(f.llmEp),
-	)
-
 	tokenizerService := tokenizer.New(
 		tokenizer.WithPretrainedFromCache(f.tokenizerModel, f.tokenizerCache),
 	)
 
-	llmUrl, err := url.Parse(f.llmEp)
-	if err != nil {
-		return err
-	}
-
-	client := ollama_api.NewClient(llmUrl, http.DefaultClient)
-
-	ver, err := client.Version(ctx)
+	ingestService, err := ingest.New(
+		ingest.WithRag(ragService),
+		ingest.WithTokenizer(tokenizerService),
+		ingest.WithTracer(telemetry.Tracer),
+		ingest.WithChunkTokens(int(f.chunkTokens)),
+		ingest.WithOverlapTokens(int(f.overlapTokens)),
+	)
 	if err != nil {
 		return err
 	}
 
-	slog.Info("Llm Connected", "ver", ver)
-
 	llmService := llm.New(
 		llm.WithCache(cacheService),
+		llm.WithCacheToolAnswers(f.cacheToolAnswers),
+		llm.WithConversation(conversationService),
+		llm.WithHistoryTokens(int(f.historyTokens)),
+		llm.WithMaxAgentSteps(int(f.agentMaxSteps)),
 		llm.WithLlmModel(f.llmModel),
 		llm.WithLogger(telemetry.Logger),
 		llm.WithMinConfidenceRag(f.minConfidenceRag),
 		llm.WithMinConfidenceTool(f.minConfidenceTool),
 		llm.WithMinConfidenceCache(f.minConfidenceCache),
-		llm.WithOllama(client),
+		llm.WithMinScoreLexical(f.minScoreLexical),
+		llm.WithProvider(llmProvider),
 		llm.WithRag(ragService),
 		llm.WithTemperature(f.temperature),
 		llm.WithTokenizer(tokenizerService),
@@ -136,13 +157,42 @@ func run(ctx context.Context, f *flags) (err error) {
 		llm.WithTool(toolSvc),
 	)
 
-	mux := api.New(
+	mcpService, err := mcp.New(
+		mcp.WithTool(toolSvc),
+		mcp.WithRag(ragService),
+		mcp.WithTracer(telemetry.Tracer),
+	)
+	if err != nil {
+		return err
+	}
+
+	toolSvc.OnChange(mcpService.Sync)
+
+	apiOpts := append(readinessChecks(f, db, vs),
 		api.WithLlm(llmService),
 		api.WithModel(f.llmModel),
+		api.WithEmbModel(f.embModel),
+		api.WithProvider(llmProvider),
+		api.WithTokenizer(tokenizerService),
 		api.WithRag(ragService),
 		api.WithCache(cacheService),
+		api.WithConversation(conversationService),
+		api.WithIngest(ingestService),
+		api.WithTool(toolSvc),
+		api.WithMcp(f.mcpPath, mcpService.Handler()),
+		api.WithApiKeys(apiKeys),
+		api.WithLimits(limit.New(
+			limit.WithRate(f.rateLimit, int(f.rateBurst)),
+			limit.WithConcurrency(int(f.llmConcurrency)),
+			limit.WithQueue(int(f.llmQueue)),
+			limit.WithQueueTimeout(f.llmQueueTimeout),
+			limit.WithMetrics(telemetry.Meter),
+		)),
+		api.WithConfig(redactedConfig(command)),
 	)
 
+	mux := api.New(apiOpts...)
+
 	server := &http.Server{
 		Handler:      mux,
 		ReadTimeout:  10 * time.Minute,
@@ -183,11 +233,276 @@ func run(ctx context.Context, f *flags) (err error) {
 	return err
 }
 
+// openToolDb opens the tool db of the flags, nil when none is configured.
+func openToolDb(ctx context.Context, f *flags) (*sql.DB, sqldb.Dialect, error) {
+	db, dialect, err := sqldb.Open(f.toolDb)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if db == nil {
+		slog.Warn("No tool db configured, kpi tools disabled")
+
+		return nil, "", nil
+	}
+
+	dbVersion, err := sqldb.Version(ctx, db, dialect)
+	if err != nil {
+		db.Close()
+
+		return nil, "", err
+	}
+
+	slog.Info("Using tool db", "dialect", dialect, "version", dbVersion)
+
+	return db, dialect, nil
+}
+
+func newToolService(f *flags, db *sql.DB, dialect sqldb.Dialect) *tool.Service {
+	return tool.New(
+		tool.WithDb(db, dialect),
+		tool.WithConfig(f.toolsFile),
+		tool.WithTracer(telemetry.Tracer),
+		tool.WithTimeout(f.toolTimeout),
+		tool.WithMaxOutput(int(f.toolMaxOutput)),
+		tool.WithConcurrency(int(f.toolConcurrency)),
+	)
+}
+
+// readinessChecks probes the dependencies of the server. The otel collector is
+// optional, telemetry being lost does not stop the answers.
+func readinessChecks(f *flags, db *sql.DB, vs *vecStores) []api.Option {
+	ret := []api.Option{
+		api.WithCheck(api.Check{Name: "llm", Probe: func(ctx context.Context) error {
+			_, err := vs.provider.Version(ctx)
+
+			return err
+		}}),
+		api.WithCheck(api.Check{Name: "vecdb", Probe: func(ctx context.Context) error {
+			if _, err := os.Stat(f.vecDbPath); err != nil {
+				return err
+			}
+
+			_, err := vs.rag.ListNamespaces(ctx)
+
+			return err
+		}}),
+		api.WithCheck(api.Check{Name: "otel", Optional: true, Probe: func(ctx context.Context) error {
+			return telemetry.Ping(ctx, f.otelEp)
+		}}),
+	}
+
+	if db != nil {
+		ret = append(ret, api.WithCheck(api.Check{Name: "tool_db", Probe: db.PingContext}))
+	}
+
+	return ret
+}
+
+// newApiKeys returns the api keys the routes are checked against, nil when
+// auth is disabled. Without a tool db to keep the keys in, auth is off unless
+// asked for explicitly, which then fails.
+func newApiKeys(ctx context.Context, f *flags, explicit bool, db *sql.DB, dialect sqldb.Dialect) (*apikey.Service, error) {
+	if f.auth && db == nil && !explicit {
+		slog.Warn("No tool db to keep api keys in, api key auth disabled and every route is open. Set --tool-db to enable it")
+
+		return nil, nil
+	}
+
+	if !f.auth {
+		slog.Warn("Api key auth disabled, every route is open")
+
+		return nil, nil
+	}
+
+	ret, err := openApiKeys(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ret.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(keys, func(k apikey.Key) bool { return k.RevokedAt == nil }) {
+		slog.Warn("No api keys yet, create one with: api keys create --name admin --scope admin")
+	}
+
+	return ret, nil
+}
+
+func openApiKeys(db *sql.DB, dialect sqldb.Dialect) (*apikey.Service, error) {
+	ret, err := apikey.New(
+		apikey.WithDb(db, dialect),
+		apikey.WithTracer(telemetry.Tracer),
+	)
+	if errors.Is(err, apikey.ErrNoDb) {
+		return nil, fmt.Errorf("%w: set --tool-db or disable auth with --auth=false", err)
+	}
+
+	return ret, err
+}
+
+// setupCliTelemetry sets telemetry up for the offline subcommands. Unlike the
+// server, they do not fail when the collector can't be reached at exit.
+func setupCliTelemetry(ctx context.Context, f *flags, logOut io.Writer) (func(), error) {
+	otelShutdown, err := telemetry.Setup(ctx, f.otelEp, f.SlogLevel(), logOut)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := otelShutdown(ctx); err != nil {
+			slog.Warn("failed to flush telemetry", "err", err)
+		}
+	}, nil
+}
+
+// vecStores are the services backed by the vector db, shared by the server
+// and the offline subcommands.
+type vecStores struct {
+	db       *chromem.DB
+	provider provider.Provider
+	rag      *rag.Service
+	cache    *cache.Service
+}
+
+func newVecStores(ctx context.Context, f *flags) (*vecStores, error) {
+	vecDb, err := chromem.NewPersistentDB(f.vecDbPath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	llmProvider, err := newProvider(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ver, err := llmProvider.Version(ctx)
+	if err != nil {
+		slog.Warn("Llm not reachable", "provider", f.llmProvider, "err", err)
+	} else {
+		slog.Info("Llm Connected", "provider", f.llmProvider, "ver", ver)
+	}
+
+	embeddingFunc := provider.EmbeddingFunc(llmProvider, f.embModel)
+
+	ragService, err := rag.New(
+		rag.WithDb(vecDb),
+		rag.WithEmbModel(f.embModel),
+		rag.WithTracer(telemetry.Tracer),
+		rag.WithEmbeddingFunc(embeddingFunc),
+		rag.WithLexicalWeight(f.ragLexicalWeight),
+		rag.WithRrfK(int(f.ragRrfK)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheService, err := cache.New(
+		cache.WithDb(vecDb),
+		cache.WithEmbModel(f.embModel),
+		cache.WithTracer(telemetry.Tracer),
+		cache.WithEmbeddingFunc(embeddingFunc),
+		cache.WithTtl(cache.SourceLlm, f.cacheTtlLlm),
+		cache.WithTtl(cache.SourceRag, f.cacheTtlRag),
+		cache.WithTtl(cache.SourceTool, f.cacheTtlTool),
+		cache.WithMaxEntries(int(f.cacheMaxEntries)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// cached answers built from facts that were deleted or replaced are dropped
+	ragService.OnChange(func(ctx context.Context, change rag.Change) error {
+		n, err := cacheService.InvalidateFacts(ctx, change.Namespace, change.IDs...)
+		if n > 0 {
+			slog.Info("Cache entries invalidated", "namespace", change.Namespace, "facts", len(change.IDs), "entries", n)
+		}
+
+		return err
+	})
+
+	return &vecStores{
+		db:       vecDb,
+		provider: llmProvider,
+		rag:      ragService,
+		cache:    cacheService,
+	}, nil
+}
+
+// metaOrigin marks the rag facts written by seedTools, so the ones added by
+// hand are left alone.
+const (
+	metaOrigin     = "origin"
+	originRegistry = "registry"
+)
+
+// seedTools replaces the TOOL facts of the default namespace with the
+// descriptors of the registered tools, which is how the llm finds them. The
+// old descriptors go only once the new ones are in, so a failed embedding
+// leaves the tools findable.
+func seedTools(ctx context.Context, r *rag.Service, t *tool.Service) error {
+	previous, err := r.Facts(ctx, "", map[string]string{metaOrigin: originRegistry})
+	if err != nil {
+		return err
+	}
+
+	descs := t.List()
+
+	facts := make([]rag.Fact, 0, len(descs))
+	for _, desc := range descs {
+		facts = append(facts, rag.Fact{
+			Content: desc.Description,
+			Meta: map[string]string{
+				"type":     llm.TypeTool,
+				"name":     desc.Name,
+				metaOrigin: originRegistry,
+			},
+		})
+	}
+
+	if err = r.AddMany(ctx, "", facts); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(previous))
+	for _, p := range previous {
+		ids = append(ids, p.ID)
+	}
+
+	if err = r.Del(ctx, "", ids...); err != nil {
+		return err
+	}
+
+	slog.Info("Tool descriptors seeded", "tools", len(facts))
+
+	return nil
+}
+
+//nolint:ireturn
+func newProvider(f *flags) (provider.Provider, error) {
+	switch f.llmProvider {
+	case "ollama":
+		return provider.NewOllama(f.llmEp)
+	case "openai":
+		return provider.NewOpenAI(f.llmEp, f.llmApiKey), nil
+	case "fake":
+		return provider.NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider: %s", f.llmProvider)
+	}
+}
+
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	env.Load("api")
+	env.Load("api", "LLM_API_KEY")
 
 	f := &flags{}
 
@@ -196,7 +511,14 @@ func main() {
 		Usage: "Start the api server",
 		Flags: f.build(),
 		Action: func(ctx context.Context, command *cli.Command) error {
-			return run(ctx, f)
+			return run(ctx, f, command)
+		},
+		Commands: []*cli.Command{
+			ingestCommand(f),
+			exportCommand(f),
+			importCommand(f),
+			mcpCommand(f),
+			keysCommand(f),
 		},
 	}).Run(ctx, os.Args); err != nil {
 		panic(err)
@@ -0,0 +1,215 @@
+// Package mcp publishes the tools and the rag of the api as a Model Context
+// Protocol server, so other agents and IDEs can use them. It is served over
+// stdio by the mcp subcommand and over streamable http by the api server.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/tool"
+)
+
+const (
+	ServerName    = "gophercon-2025"
+	ToolRagSearch = "rag_search"
+)
+
+type Service struct {
+	tool    *tool.Service
+	rag     *rag.Service
+	tracer  trace.Tracer
+	version string
+
+	server *gomcp.Server
+
+	mu        sync.Mutex
+	published map[string]bool
+}
+
+type Option func(*Service)
+
+func WithTool(t *tool.Service) Option {
+	return func(s *Service) {
+		s.tool = t
+	}
+}
+
+func WithRag(r *rag.Service) Option {
+	return func(s *Service) {
+		s.rag = r
+	}
+}
+
+func WithTracer(tracer trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+// WithVersion sets the version the server reports to clients.
+func WithVersion(version string) Option {
+	return func(s *Service) {
+		s.version = version
+	}
+}
+
+func New(opts ...Option) (*Service, error) {
+	ret := &Service{
+		version:   "1.0.0",
+		published: map[string]bool{},
+	}
+
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	if ret.tracer == nil {
+		return nil, errors.New("tracer is required")
+	}
+
+	if ret.tool == nil && ret.rag == nil {
+		return nil, errors.New("nothing to publish, either tool or rag is required")
+	}
+
+	ret.server = gomcp.NewServer(&gomcp.Implementation{Name: ServerName, Version: ret.version}, nil)
+
+	if ret.rag != nil {
+		ret.server.AddTool(&gomcp.Tool{
+			Name:        ToolRagSearch,
+			Description: ragSearchDescription,
+			InputSchema: ragSearchSchema,
+		}, ret.ragSearch)
+
+		ret.server.AddResourceTemplate(&gomcp.ResourceTemplate{
+			Name:        "rag-document",
+			Description: "Documento ingerido na base de conhecimento, com todos os seus trechos em ordem",
+			URITemplate: documentUriTemplate,
+			MIMEType:    "text/plain",
+		}, ret.readDocument)
+
+		ret.server.AddReceivingMiddleware(ret.middlewareResources)
+	}
+
+	// added last, so it wraps every other middleware
+	ret.server.AddReceivingMiddleware(ret.middlewareTrace)
+
+	if ret.tool != nil {
+		ret.Sync(context.Background())
+	}
+
+	return ret, nil
+}
+
+// Sync publishes the tools of the registry, dropping the ones gone from it.
+// It is meant to be hooked to tool.Service.OnChange, clients are told the
+// list changed.
+func (s *Service) Sync(ctx context.Context) error {
+	descs := s.tool.List()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[string]bool, len(descs))
+
+	for _, desc := range descs {
+		if desc.Name == ToolRagSearch && s.rag != nil {
+			slog.Warn("Tool shadowed by the mcp rag search, not published", "tool", desc.Name)
+			continue
+		}
+
+		if !objectSchema(desc.Schema) {
+			slog.Warn("Tool schema is not an object, not published", "tool", desc.Name)
+			continue
+		}
+
+		next[desc.Name] = true
+
+		s.server.AddTool(&gomcp.Tool{
+			Name:        desc.Name,
+			Description: desc.Description,
+			InputSchema: desc.Schema,
+		}, s.callTool(desc.Name))
+	}
+
+	var gone []string
+
+	for name := range s.published {
+		if !next[name] {
+			gone = append(gone, name)
+		}
+	}
+
+	s.server.RemoveTools(gone...)
+	s.published = next
+
+	slog.Debug("Mcp tools published", "tools", len(next), "removed", len(gone))
+
+	return nil
+}
+
+// objectSchema tells whether schema describes an object, the only kind of
+// input mcp tools take.
+func objectSchema(schema json.RawMessage) bool {
+	var s struct {
+		Type string `json:"type"`
+	}
+
+	return json.Unmarshal(schema, &s) == nil && s.Type == "object"
+}
+
+// Handler serves the mcp server over streamable http.
+func (s *Service) Handler() http.Handler {
+	return gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server {
+		return s.server
+	}, nil)
+}
+
+// RunStdio serves a single client over stdin and stdout, until it disconnects
+// or ctx is done. Nothing else may write to stdout meanwhile.
+func (s *Service) RunStdio(ctx context.Context) error {
+	return s.server.Run(ctx, &gomcp.StdioTransport{})
+}
+
+// middlewareTrace starts a span for every mcp request, child of the trace
+// the http client sent, if any, so mcp calls show up along the rest of the
+// api.
+func (s *Service) middlewareTrace(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (ret gomcp.Result, err error) {
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(extra.Header))
+		}
+
+		attrs := []attribute.KeyValue{attribute.String("method", method)}
+
+		switch params := req.GetParams().(type) {
+		case *gomcp.CallToolParamsRaw:
+			attrs = append(attrs, attribute.String("tool", params.Name))
+		case *gomcp.ReadResourceParams:
+			attrs = append(attrs, attribute.String("uri", params.URI))
+		}
+
+		ctx, span := s.tracer.Start(ctx, "mcp."+method, trace.WithAttributes(attrs...))
+
+		start := time.Now()
+		defer func() {
+			span.RecordError(err)
+			span.End()
+			slog.Info("Mcp request served", "method", method, "duration", time.Since(start).String())
+		}()
+
+		return next(ctx, method, req)
+	}
+}
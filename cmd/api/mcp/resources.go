@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/philippgille/chromem-go"
+
+	"gophercon-2025/cmd/api/ingest"
+)
+
+const (
+	documentUriScheme   = "rag://"
+	documentUriTemplate = documentUriScheme + "{namespace}/{document}"
+)
+
+func documentUri(namespace string, id string) string {
+	return documentUriScheme + namespace + "/" + id
+}
+
+func parseDocumentUri(uri string) (namespace string, id string, ok bool) {
+	rest, ok := strings.CutPrefix(uri, documentUriScheme)
+	if !ok {
+		return "", "", false
+	}
+
+	namespace, id, ok = strings.Cut(rest, "/")
+
+	return namespace, id, ok && namespace != "" && id != ""
+}
+
+// middlewareResources lists the ingested documents as resources. They come
+// and go with the rag, so the list is built on every request instead of kept
+// in the server, and is returned whole, in a single page.
+func (s *Service) middlewareResources(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		if method != "resources/list" {
+			return next(ctx, method, req)
+		}
+
+		resources, err := s.documents(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &gomcp.ListResourcesResult{Resources: resources}, nil
+	}
+}
+
+// documents returns a resource for each document ingested in any namespace.
+// Facts added by hand belong to no document and are left out.
+func (s *Service) documents(ctx context.Context) ([]*gomcp.Resource, error) {
+	namespaces, err := s.rag.ListNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*gomcp.Resource{}
+
+	for _, ns := range namespaces {
+		facts, err := s.rag.Facts(ctx, ns.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks := map[string]int{}
+		sources := map[string]string{}
+
+		for _, fact := range facts {
+			id := fact.Metadata[ingest.MetaDocumentId]
+			if id == "" {
+				continue
+			}
+
+			chunks[id]++
+			sources[id] = fact.Metadata[ingest.MetaSource]
+		}
+
+		ids := make([]string, 0, len(chunks))
+		for id := range chunks {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			name := sources[id]
+			if name == "" {
+				name = id
+			}
+
+			ret = append(ret, &gomcp.Resource{
+				URI:         documentUri(ns.Name, id),
+				Name:        name,
+				Description: fmt.Sprintf("Documento do namespace %s, em %d trechos", ns.Name, chunks[id]),
+				MIMEType:    "text/plain",
+			})
+		}
+	}
+
+	return ret, nil
+}
+
+// readDocument joins the chunks of a document back, in order.
+func (s *Service) readDocument(ctx context.Context, req *gomcp.ReadResourceRequest) (*gomcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+
+	namespace, id, ok := parseDocumentUri(uri)
+	if !ok {
+		return nil, gomcp.ResourceNotFoundError(uri)
+	}
+
+	facts, err := s.rag.Facts(ctx, namespace, map[string]string{ingest.MetaDocumentId: id})
+	if err != nil || len(facts) == 0 {
+		return nil, gomcp.ResourceNotFoundError(uri)
+	}
+
+	sort.SliceStable(facts, func(i, j int) bool {
+		return chunkIndex(facts[i]) < chunkIndex(facts[j])
+	})
+
+	parts := make([]string, 0, len(facts))
+	for _, fact := range facts {
+		parts = append(parts, fact.Content)
+	}
+
+	return &gomcp.ReadResourceResult{
+		Contents: []*gomcp.ResourceContents{{
+			URI:      uri,
+			MIMEType: "text/plain",
+			Text:     strings.Join(parts, "\n\n"),
+		}},
+	}, nil
+}
+
+func chunkIndex(doc chromem.Document) int {
+	n, _ := strconv.Atoi(doc.Metadata[ingest.MetaChunkIndex])
+
+	return n
+}
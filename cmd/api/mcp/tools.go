@@ -0,0 +1,168 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"gophercon-2025/cmd/api/rag"
+	"gophercon-2025/cmd/api/tool"
+)
+
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 25
+)
+
+// toolParams flattens the arguments of a call into the string params tools
+// take. Values other than strings are passed on as json.
+func toolParams(args json.RawMessage) (map[string]string, error) {
+	ret := map[string]string{}
+
+	if len(args) == 0 {
+		return ret, nil
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(args, &m); err != nil {
+		return nil, fmt.Errorf("arguments must be an object: %w", err)
+	}
+
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			ret[k] = v
+		default:
+			bs, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+
+			ret[k] = string(bs)
+		}
+	}
+
+	return ret, nil
+}
+
+func textResult(text string) *gomcp.CallToolResult {
+	return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: text}}}
+}
+
+// errorResult reports a failed call to the client. Failures of the tool
+// itself are results, not protocol errors, so the model calling it can react.
+func errorResult(err error) *gomcp.CallToolResult {
+	ret := &gomcp.CallToolResult{}
+	ret.SetError(err)
+
+	return ret
+}
+
+// callTool runs a tool of the registry, within the limits and policies of
+// tool.Service. Over http the api key the client authenticated with picks the
+// key policies.
+func (s *Service) callTool(name string) gomcp.ToolHandler {
+	return func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+		params, err := toolParams(req.Params.Arguments)
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		if req.Extra != nil && req.Extra.TokenInfo != nil {
+			ctx = tool.WithScope(ctx, tool.Scope{KeyID: req.Extra.TokenInfo.UserID})
+		}
+
+		out, err := s.tool.Query(ctx, name, params)
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		return textResult(out), nil
+	}
+}
+
+const ragSearchDescription = "Busca trechos na base de conhecimento (RAG) por similaridade com o texto da consulta. " +
+	"Retorna os trechos mais relevantes com seu namespace, metadados e pontuação."
+
+var ragSearchSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"query": {
+			"type": "string",
+			"description": "texto a buscar"
+		},
+		"namespaces": {
+			"type": "array",
+			"items": {"type": "string"},
+			"description": "namespaces onde buscar. Vazio para o namespace padrão"
+		},
+		"limit": {
+			"type": "integer",
+			"minimum": 1,
+			"maximum": 25,
+			"description": "quantidade máxima de trechos, 5 por padrão"
+		}
+	},
+	"required": ["query"]
+}`)
+
+type ragSearchArgs struct {
+	Query      string   `json:"query"`
+	Namespaces []string `json:"namespaces"`
+	Limit      int      `json:"limit"`
+}
+
+type ragSearchHit struct {
+	ID        string            `json:"id"`
+	Namespace string            `json:"namespace"`
+	Content   string            `json:"content"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Score     float32           `json:"score"`
+}
+
+func (s *Service) ragSearch(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+	args := ragSearchArgs{}
+
+	if len(req.Params.Arguments) > 0 {
+		if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+			return errorResult(fmt.Errorf("invalid arguments: %w", err)), nil
+		}
+	}
+
+	if args.Query == "" {
+		return errorResult(errors.New("query is required")), nil
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	scored, err := s.rag.QueryScored(ctx, args.Query, rag.Filter{Namespaces: args.Namespaces})
+	if err != nil {
+		return errorResult(err), nil
+	}
+
+	hits := make([]ragSearchHit, 0, min(len(scored), limit, maxSearchLimit))
+
+	for _, sc := range scored[:cap(hits)] {
+		hits = append(hits, ragSearchHit{
+			ID:        sc.ID,
+			Namespace: sc.Namespace,
+			Content:   sc.Content,
+			Meta:      sc.Metadata,
+			Score:     sc.Similarity,
+		})
+	}
+
+	bs, err := json.Marshal(hits)
+	if err != nil {
+		return nil, err
+	}
+
+	return textResult(string(bs)), nil
+}
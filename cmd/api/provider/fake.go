@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const fakeEmbeddingSize = 64
+
+// Fake is a deterministic provider for tests and offline runs. It replies with
+// the scripted responses in order and, once they are exhausted, with a FINAL
+// answer echoing the last user message. Embeddings are hashed bags of words,
+// so texts sharing words are similar.
+type Fake struct {
+	mtx    sync.Mutex
+	script []string
+	calls  []ChatRequest
+}
+
+func NewFake(script ...string) *Fake {
+	return &Fake{script: script}
+}
+
+// Calls returns every request received by Generate and Chat so far.
+func (f *Fake) Calls() []ChatRequest {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return append([]ChatRequest(nil), f.calls...)
+}
+
+func (f *Fake) Generate(ctx context.Context, req GenerateRequest, fn StreamFunc) (string, error) {
+	messages := []Message{}
+	if req.System != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: req.System})
+	}
+
+	messages = append(messages, Message{Role: RoleUser, Content: req.Prompt})
+
+	return f.Chat(ctx, ChatRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		Format:      req.Format,
+	}, fn)
+}
+
+func (f *Fake) Chat(_ context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	ret := f.next(req)
+
+	if fn != nil {
+		for _, chunk := range strings.SplitAfter(ret, " ") {
+			if err := fn(chunk); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func (f *Fake) next(req ChatRequest) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.calls = append(f.calls, req)
+
+	if len(f.script) > 0 {
+		ret := f.script[0]
+		f.script = f.script[1:]
+
+		return ret
+	}
+
+	var last string
+
+	for _, msg := range req.Messages {
+		if msg.Role == RoleUser {
+			last = msg.Content
+		}
+	}
+
+	bs, _ := json.Marshal(map[string]any{
+		"type":       "FINAL",
+		"response":   last,
+		"confidence": 1,
+	})
+
+	return string(bs)
+}
+
+func (f *Fake) Embed(_ context.Context, _ string, input []string) ([][]float32, error) {
+	ret := make([][]float32, 0, len(input))
+
+	for _, text := range input {
+		v := make([]float32, fakeEmbeddingSize)
+
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+
+		for _, w := range words {
+			h := fnv.New32a()
+			h.Write([]byte(w)) //nolint:errcheck
+			v[h.Sum32()%fakeEmbeddingSize]++
+		}
+
+		ret = append(ret, normalize(v))
+	}
+
+	return ret, nil
+}
+
+func (f *Fake) Version(context.Context) (string, error) {
+	return "fake", nil
+}
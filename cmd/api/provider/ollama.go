@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ollama_api "github.com/ollama/ollama/api"
+)
+
+type Ollama struct {
+	client *ollama_api.Client
+}
+
+func NewOllama(endpoint string) (*Ollama, error) {
+	ep, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ollama{client: ollama_api.NewClient(ep, http.DefaultClient)}, nil
+}
+
+func (o *Ollama) Generate(ctx context.Context, req GenerateRequest, fn StreamFunc) (string, error) {
+	stream := fn != nil
+
+	ollamaReq := &ollama_api.GenerateRequest{
+		Model:  req.Model,
+		Prompt: req.Prompt,
+		System: req.System,
+		Stream: &stream,
+		Format: req.Format,
+		Options: map[string]any{
+			"temperature": req.Temperature,
+		},
+	}
+
+	generated := strings.Builder{}
+
+	respFunc := func(resp ollama_api.GenerateResponse) error {
+		generated.WriteString(resp.Response)
+
+		if fn != nil && resp.Response != "" {
+			return fn(resp.Response)
+		}
+
+		return nil
+	}
+
+	if err := o.client.Generate(ctx, ollamaReq, respFunc); err != nil {
+		return "", err
+	}
+
+	return generated.String(), nil
+}
+
+func (o *Ollama) Chat(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	stream := fn != nil
+
+	messages := make([]ollama_api.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, ollama_api.Message{Role: msg.Role, Content: msg.Content})
+	}
+
+	ollamaReq := &ollama_api.ChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   &stream,
+		Format:   req.Format,
+		Options: map[string]any{
+			"temperature": req.Temperature,
+		},
+	}
+
+	generated := strings.Builder{}
+
+	respFunc := func(resp ollama_api.ChatResponse) error {
+		generated.WriteString(resp.Message.Content)
+
+		if fn != nil && resp.Message.Content != "" {
+			return fn(resp.Message.Content)
+		}
+
+		return nil
+	}
+
+	if err := o.client.Chat(ctx, ollamaReq, respFunc); err != nil {
+		return "", err
+	}
+
+	return generated.String(), nil
+}
+
+func (o *Ollama) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	resp, err := o.client.Embed(ctx, &ollama_api.EmbedRequest{
+		Model: model,
+		Input: input,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Embeddings, nil
+}
+
+func (o *Ollama) Version(ctx context.Context) (string, error) {
+	return o.client.Version(ctx)
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAI talks to any server implementing the OpenAI chat completions and
+// embeddings endpoints, such as llama.cpp server, vLLM or LocalAI.
+type OpenAI struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func NewOpenAI(endpoint string, apiKey string) *OpenAI {
+	return &OpenAI{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		apiKey:   apiKey,
+		client:   http.DefaultClient,
+	}
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []Message             `json:"messages"`
+	Temperature    float64               `json:"temperature"`
+	Stream         bool                  `json:"stream"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"`
+	} `json:"choices"`
+}
+
+type openAIEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+type openAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+func (o *OpenAI) Generate(ctx context.Context, req GenerateRequest, fn StreamFunc) (string, error) {
+	messages := make([]Message, 0, 2)
+	if req.System != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: req.System})
+	}
+
+	messages = append(messages, Message{Role: RoleUser, Content: req.Prompt})
+
+	return o.Chat(ctx, ChatRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		Format:      req.Format,
+	}, fn)
+}
+
+func (o *OpenAI) Chat(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	chatReq := openAIChatRequest{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		Stream:      fn != nil,
+	}
+
+	if len(req.Format) > 0 {
+		chatReq.ResponseFormat = &openAIResponseFormat{Type: "json_schema"}
+		chatReq.ResponseFormat.JSONSchema.Name = "response"
+		chatReq.ResponseFormat.JSONSchema.Schema = req.Format
+	}
+
+	resp, err := o.do(ctx, http.MethodPost, "/v1/chat/completions", chatReq)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if fn == nil {
+		chatResp := openAIChatResponse{}
+		if err = json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+			return "", err
+		}
+
+		if len(chatResp.Choices) == 0 {
+			return "", errors.New("no choices found in the response")
+		}
+
+		return chatResp.Choices[0].Message.Content, nil
+	}
+
+	generated := strings.Builder{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		chunk := openAIChatResponse{}
+		if err = json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", err
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		generated.WriteString(chunk.Choices[0].Delta.Content)
+
+		if err = fn(chunk.Choices[0].Delta.Content); err != nil {
+			return "", err
+		}
+	}
+
+	return generated.String(), scanner.Err()
+}
+
+func (o *OpenAI) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	resp, err := o.do(ctx, http.MethodPost, "/v1/embeddings", openAIEmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	embedResp := openAIEmbedResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, err
+	}
+
+	ret := make([][]float32, len(input))
+
+	for _, d := range embedResp.Data {
+		if d.Index < 0 || d.Index >= len(ret) {
+			return nil, fmt.Errorf("embedding index out of range: %d", d.Index)
+		}
+
+		ret[d.Index] = d.Embedding
+	}
+
+	return ret, nil
+}
+
+func (o *OpenAI) Version(ctx context.Context) (string, error) {
+	resp, err := o.do(ctx, http.MethodGet, "/v1/models", nil)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	modelsResp := openAIModelsResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return "", err
+	}
+
+	models := make([]string, 0, len(modelsResp.Data))
+	for _, m := range modelsResp.Data {
+		models = append(models, m.ID)
+	}
+
+	return "openai-compatible (" + strings.Join(models, ", ") + ")", nil
+}
+
+func (o *OpenAI) do(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var reqBody io.Reader
+
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reqBody = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.endpoint+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("error response from %s: %s %s", path, resp.Status, strings.TrimSpace(string(bs)))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/philippgille/chromem-go"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Format, when set, is the JSON schema the generated text must comply with.
+type GenerateRequest struct {
+	Model       string
+	Prompt      string
+	System      string
+	Temperature float64
+	Format      json.RawMessage
+}
+
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature float64
+	Format      json.RawMessage
+}
+
+// StreamFunc receives each partial chunk of a response. Providers only stream
+// when it is not nil.
+type StreamFunc func(chunk string) error
+
+// Provider is the llm backend used to generate answers and embeddings.
+// Generate and Chat return the whole generated text, even when streaming.
+type Provider interface {
+	Generate(ctx context.Context, req GenerateRequest, fn StreamFunc) (string, error)
+	Chat(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error)
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+	Version(ctx context.Context) (string, error)
+}
+
+// EmbeddingFunc adapts p to the embedding function used by chromem collections.
+func EmbeddingFunc(p Provider, model string) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		ret, err := p.Embed(ctx, model, []string{text})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ret) == 0 || len(ret[0]) == 0 {
+			return nil, errors.New("no embeddings found in the response")
+		}
+
+		return normalize(ret[0]), nil
+	}
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return v
+	}
+
+	ret := make([]float32, len(v))
+	for i, x := range v {
+		ret[i] = float32(float64(x) / norm)
+	}
+
+	return ret
+}
@@ -0,0 +1,55 @@
+package rag
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Change tells which facts of a namespace were deleted or replaced. No IDs
+// means the whole namespace changed.
+type Change struct {
+	Namespace string
+	IDs       []string
+}
+
+type ChangeFunc func(ctx context.Context, change Change) error
+
+// OnChange registers fn to be called after facts are deleted or replaced, so
+// whatever was derived from them can be dropped.
+func (r *Service) OnChange(fn ChangeFunc) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+
+	r.hooks = append(r.hooks, fn)
+}
+
+// changed runs the change hooks. The rag was already changed at this point,
+// so failures are only reported.
+func (r *Service) changed(ctx context.Context, namespace string, ids ...string) {
+	r.hooksMu.Lock()
+	hooks := r.hooks
+	r.hooksMu.Unlock()
+
+	change := Change{Namespace: namespaceOrDefault(namespace), IDs: ids}
+
+	for _, fn := range hooks {
+		if err := fn(ctx, change); err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+			slog.Warn("Rag change hook failed", "namespace", change.Namespace, "ids", len(ids), "err", err)
+		}
+	}
+}
+
+// idsWhere returns the ids of the facts of a collection matching where. They
+// come from the lexical index, which is kept in sync with the collection.
+func (r *Service) idsWhere(col *chromem.Collection, where map[string]string) ([]string, error) {
+	idx, err := r.lexical(col)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.ids(where), nil
+}
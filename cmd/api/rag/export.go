@@ -0,0 +1,121 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/vecdb"
+)
+
+// Export writes the facts of namespaces as JSONL, every namespace when none is
+// given, a page of facts at a time. Embeddings are left out unless asked for,
+// they are recomputed on import.
+func (r *Service) Export(ctx context.Context, w io.Writer, namespaces []string, embeddings bool) (n int, err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Export", trace.WithAttributes(
+		attribute.StringSlice("namespaces", namespaces),
+		attribute.Bool("embeddings", embeddings),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("facts", n))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if len(namespaces) == 0 {
+		all, err := r.ListNamespaces(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, ns := range all {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		col, err := r.collection(namespace)
+		if err != nil {
+			return n, err
+		}
+
+		ids, err := r.idsWhere(col, nil)
+		if err != nil {
+			return n, err
+		}
+
+		written, err := vecdb.WriteDocuments(ctx, w, col, ids, namespaceOrDefault(namespace), embeddings)
+		n += written
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Import adds the facts of a JSONL export, creating missing namespaces. Facts
+// keep their ids, so importing the same export twice replaces them.
+func (r *Service) Import(ctx context.Context, rd io.Reader) (n int, err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Import")
+	defer func() {
+		span.SetAttributes(attribute.Int("facts", n))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	n, err = vecdb.ReadRecords(ctx, rd, func(batch []vecdb.Record) error {
+		byNamespace := map[string][]chromem.Document{}
+
+		for _, rec := range batch {
+			namespace := namespaceOrDefault(rec.Namespace)
+			byNamespace[namespace] = append(byNamespace[namespace], rec.Document())
+		}
+
+		for namespace, docs := range byNamespace {
+			col, err := r.collection(namespace)
+			if errors.Is(err, ErrNamespaceNotFound) {
+				if err = r.CreateNamespace(ctx, namespace); err != nil {
+					return err
+				}
+
+				col, err = r.collection(namespace)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err = col.AddDocuments(ctx, docs, addConcurrency); err != nil {
+				return err
+			}
+
+			r.indexAdd(col.Name, docs...)
+
+			// facts keep their ids, so an import may replace facts answers were built from
+			ids := make([]string, 0, len(docs))
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+
+			r.changed(ctx, namespace, ids...)
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+
+	return namespace
+}
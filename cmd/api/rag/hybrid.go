@@ -0,0 +1,254 @@
+package rag
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/vecdb"
+)
+
+const (
+	DefaultLexicalWeight = 0.5
+	DefaultRrfK          = 60
+)
+
+// Scores explains how a result was ranked. Vector is the cosine similarity,
+// Lexical the BM25 score, both ranks start at 1 and are 0 when the result was
+// not found by that retriever. Fused is the weighted reciprocal rank fusion.
+type Scores struct {
+	Vector      float32 `json:"vector"`
+	VectorRank  int     `json:"vector_rank"`
+	Lexical     float64 `json:"lexical"`
+	LexicalRank int     `json:"lexical_rank"`
+	Fused       float64 `json:"fused"`
+}
+
+type Scored struct {
+	chromem.Result
+	Namespace string `json:"namespace"`
+	Scores    Scores `json:"scores"`
+}
+
+// QueryScored merges the vector and BM25 results of every namespace by
+// reciprocal rank fusion. Similarity is always the cosine similarity, also for
+// results found only lexically, so confidence thresholds keep their meaning;
+// those results are told apart by their Scores.Lexical instead.
+func (r *Service) QueryScored(ctx context.Context, s string, filter Filter) (ret []Scored, err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.QueryScored", trace.WithAttributes(
+		attribute.String("query", s),
+		attribute.StringSlice("namespaces", filter.Namespaces),
+		attribute.Float64("lexical_weight", r.lexicalWeight),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("results", len(ret)))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	namespaces := filter.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{DefaultNamespace}
+	}
+
+	emb, err := defaultEmbeddingFunc(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	emb = normalized(emb)
+
+	type key struct{ namespace, id string }
+
+	candidates := map[key]*Scored{}
+
+	var byVector, byLexical []*Scored
+
+	for _, namespace := range namespaces {
+		col, err := r.collection(namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if col.Count() < 1 {
+			continue
+		}
+
+		res, err := col.QueryEmbedding(ctx, emb, min(maxResults, col.Count()), filter.Where, filter.WhereDocument)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range res {
+			sc := &Scored{Result: doc, Namespace: namespaceOrDefault(namespace)}
+			sc.Scores.Vector = doc.Similarity
+
+			candidates[key{namespace, doc.ID}] = sc
+			byVector = append(byVector, sc)
+		}
+
+		if r.lexicalWeight <= 0 {
+			continue
+		}
+
+		idx, err := r.lexical(col)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range idx.search(s, maxResults, filter.Where, filter.WhereDocument) {
+			sc, ok := candidates[key{namespace, hit.id}]
+			if !ok {
+				doc, err := col.GetByID(ctx, hit.id)
+				if err != nil {
+					return nil, err
+				}
+
+				sc = &Scored{
+					Result: chromem.Result{
+						ID:         doc.ID,
+						Metadata:   doc.Metadata,
+						Embedding:  doc.Embedding,
+						Content:    doc.Content,
+						Similarity: cosine(emb, doc.Embedding),
+					},
+					Namespace: namespaceOrDefault(namespace),
+				}
+				sc.Scores.Vector = sc.Similarity
+
+				candidates[key{namespace, hit.id}] = sc
+			}
+
+			sc.Scores.Lexical = hit.score
+			byLexical = append(byLexical, sc)
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("vector_hits", len(byVector)),
+		attribute.Int("lexical_hits", len(byLexical)),
+	)
+
+	sort.SliceStable(byVector, func(i, j int) bool {
+		return byVector[i].Scores.Vector > byVector[j].Scores.Vector
+	})
+
+	for i, sc := range byVector {
+		sc.Scores.VectorRank = i + 1
+		sc.Scores.Fused += (1 - r.lexicalWeight) / float64(r.rrfK+i+1)
+	}
+
+	sort.SliceStable(byLexical, func(i, j int) bool {
+		return byLexical[i].Scores.Lexical > byLexical[j].Scores.Lexical
+	})
+
+	for i, sc := range byLexical {
+		sc.Scores.LexicalRank = i + 1
+		sc.Scores.Fused += r.lexicalWeight / float64(r.rrfK+i+1)
+	}
+
+	ret = make([]Scored, 0, len(candidates))
+	for _, sc := range candidates {
+		ret = append(ret, *sc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Scores.Fused == ret[j].Scores.Fused {
+			return ret[i].Similarity > ret[j].Similarity
+		}
+
+		return ret[i].Scores.Fused > ret[j].Scores.Fused
+	})
+
+	if len(ret) > maxResults {
+		ret = ret[:maxResults]
+	}
+
+	return ret, nil
+}
+
+// lexical returns the BM25 index of a collection, building it on first use.
+func (r *Service) lexical(col *chromem.Collection) (*lexicalIndex, error) {
+	r.indexesMu.Lock()
+	defer r.indexesMu.Unlock()
+
+	if idx, ok := r.indexes[col.Name]; ok {
+		return idx, nil
+	}
+
+	docs, err := vecdb.Documents(r.db, col.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newLexicalIndex(docs)
+	r.indexes[col.Name] = idx
+
+	return idx, nil
+}
+
+func (r *Service) dropIndex(collection string) {
+	r.indexesMu.Lock()
+	defer r.indexesMu.Unlock()
+
+	delete(r.indexes, collection)
+}
+
+// indexAdd and indexRemove apply changes to the BM25 index of a collection if
+// it was built already. They hold the same lock as the build, so a change is
+// either read back from the collection or applied after it. Indexes not built
+// yet will see them when read back.
+func (r *Service) indexAdd(collection string, docs ...chromem.Document) {
+	r.indexesMu.Lock()
+	defer r.indexesMu.Unlock()
+
+	if idx, ok := r.indexes[collection]; ok {
+		idx.add(docs...)
+	}
+}
+
+func (r *Service) indexRemove(collection string, ids ...string) {
+	r.indexesMu.Lock()
+	defer r.indexesMu.Unlock()
+
+	if idx, ok := r.indexes[collection]; ok {
+		idx.remove(ids...)
+	}
+}
+
+func normalized(v []float32) []float32 {
+	var norm float64
+	for _, f := range v {
+		norm += float64(f) * float64(f)
+	}
+
+	norm = math.Sqrt(norm)
+	if norm == 0 || math.Abs(norm-1) < 1e-6 {
+		return v
+	}
+
+	ret := make([]float32, len(v))
+	for i, f := range v {
+		ret[i] = float32(float64(f) / norm)
+	}
+
+	return ret
+}
+
+// cosine expects both vectors to be normalized, as chromem stores them.
+func cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var ret float32
+	for i := range a {
+		ret += a[i] * b[i]
+	}
+
+	return ret
+}
@@ -0,0 +1,237 @@
+package rag
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/philippgille/chromem-go"
+	"golang.org/x/text/unicode/norm"
+
+	"gophercon-2025/cmd/api/vecdb"
+)
+
+// BM25 parameters, the usual Lucene defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// lexicalIndex is an in-memory BM25 inverted index over a collection. It is
+// built from the collection on first use and kept in sync by the service.
+// Metadata filters go through meta, as everywhere else.
+type lexicalIndex struct {
+	mu       sync.RWMutex
+	meta     *vecdb.Index
+	docs     map[string]lexicalDoc
+	postings map[string]map[string]int
+	totalLen int
+}
+
+type lexicalDoc struct {
+	content string
+	terms   map[string]int
+	length  int
+}
+
+type lexicalHit struct {
+	id    string
+	score float64
+}
+
+func newLexicalIndex(docs []chromem.Document) *lexicalIndex {
+	ret := &lexicalIndex{
+		meta:     vecdb.NewIndex(),
+		docs:     map[string]lexicalDoc{},
+		postings: map[string]map[string]int{},
+	}
+
+	ret.add(docs...)
+
+	return ret
+}
+
+// lexicalTerms lowercases text, drops accents and splits it on anything that
+// is not a letter or a digit, so "Instalação" matches "instalacao".
+func lexicalTerms(text string) []string {
+	var sb strings.Builder
+
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(' ')
+		}
+	}
+
+	return strings.Fields(sb.String())
+}
+
+// add indexes docs, replacing the ones already indexed with the same id.
+func (x *lexicalIndex) add(docs ...chromem.Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, doc := range docs {
+		x.del(doc.ID)
+
+		terms := lexicalTerms(doc.Content)
+
+		ldoc := lexicalDoc{
+			content: doc.Content,
+			terms:   make(map[string]int, len(terms)),
+			length:  len(terms),
+		}
+
+		for _, term := range terms {
+			ldoc.terms[term]++
+		}
+
+		for term, tf := range ldoc.terms {
+			if x.postings[term] == nil {
+				x.postings[term] = map[string]int{}
+			}
+
+			x.postings[term][doc.ID] = tf
+		}
+
+		x.docs[doc.ID] = ldoc
+		x.totalLen += ldoc.length
+	}
+
+	x.meta.Add(docs...)
+}
+
+func (x *lexicalIndex) remove(ids ...string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range ids {
+		x.del(id)
+	}
+
+	x.meta.Remove(ids...)
+}
+
+// del must be called with mu held.
+func (x *lexicalIndex) del(id string) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(x.postings[term], id)
+
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+
+	x.totalLen -= doc.length
+	delete(x.docs, id)
+}
+
+// matching returns the docs whose metadata matches where, sorted by id.
+func (x *lexicalIndex) matching(where map[string]string) []chromem.Document {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	ids := x.meta.Where(where)
+	ret := make([]chromem.Document, 0, len(ids))
+
+	for _, id := range ids {
+		meta, _ := x.meta.Meta(id)
+		ret = append(ret, chromem.Document{ID: id, Metadata: meta, Content: x.docs[id].content})
+	}
+
+	return ret
+}
+
+// ids returns the ids of the docs whose metadata matches where, sorted.
+func (x *lexicalIndex) ids(where map[string]string) []string {
+	return x.meta.Where(where)
+}
+
+// search returns the n best BM25 matches of q among the docs passing the
+// same filters chromem applies.
+func (x *lexicalIndex) search(q string, n int, where, whereDocument map[string]string) []lexicalHit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.docs) == 0 {
+		return nil
+	}
+
+	var allowed map[string]bool
+
+	if len(where) > 0 {
+		allowed = map[string]bool{}
+		for _, id := range x.meta.Where(where) {
+			allowed[id] = true
+		}
+	}
+
+	avgLen := float64(x.totalLen) / float64(len(x.docs))
+	scores := map[string]float64{}
+
+	for _, term := range lexicalTerms(q) {
+		postings := x.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (float64(len(x.docs))-df+0.5)/(df+0.5))
+
+		for id, tf := range postings {
+			doc := x.docs[id]
+			if (allowed != nil && !allowed[id]) || !matchesWhereDocument(doc.content, whereDocument) {
+				continue
+			}
+
+			ftf := float64(tf)
+			scores[id] += idf * ftf * (bm25K1 + 1) / (ftf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLen))
+		}
+	}
+
+	ret := make([]lexicalHit, 0, len(scores))
+	for id, score := range scores {
+		ret = append(ret, lexicalHit{id: id, score: score})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].score == ret[j].score {
+			return ret[i].id < ret[j].id
+		}
+
+		return ret[i].score > ret[j].score
+	})
+
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+
+	return ret
+}
+
+func matchesWhereDocument(content string, whereDocument map[string]string) bool {
+	for op, v := range whereDocument {
+		switch op {
+		case "$contains":
+			if !strings.Contains(content, v) {
+				return false
+			}
+		case "$not_contains":
+			if strings.Contains(content, v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,126 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/philippgille/chromem-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrNamespaceInvalid  = errors.New("namespace must match [a-z0-9_-]{1,64}")
+
+	namespaceRe = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+// namespacePrefix prefixes the collections of named namespaces, so they can be
+// told apart from the default one and from other services sharing the db.
+const namespacePrefix = ColletionNameRag + "_"
+
+type Namespace struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func collectionName(namespace string) string {
+	if namespace == "" || namespace == DefaultNamespace {
+		return ColletionNameRag
+	}
+
+	return namespacePrefix + namespace
+}
+
+func (r *Service) CreateNamespace(ctx context.Context, namespace string) (err error) {
+	_, span := r.tracer.Start(ctx, "rag.CreateNamespace", trace.WithAttributes(attribute.String("namespace", namespace)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if !namespaceRe.MatchString(namespace) || namespace == DefaultNamespace {
+		return ErrNamespaceInvalid
+	}
+
+	if r.db.GetCollection(collectionName(namespace), defaultEmbeddingFunc) != nil {
+		return ErrNamespaceExists
+	}
+
+	_, err = r.db.CreateCollection(collectionName(namespace), nil, defaultEmbeddingFunc)
+
+	return err
+}
+
+func (r *Service) ListNamespaces(ctx context.Context) (ret []Namespace, err error) {
+	_, span := r.tracer.Start(ctx, "rag.ListNamespaces")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ret = []Namespace{{Name: DefaultNamespace}}
+
+	for name, col := range r.db.ListCollections() {
+		switch {
+		case name == ColletionNameRag:
+			ret[0].Count = col.Count()
+		case strings.HasPrefix(name, namespacePrefix):
+			ret = append(ret, Namespace{Name: strings.TrimPrefix(name, namespacePrefix), Count: col.Count()})
+		}
+	}
+
+	sort.Slice(ret[1:], func(i, j int) bool {
+		return ret[i+1].Name < ret[j+1].Name
+	})
+
+	return ret, nil
+}
+
+func (r *Service) DropNamespace(ctx context.Context, namespace string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.DropNamespace", trace.WithAttributes(attribute.String("namespace", namespace)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if namespace == "" || namespace == DefaultNamespace {
+		return fmt.Errorf("%w: the default namespace can only be cleared", ErrNamespaceInvalid)
+	}
+
+	if r.db.GetCollection(collectionName(namespace), defaultEmbeddingFunc) == nil {
+		return ErrNamespaceNotFound
+	}
+
+	if err = r.db.DeleteCollection(collectionName(namespace)); err != nil {
+		return err
+	}
+
+	r.dropIndex(collectionName(namespace))
+	r.changed(ctx, namespace)
+
+	return nil
+}
+
+// collection returns the collection backing namespace. The default namespace
+// is created on demand, named ones must be created through CreateNamespace.
+func (r *Service) collection(namespace string) (*chromem.Collection, error) {
+	name := collectionName(namespace)
+
+	col := r.db.GetCollection(name, defaultEmbeddingFunc)
+	if col != nil {
+		return col, nil
+	}
+
+	if name != ColletionNameRag {
+		return nil, fmt.Errorf("%w: %s", ErrNamespaceNotFound, namespace)
+	}
+
+	return r.db.CreateCollection(name, nil, defaultEmbeddingFunc)
+}
@@ -3,6 +3,7 @@ package rag
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/philippgille/chromem-go"
@@ -14,8 +15,21 @@ const (
 	ColletionNameRag      = "rag"
 	EmbeddingModel        = "nomic-embed-text"
 	DefaultOllamaEndpoint = ""
+	DefaultNamespace      = "default"
+
+	maxResults     = 25
+	addConcurrency = 4
 )
 
+// Filter scopes a query. An empty Namespaces searches the default namespace.
+// Where matches metadata values exactly, WhereDocument supports the chromem
+// $contains and $not_contains operators.
+type Filter struct {
+	Namespaces    []string
+	Where         map[string]string
+	WhereDocument map[string]string
+}
+
 var defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(EmbeddingModel, DefaultOllamaEndpoint)
 
 type Service struct {
@@ -24,6 +38,16 @@ type Service struct {
 
 	embModel string
 	llmEp    string
+	embFunc  chromem.EmbeddingFunc
+
+	lexicalWeight float64
+	rrfK          int
+
+	indexesMu sync.Mutex
+	indexes   map[string]*lexicalIndex
+
+	hooksMu sync.Mutex
+	hooks   []ChangeFunc
 }
 
 type Option func(*Service)
@@ -55,6 +79,12 @@ func WithEmbModel(model string) Option {
 	}
 }
 
+func WithEmbeddingFunc(f chromem.EmbeddingFunc) Option {
+	return func(s *Service) {
+		s.embFunc = f
+	}
+}
+
 func WithTracer(tracer trace.Tracer) Option {
 	return func(s *Service) {
 		s.tracer = tracer
@@ -67,93 +97,255 @@ func WithOllamaEndpoint(endpoint string) Option {
 	}
 }
 
-func (r *Service) Add(ctx context.Context, fact string, meta map[string]string) (err error) {
-	ctx, span := r.tracer.Start(ctx, "rag.Add")
+// WithLexicalWeight sets the share of BM25 in the fused ranking, from 0 (pure
+// vector search) to 1 (pure lexical search).
+func WithLexicalWeight(w float64) Option {
+	return func(s *Service) {
+		s.lexicalWeight = w
+	}
+}
+
+func WithRrfK(k int) Option {
+	return func(s *Service) {
+		s.rrfK = k
+	}
+}
+
+func (r *Service) Add(ctx context.Context, namespace string, fact string, meta map[string]string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Add", trace.WithAttributes(attribute.String("namespace", namespace)))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	err = r.collection().AddDocument(ctx, chromem.Document{
+	col, err := r.collection(namespace)
+	if err != nil {
+		return err
+	}
+
+	doc := chromem.Document{
 		ID:       uuid.NewString(),
 		Metadata: meta,
 		Content:  fact,
-	})
+	}
+
+	if err = col.AddDocument(ctx, doc); err != nil {
+		return err
+	}
+
+	r.indexAdd(col.Name, doc)
+
+	return nil
+}
+
+// Fact is a single entry to be added to the rag.
+type Fact struct {
+	Content string
+	Meta    map[string]string
+}
+
+func (r *Service) AddMany(ctx context.Context, namespace string, facts []Fact) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.AddMany", trace.WithAttributes(
+		attribute.String("namespace", namespace),
+		attribute.Int("facts", len(facts)),
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	col, err := r.collection(namespace)
+	if err != nil {
+		return err
+	}
+
+	docs := make([]chromem.Document, 0, len(facts))
+	for _, fact := range facts {
+		docs = append(docs, chromem.Document{
+			ID:       uuid.NewString(),
+			Metadata: fact.Meta,
+			Content:  fact.Content,
+		})
+	}
+
+	if err = col.AddDocuments(ctx, docs, addConcurrency); err != nil {
+		// facts are added all or none, so callers can retry or keep what
+		// they meant to replace
+		ids := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+
+		if delErr := col.Delete(context.WithoutCancel(ctx), nil, nil, ids...); delErr != nil {
+			return errors.Join(err, delErr)
+		}
+
+		return err
+	}
+
+	r.indexAdd(col.Name, docs...)
 
-	return err
+	return nil
 }
 
-func (r *Service) Clear(ctx context.Context) (err error) {
-	_, span := r.tracer.Start(ctx, "rag.Clear")
+func (r *Service) DelWhere(ctx context.Context, namespace string, where map[string]string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.DelWhere", trace.WithAttributes(attribute.String("namespace", namespace)))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	err = r.db.DeleteCollection(ColletionNameRag)
+	if len(where) == 0 {
+		return errors.New("where must not be empty")
+	}
+
+	col, err := r.collection(namespace)
+	if err != nil {
+		return err
+	}
 
-	return err
+	ids, err := r.idsWhere(col, where)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	if err = col.Delete(ctx, nil, nil, ids...); err != nil {
+		return err
+	}
+
+	r.indexRemove(col.Name, ids...)
+
+	r.changed(ctx, namespace, ids...)
+
+	return nil
 }
 
-func (r *Service) Query(ctx context.Context, s string) (ret []chromem.Result, err error) {
-	ctx, span := r.tracer.Start(ctx, "rag.Query", trace.WithAttributes(attribute.String("query", s)))
+func (r *Service) Clear(ctx context.Context, namespace string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Clear", trace.WithAttributes(attribute.String("namespace", namespace)))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	if r.collection().Count() < 1 {
-		return nil, nil
+	col, err := r.collection(namespace)
+	if err != nil {
+		return err
+	}
+
+	if err = r.db.DeleteCollection(col.Name); err != nil {
+		return err
 	}
 
-	nresults := 25
-	if nresults > r.collection().Count() {
-		nresults = r.collection().Count()
+	r.dropIndex(col.Name)
+
+	if _, err = r.db.CreateCollection(col.Name, nil, defaultEmbeddingFunc); err != nil {
+		return err
 	}
 
-	ret, err = r.collection().Query(ctx, s, nresults, nil, nil)
+	r.changed(ctx, namespace)
 
-	return ret, err
+	return nil
 }
 
-func (r *Service) Del(ctx context.Context, id string) (err error) {
-	ctx, span := r.tracer.Start(ctx, "rag.Del")
+func (r *Service) Query(ctx context.Context, s string, filter Filter) (ret []chromem.Result, err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Query", trace.WithAttributes(
+		attribute.String("query", s),
+		attribute.StringSlice("namespaces", filter.Namespaces),
+	))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
-	err = r.collection().Delete(ctx, nil, nil, id)
+	scored, err := r.QueryScored(ctx, s, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ret = make([]chromem.Result, 0, len(scored))
+	for _, sc := range scored {
+		ret = append(ret, sc.Result)
+	}
 
-	return err
+	return ret, nil
 }
 
-func (r *Service) collection() *chromem.Collection {
-	col := r.db.GetCollection(ColletionNameRag, defaultEmbeddingFunc)
-	if col == nil {
-		var err error
-		col, err = r.db.CreateCollection(ColletionNameRag, nil, defaultEmbeddingFunc)
+// Facts returns the facts of a namespace whose metadata matches where, every
+// fact when where is empty. Embeddings are left out.
+func (r *Service) Facts(ctx context.Context, namespace string, where map[string]string) (ret []chromem.Document, err error) {
+	_, span := r.tracer.Start(ctx, "rag.Facts", trace.WithAttributes(attribute.String("namespace", namespace)))
+	defer func() {
+		span.SetAttributes(attribute.Int("facts", len(ret)))
+		span.RecordError(err)
+		span.End()
+	}()
 
-		if err != nil {
-			panic(err)
-		}
+	col, err := r.collection(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.lexical(col)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.matching(where), nil
+}
+
+// Del removes facts of a namespace by id.
+func (r *Service) Del(ctx context.Context, namespace string, ids ...string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "rag.Del", trace.WithAttributes(attribute.String("namespace", namespace)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	col, err := r.collection(namespace)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
 	}
 
-	return col
+	if err = col.Delete(ctx, nil, nil, ids...); err != nil {
+		return err
+	}
+
+	r.indexRemove(col.Name, ids...)
+
+	r.changed(ctx, namespace, ids...)
+
+	return nil
 }
 
 func New(opts ...Option) (ret *Service, err error) {
-	ret = &Service{}
+	ret = &Service{
+		lexicalWeight: DefaultLexicalWeight,
+		rrfK:          DefaultRrfK,
+		indexes:       map[string]*lexicalIndex{},
+	}
 
 	for _, opt := range opts {
 		opt(ret)
 	}
 
-	defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(ret.embModel, ret.llmEp+"/api")
+	switch {
+	case ret.embFunc != nil:
+		defaultEmbeddingFunc = ret.embFunc
+	default:
+		defaultEmbeddingFunc = chromem.NewEmbeddingFuncOllama(ret.embModel, ret.llmEp+"/api")
+	}
 
 	if ret.db == nil {
 		return nil, errors.New("db was not initialized")
 	}
 
+	if ret.lexicalWeight < 0 || ret.lexicalWeight > 1 {
+		return nil, errors.New("lexical weight must be between 0 and 1")
+	}
+
 	return ret, nil
 }
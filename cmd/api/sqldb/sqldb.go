@@ -0,0 +1,113 @@
+// Package sqldb opens the sql db shared by the tools, the api keys and the
+// conversations, either postgres or sqlite.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is the sql flavour of the db.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSqlite   Dialect = "sqlite"
+)
+
+// Open opens the db, picking the driver from the DSN scheme:
+//
+//   - postgres:// and postgresql:// use postgres
+//   - memory, :memory: and sqlite::memory: use an in-memory sqlite
+//   - sqlite://path, file:path or a plain path use a sqlite file
+//
+// An empty DSN or none means no db, and a nil db is returned.
+func Open(dsn string) (*sql.DB, Dialect, error) {
+	switch {
+	case dsn == "" || dsn == "none":
+		return nil, "", nil
+
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		db, err := sql.Open("postgres", dsn)
+
+		return db, DialectPostgres, err
+
+	case dsn == "memory", dsn == ":memory:", dsn == "sqlite::memory:":
+		return openSqlite(":memory:")
+
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return openSqlite(strings.TrimPrefix(dsn, "sqlite://"))
+
+	default:
+		return openSqlite(dsn)
+	}
+}
+
+func openSqlite(path string) (*sql.DB, Dialect, error) {
+	file, query, _ := strings.Cut(strings.TrimPrefix(path, "file:"), "?")
+
+	if file != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if query != "" {
+		query += "&"
+	}
+
+	db, err := sql.Open("sqlite", "file:"+file+"?"+query+"_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, "", err
+	}
+
+	// sqlite takes a single writer, and every connection to :memory: would
+	// open a db of its own
+	db.SetMaxOpenConns(1)
+
+	return db, DialectSqlite, nil
+}
+
+// Version reports the server version of the db.
+func Version(ctx context.Context, db *sql.DB, dialect Dialect) (ret string, err error) {
+	q := "select version()"
+	if dialect == DialectSqlite {
+		q = "select 'SQLite ' || sqlite_version()"
+	}
+
+	err = db.QueryRowContext(ctx, q).Scan(&ret)
+
+	return ret, err
+}
+
+// Migrate applies the goose migrations not applied yet, tracking them on
+// table so the migrations of each package do not collide.
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect, migrations fs.FS, table string) error {
+	storeDialect := database.DialectPostgres
+	if dialect == DialectSqlite {
+		storeDialect = database.DialectSQLite3
+	}
+
+	store, err := database.NewStore(storeDialect, table)
+	if err != nil {
+		return err
+	}
+
+	provider, err := goose.NewProvider("", db, migrations, goose.WithStore(store))
+	if err != nil {
+		return err
+	}
+
+	_, err = provider.Up(ctx)
+
+	return err
+}
@@ -3,8 +3,9 @@ package telemetry
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
-	"os"
+	"net"
 	"time"
 
 	"go.opentelemetry.io/contrib/bridges/otelslog"
@@ -29,7 +30,9 @@ var (
 	Logger *slog.Logger
 )
 
-func Setup(ctx context.Context, ep string, lvl slog.Level) (shutdown func(context.Context) error, err error) {
+// Setup wires traces, metrics and logs to the collector at ep. Logs are also
+// written as text to logOut.
+func Setup(ctx context.Context, ep string, lvl slog.Level, logOut io.Writer) (shutdown func(context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
 
 	shutdown = func(ctx context.Context) error {
@@ -88,7 +91,7 @@ func Setup(ctx context.Context, ep string, lvl slog.Level) (shutdown func(contex
 	global.SetLoggerProvider(loggerProvider)
 
 	otelHandler := otelslog.NewHandler("llm-api")
-	stdoutHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	stdoutHandler := slog.NewTextHandler(logOut, &slog.HandlerOptions{
 		AddSource:   true,
 		Level:       lvl,
 		ReplaceAttr: nil,
@@ -170,3 +173,23 @@ func newLoggerProvider(ctx context.Context, ep string) (*sdklog.LoggerProvider,
 
 	return loggerProvider, nil
 }
+
+// defaultEndpoint is where the otlp exporters send to when no endpoint is set.
+const defaultEndpoint = "localhost:4317"
+
+// Ping tells whether the collector at ep accepts connections. The exporters
+// only report failures when they flush, long after startup.
+func Ping(ctx context.Context, ep string) error {
+	if ep == "" {
+		ep = defaultEndpoint
+	}
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", ep)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -2,6 +2,8 @@ package tokenizer
 
 import (
 	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/model/wordlevel"
+	"github.com/sugarme/tokenizer/pretokenizer"
 	"github.com/sugarme/tokenizer/pretrained"
 )
 
@@ -36,6 +38,20 @@ func WithPretrainedFromCache(model string, filename string) Option {
 	}
 }
 
+// WithWhitespace counts words and punctuation as tokens. It needs no model
+// files, for tests and offline runs.
+func WithWhitespace() Option {
+	return func(s *Service) {
+		m, err := wordlevel.New(map[string]int{"[UNK]": 0}, "[UNK]")
+		if err != nil {
+			panic(err)
+		}
+
+		s.tk = tokenizer.NewTokenizer(m)
+		s.tk.WithPreTokenizer(pretokenizer.NewWhitespace())
+	}
+}
+
 func New(o ...Option) *Service {
 	ret := &Service{}
 
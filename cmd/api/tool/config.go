@@ -0,0 +1,319 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert/yaml"
+)
+
+// maxConfigRead bounds what is read from the tools defined in the tools file.
+// It only guards memory: how long they run and how much of their output
+// reaches the llm are their limits, as for every other tool.
+const maxConfigRead = 1024 * 1024
+
+// Config is the content of the tools file: tools defined without code, mcp
+// servers whose tools are imported, the limits of single tools and the
+// policies of who may run them.
+type Config struct {
+	Tools      []ToolConfig     `yaml:"tools"`
+	McpServers []McpConfig      `yaml:"mcp_servers"`
+	Limits     map[string]Limit `yaml:"limits"`
+	Policies   Policies         `yaml:"policies"`
+}
+
+// ToolConfig defines a tool backed either by a local executable or by an http
+// endpoint. Args, Url and Body are go templates fed with the params. Params
+// are escaped in Url, so each stays a single path segment or query value;
+// Body gets them as they are, {{json .name}} quoting them for JSON bodies.
+type ToolConfig struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	Params      map[string]ParamConfig `yaml:"params"`
+	Exec        *ExecConfig            `yaml:"exec"`
+	Http        *HttpConfig            `yaml:"http"`
+}
+
+type ParamConfig struct {
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// ExecConfig runs Command with Args. Only the variables named in Env are
+// passed on from the api environment.
+type ExecConfig struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Env     []string `yaml:"env"`
+}
+
+// HttpConfig calls Url and, when Extract is set, returns only the value found
+// at that JSONPath of the response.
+type HttpConfig struct {
+	Method  string            `yaml:"method"`
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Extract string            `yaml:"extract"`
+}
+
+// LoadConfig reads a tools file and builds the tools defined in it.
+func LoadConfig(path string) (Config, []Tool, error) {
+	cfg := Config{}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	if err = yaml.Unmarshal(bs, &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	ret := make([]Tool, 0, len(cfg.Tools))
+	seen := map[string]bool{}
+
+	for _, tc := range cfg.Tools {
+		if seen[tc.Name] {
+			return cfg, nil, fmt.Errorf("tool defined twice: %s", tc.Name)
+		}
+
+		seen[tc.Name] = true
+
+		t, err := tc.build()
+		if err != nil {
+			return cfg, nil, fmt.Errorf("tool %s: %w", tc.Name, err)
+		}
+
+		ret = append(ret, t)
+	}
+
+	servers := map[string]bool{}
+
+	for _, mc := range cfg.McpServers {
+		if err = mc.validate(); err != nil {
+			return cfg, nil, fmt.Errorf("mcp server %s: %w", mc.Name, err)
+		}
+
+		if servers[mc.Name] {
+			return cfg, nil, fmt.Errorf("mcp server defined twice: %s", mc.Name)
+		}
+
+		servers[mc.Name] = true
+	}
+
+	return cfg, ret, nil
+}
+
+func (tc ToolConfig) build() (Tool, error) {
+	if tc.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	schema, err := tc.schema()
+	if err != nil {
+		return nil, err
+	}
+
+	base := configTool{
+		name:        tc.Name,
+		description: tc.Description,
+		schema:      schema,
+	}
+
+	switch {
+	case tc.Exec != nil && tc.Http != nil:
+		return nil, errors.New("exec and http are mutually exclusive")
+	case tc.Exec != nil:
+		return newExecTool(base, *tc.Exec)
+	case tc.Http != nil:
+		return newHttpTool(base, *tc.Http)
+	default:
+		return nil, errors.New("either exec or http is required")
+	}
+}
+
+func (tc ToolConfig) schema() (json.RawMessage, error) {
+	type property struct {
+		Type        string `json:"type"`
+		Description string `json:"description,omitempty"`
+	}
+
+	s := struct {
+		Type       string              `json:"type"`
+		Properties map[string]property `json:"properties"`
+		Required   []string            `json:"required,omitempty"`
+	}{
+		Type:       "object",
+		Properties: map[string]property{},
+	}
+
+	for name, p := range tc.Params {
+		s.Properties[name] = property{Type: "string", Description: p.Description}
+
+		if p.Required {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	sort.Strings(s.Required)
+
+	return json.Marshal(s)
+}
+
+// configTool holds what every tool defined in the tools file has in common.
+type configTool struct {
+	name        string
+	description string
+	schema      json.RawMessage
+}
+
+func (c configTool) Name() string { return c.name }
+
+func (c configTool) Description() string { return c.description }
+
+func (c configTool) Schema() json.RawMessage { return c.schema }
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v string) (string, error) {
+			bs, err := json.Marshal(v)
+
+			return string(bs), err
+		},
+	}).Parse(text)
+}
+
+func render(t *template.Template, params map[string]string) (string, error) {
+	buf := bytes.Buffer{}
+	if err := t.Execute(&buf, params); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	room := c.max - c.buf.Len()
+	if len(p) > room {
+		c.truncated = true
+		c.buf.Write(p[:max(room, 0)])
+
+		return len(p), nil
+	}
+
+	return c.buf.Write(p)
+}
+
+func (c *cappedBuffer) String() string {
+	if c.truncated {
+		return c.buf.String() + truncationNotice(c.max)
+	}
+
+	return c.buf.String()
+}
+
+// WithConfig registers the tools defined in a tools file. A missing file
+// defines no tools.
+func WithConfig(path string) Option {
+	return func(service *Service) {
+		service.configPath = path
+
+		if err := service.reloadConfig(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Watch reloads the tools file whenever its modification time changes, until
+// ctx is done. A file that fails to load keeps the previous tools. Mcp
+// servers not connected are retried on every tick.
+func (s *Service) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reloadConfig(ctx); err != nil {
+				slog.Warn("Failed to reload tools file", "path", s.configPath, "err", err)
+			}
+
+			s.reconnectMcp(ctx)
+		}
+	}
+}
+
+func (s *Service) reloadConfig(ctx context.Context) error {
+	if s.configPath == "" {
+		return nil
+	}
+
+	var (
+		modTime time.Time
+		cfg     Config
+		tools   []Tool
+	)
+
+	info, err := os.Stat(s.configPath)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		modTime = info.ModTime()
+	}
+
+	if modTime.Equal(s.configModTime) {
+		return nil
+	}
+
+	if !modTime.IsZero() {
+		if cfg, tools, err = LoadConfig(s.configPath); err != nil {
+			return err
+		}
+	}
+
+	s.replaceConfigured(cfg, tools)
+
+	s.syncMcp(ctx, cfg.McpServers)
+
+	s.configModTime = modTime
+
+	slog.Info("Tools file loaded", "path", s.configPath, "tools", len(tools), "mcp_servers", len(cfg.McpServers))
+
+	s.changed(ctx)
+
+	return nil
+}
+
+// replaceConfigured swaps the tools, limits and policies of the tools file
+// for the ones just loaded.
+func (s *Service) replaceConfigured(cfg Config, tools []Tool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replaceOwned(s.tools, &s.configured, tools)
+
+	s.limits = cfg.Limits
+	s.policies = cfg.Policies
+}
@@ -0,0 +1,58 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/pressly/goose/v3"
+
+	"gophercon-2025/cmd/api/sqldb"
+)
+
+//go:embed migrations
+var embedMigrations embed.FS
+
+func migrate(ctx context.Context, db *sql.DB, dialect sqldb.Dialect) error {
+	migrations, err := fs.Sub(embedMigrations, "migrations/"+string(dialect))
+	if err != nil {
+		return err
+	}
+
+	return sqldb.Migrate(ctx, db, dialect, migrations, goose.DefaultTablename)
+}
+
+// timeArg adapts a time to be bound in a query. Sqlite keeps times as text,
+// so they are written in the layout the migrations use, for comparisons and
+// the unique index to work.
+func timeArg(d sqldb.Dialect, t time.Time) any {
+	if d == sqldb.DialectSqlite {
+		return t.Format(time.DateTime)
+	}
+
+	return t
+}
+
+// periodExpr is the sql expression of the first day of the group dt falls
+// in, formatted as YYYY-MM-DD.
+func periodExpr(d sqldb.Dialect, group string) string {
+	if d == sqldb.DialectPostgres {
+		return fmt.Sprintf("to_char(date_trunc('%s', dt), 'YYYY-MM-DD')", group)
+	}
+
+	switch group {
+	case "week":
+		return "date(dt, '-' || ((strftime('%w', dt) + 6) % 7) || ' days')"
+	case "month":
+		return "strftime('%Y-%m-01', dt)"
+	case "quarter":
+		return "printf('%s-%02d-01', strftime('%Y', dt), ((strftime('%m', dt) - 1) / 3) * 3 + 1)"
+	case "year":
+		return "strftime('%Y-01-01', dt)"
+	default:
+		return "date(dt)"
+	}
+}
@@ -0,0 +1,148 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is a single step of a JSONPath: a key, an index or a wildcard.
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJsonPath supports the subset of JSONPath needed to pick values out of a
+// response: $.a.b, $.a[0], $['a b'] and $.a[*].b.
+func parseJsonPath(path string) ([]pathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("jsonpath must start with $: %s", path)
+	}
+
+	var ret []pathStep
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in jsonpath: %s", path)
+			}
+
+			if rest[:end] == "*" {
+				ret = append(ret, pathStep{wildcard: true})
+			} else {
+				ret = append(ret, pathStep{key: rest[:end]})
+			}
+
+			rest = rest[end:]
+
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in jsonpath: %s", path)
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				ret = append(ret, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				ret = append(ret, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in jsonpath: %s", path)
+				}
+
+				ret = append(ret, pathStep{index: i, isIndex: true})
+			}
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath: %s", rest[0], path)
+		}
+	}
+
+	return ret, nil
+}
+
+var errPathNotFound = errors.New("not found in the response")
+
+func evalJsonPath(doc any, steps []pathStep) (any, error) {
+	if len(steps) == 0 {
+		return doc, nil
+	}
+
+	step, rest := steps[0], steps[1:]
+
+	switch {
+	case step.wildcard:
+		var items []any
+
+		switch v := doc.(type) {
+		case []any:
+			items = v
+		case map[string]any:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		default:
+			return nil, errPathNotFound
+		}
+
+		ret := make([]any, 0, len(items))
+
+		for _, item := range items {
+			found, err := evalJsonPath(item, rest)
+			if err != nil {
+				continue
+			}
+
+			ret = append(ret, found)
+		}
+
+		return ret, nil
+
+	case step.isIndex:
+		arr, ok := doc.([]any)
+		if !ok {
+			return nil, errPathNotFound
+		}
+
+		i := step.index
+		if i < 0 {
+			i += len(arr)
+		}
+
+		if i < 0 || i >= len(arr) {
+			return nil, errPathNotFound
+		}
+
+		return evalJsonPath(arr[i], rest)
+
+	default:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, errPathNotFound
+		}
+
+		v, ok := obj[step.key]
+		if !ok {
+			return nil, errPathNotFound
+		}
+
+		return evalJsonPath(v, rest)
+	}
+}
@@ -0,0 +1,281 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoDb        = errors.New("tool db not configured")
+	ErrKpiNotFound = errors.New("kpi not found")
+	ErrKpiInvalid  = errors.New("invalid kpi name")
+)
+
+// Kpi is a catalog entry. Its description is what the llm reads to decide
+// whether the KPI answers a question.
+type Kpi struct {
+	Kpi         string `json:"kpi"`
+	DisplayName string `json:"display_name,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Point is a single KPI value.
+type Point struct {
+	Kpi   string    `json:"kpi,omitempty"`
+	Dt    time.Time `json:"dt"`
+	Value float64   `json:"value"`
+}
+
+// Kpis lists every KPI with values or in the catalog, sorted by name. KPIs
+// with values but no catalog entry only have their name set.
+func (s *Service) Kpis(ctx context.Context) ([]Kpi, error) {
+	if s.db == nil {
+		return nil, ErrNoDb
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT k.kpi, coalesce(c.display_name, ''), coalesce(c.unit, ''), coalesce(c.description, '')
+		FROM (SELECT DISTINCT kpi FROM kpis UNION SELECT kpi FROM kpi_catalog) k
+		LEFT JOIN kpi_catalog c ON c.kpi = k.kpi
+		ORDER BY k.kpi`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []Kpi
+
+	for rows.Next() {
+		var k Kpi
+		if err = rows.Scan(&k.Kpi, &k.DisplayName, &k.Unit, &k.Description); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, k)
+	}
+
+	return ret, rows.Err()
+}
+
+// SaveKpi creates or replaces the catalog entry of a KPI.
+func (s *Service) SaveKpi(ctx context.Context, k Kpi) error {
+	if s.db == nil {
+		return ErrNoDb
+	}
+
+	if err := s.checkKpiName(k.Kpi); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO kpi_catalog (kpi, display_name, unit, description) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kpi) DO UPDATE SET display_name = excluded.display_name, unit = excluded.unit, description = excluded.description`,
+		k.Kpi, k.DisplayName, k.Unit, k.Description)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshKpis(ctx)
+}
+
+// DeleteKpi drops a KPI from the catalog along with all its values.
+func (s *Service) DeleteKpi(ctx context.Context, kpi string) (err error) {
+	if s.db == nil {
+		return ErrNoDb
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM kpi_catalog WHERE kpi = $1", kpi)
+	if err != nil {
+		return err
+	}
+
+	catalogued, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	res, err = tx.ExecContext(ctx, "DELETE FROM kpis WHERE kpi = $1", kpi)
+	if err != nil {
+		return err
+	}
+
+	points, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if catalogued+points == 0 {
+		err = fmt.Errorf("%w: %s", ErrKpiNotFound, kpi)
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.refreshKpis(ctx)
+}
+
+// Series returns the values of a KPI within [ini, end], oldest first.
+func (s *Service) Series(ctx context.Context, kpi string, ini time.Time, end time.Time) ([]Point, error) {
+	if s.db == nil {
+		return nil, ErrNoDb
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT dt, value FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3 ORDER BY dt",
+		kpi, timeArg(s.dialect, ini), timeArg(s.dialect, end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []Point{}
+
+	for rows.Next() {
+		p := Point{Kpi: kpi}
+		if err = rows.Scan(&p.Dt, &p.Value); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// UpsertPoints writes points in a single transaction, replacing the values
+// already stored for the same KPI and date.
+func (s *Service) UpsertPoints(ctx context.Context, points []Point) (err error) {
+	if s.db == nil {
+		return ErrNoDb
+	}
+
+	checked := map[string]bool{}
+
+	for _, p := range points {
+		if checked[p.Kpi] {
+			continue
+		}
+
+		if err = s.checkKpiName(p.Kpi); err != nil {
+			return err
+		}
+
+		checked[p.Kpi] = true
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO kpis (kpi, dt, value) VALUES ($1, $2, $3)
+		ON CONFLICT (kpi, dt) DO UPDATE SET value = excluded.value`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		if _, err = stmt.ExecContext(ctx, p.Kpi, timeArg(s.dialect, p.Dt), p.Value); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.refreshKpis(ctx)
+}
+
+// DeleteRange deletes the values of a KPI within [ini, end], returning how
+// many were deleted.
+func (s *Service) DeleteRange(ctx context.Context, kpi string, ini time.Time, end time.Time) (int64, error) {
+	if s.db == nil {
+		return 0, ErrNoDb
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3", kpi, timeArg(s.dialect, ini), timeArg(s.dialect, end))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if n > 0 {
+		err = s.refreshKpis(ctx)
+	}
+
+	return n, err
+}
+
+// checkKpiName fails for empty names and for names of tools other than KPIs,
+// whose KPI would never get a tool of its own.
+func (s *Service) checkKpiName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: the name is required", ErrKpiInvalid)
+	}
+
+	s.mu.RLock()
+	_, taken := s.tools[name]
+	owned := s.kpiTools[name]
+	s.mu.RUnlock()
+
+	if taken && !owned {
+		return fmt.Errorf("%w: %s is the name of a tool", ErrKpiInvalid, name)
+	}
+
+	return nil
+}
+
+// refreshKpis registers a tool for every KPI and drops the tools of KPIs that
+// are gone, so new KPIs become queryable right away.
+func (s *Service) refreshKpis(ctx context.Context) error {
+	kpis, err := s.Kpis(ctx)
+	if err != nil {
+		return err
+	}
+
+	tools := make([]Tool, 0, len(kpis))
+	for _, k := range kpis {
+		tools = append(tools, &dbTool{tools: s, db: s.db, dialect: s.dialect, kpi: k.Kpi, meta: k})
+	}
+
+	s.mu.Lock()
+	changed := replaceOwned(s.tools, &s.kpiTools, tools)
+	s.mu.Unlock()
+
+	if changed {
+		s.changed(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultTimeout     = 30 * time.Second
+	DefaultMaxOutput   = 16 * 1024
+	DefaultConcurrency = 8
+)
+
+var ErrTimeout = errors.New("tool timed out")
+
+// Limit overrides the default timeout and output cap of a single tool.
+type Limit struct {
+	Timeout   time.Duration `yaml:"timeout"`
+	MaxOutput int           `yaml:"max_output"`
+}
+
+func truncationNotice(n int) string {
+	return fmt.Sprintf("\n[saída truncada em %d bytes]", n)
+}
+
+// truncate cuts s to at most n bytes, without splitting a rune, and tells the
+// reader it did so.
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut] + truncationNotice(n)
+}
+
+// limitsOf returns the timeout and output cap of a tool.
+func (s *Service) limitsOf(name string) (time.Duration, int) {
+	s.mu.RLock()
+	limit := s.limits[name]
+	s.mu.RUnlock()
+
+	timeout, maxOutput := s.timeout, s.maxOutput
+
+	if limit.Timeout > 0 {
+		timeout = limit.Timeout
+	}
+
+	if limit.MaxOutput > 0 {
+		maxOutput = limit.MaxOutput
+	}
+
+	return timeout, maxOutput
+}
+
+type result struct {
+	out string
+	err error
+}
+
+// run executes a tool within its timeout, holding one of the execution slots
+// while it runs. The slot is only freed when the tool returns, so tools that
+// ignore their context still count against the concurrency limit.
+func (s *Service) run(ctx context.Context, t Tool, params map[string]string) (string, error) {
+	timeout, maxOutput := s.limitsOf(t.Name())
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	if s.sem != nil {
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %s waited %s for an execution slot", ErrTimeout, t.Name(), timeout)
+		}
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		if s.sem != nil {
+			defer func() { <-s.sem }()
+		}
+
+		out, err := t.Query(ctx, params)
+		done <- result{out: out, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: %s after %s", ErrTimeout, t.Name(), timeout)
+		}
+
+		return truncate(res.out, maxOutput), res.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: %s after %s", ErrTimeout, t.Name(), timeout)
+		}
+
+		return "", ctx.Err()
+	}
+}
+
+// withTimeout is context.WithTimeout, with no deadline for a timeout of 0 or
+// less.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// WithTimeout sets how long a tool may run, unless the tools file sets a
+// limit of its own. 0 lets tools run until the request is done.
+func WithTimeout(d time.Duration) Option {
+	return func(service *Service) {
+		service.timeout = d
+	}
+}
+
+// WithMaxOutput caps the output of every tool, unless the tools file sets a
+// limit of its own. Longer outputs are truncated.
+func WithMaxOutput(n int) Option {
+	return func(service *Service) {
+		service.maxOutput = n
+	}
+}
+
+// WithConcurrency caps how many tools run at once, 0 is unbounded.
+func WithConcurrency(n int) Option {
+	return func(service *Service) {
+		service.sem = nil
+		if n > 0 {
+			service.sem = make(chan struct{}, n)
+		}
+	}
+}
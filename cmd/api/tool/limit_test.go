@@ -0,0 +1,58 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// deadlineTool tells whether it ran with a deadline.
+type deadlineTool struct{ configTool }
+
+func (deadlineTool) Query(ctx context.Context, _ map[string]string) (string, error) {
+	if _, ok := ctx.Deadline(); ok {
+		return "deadline", nil
+	}
+
+	return "none", nil
+}
+
+// sleepTool runs until its context is done.
+type sleepTool struct{ configTool }
+
+func (sleepTool) Query(ctx context.Context, _ map[string]string) (string, error) {
+	<-ctx.Done()
+
+	return "", ctx.Err()
+}
+
+func TestRunTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		timeout time.Duration
+		want    string
+	}{
+		{timeout: time.Minute, want: "deadline"},
+		{timeout: 0, want: "none"},
+		{timeout: -time.Second, want: "none"},
+	} {
+		s := New(WithTimeout(tt.timeout))
+
+		got, err := s.run(ctx, deadlineTool{configTool{name: "deadline"}}, nil)
+		if err != nil {
+			t.Fatalf("timeout %s: %v", tt.timeout, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("timeout %s: ran with %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+
+	s := New(WithTimeout(10 * time.Millisecond))
+
+	if _, err := s.run(ctx, sleepTool{configTool{name: "sleep"}}, nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want %v", err, ErrTimeout)
+	}
+}
@@ -24,4 +24,4 @@ INSERT INTO public.kpis (id, kpi, dt, value) VALUES (12, 'INCIDENTS', '2024-12-0
 
 
 -- +goose Down
-drop table kpis
\ No newline at end of file
+drop table kpis;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- +goose Up
+
+create table kpi_catalog
+(
+    kpi          text primary key,
+    display_name text not null default '',
+    unit         text not null default '',
+    description  text not null default ''
+);
+
+INSERT INTO kpi_catalog (kpi, display_name, unit, description)
+VALUES ('INCIDENTS', 'Acidentes de trabalho', 'acidentes', 'quantidade de acidentes de trabalho por mes');
+
+create unique index kpis_kpi_dt on kpis (kpi, dt);
+
+-- the seed rows of 0001 were inserted with explicit ids
+SELECT setval('kpis_id_seq', (SELECT max(id) FROM kpis));
+
+
+-- +goose Down
+drop index kpis_kpi_dt;
+drop table kpi_catalog;
@@ -0,0 +1,27 @@
+-- +goose Up
+
+create table kpis
+(
+    id    INTEGER primary key autoincrement,
+    kpi   text,
+    dt    TIMESTAMP,
+    value REAL
+);
+
+
+INSERT INTO kpis (id, kpi, dt, value) VALUES (1, 'INCIDENTS', '2024-01-01 00:00:00', 2);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (2, 'INCIDENTS', '2024-02-01 00:00:00', 7);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (3, 'INCIDENTS', '2024-03-01 00:00:00', 13);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (4, 'INCIDENTS', '2024-04-01 00:00:00', 4);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (5, 'INCIDENTS', '2024-05-01 00:00:00', 6);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (6, 'INCIDENTS', '2024-06-01 00:00:00', 2);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (7, 'INCIDENTS', '2024-07-01 00:00:00', 1);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (8, 'INCIDENTS', '2024-08-01 00:00:00', 7);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (9, 'INCIDENTS', '2024-09-01 00:00:00', 9);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (10, 'INCIDENTS', '2024-10-01 00:00:00', 8);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (11, 'INCIDENTS', '2024-11-01 00:00:00', 5);
+INSERT INTO kpis (id, kpi, dt, value) VALUES (12, 'INCIDENTS', '2024-12-01 00:00:00', 2);
+
+
+-- +goose Down
+drop table kpis;
\ No newline at end of file
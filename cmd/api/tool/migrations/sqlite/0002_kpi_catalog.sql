@@ -0,0 +1,19 @@
+-- +goose Up
+
+create table kpi_catalog
+(
+    kpi          text primary key,
+    display_name text not null default '',
+    unit         text not null default '',
+    description  text not null default ''
+);
+
+INSERT INTO kpi_catalog (kpi, display_name, unit, description)
+VALUES ('INCIDENTS', 'Acidentes de trabalho', 'acidentes', 'quantidade de acidentes de trabalho por mes');
+
+create unique index kpis_kpi_dt on kpis (kpi, dt);
+
+
+-- +goose Down
+drop index kpis_kpi_dt;
+drop table kpi_catalog;
@@ -0,0 +1,85 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+)
+
+var ErrDenied = errors.New("tool not allowed")
+
+// Policy allows or denies tools by name, * and ? globs included. Deny wins
+// over allow, and an empty Allow allows every tool not denied.
+type Policy struct {
+	Allow []string `yaml:"allow" json:"allow,omitempty"`
+	Deny  []string `yaml:"deny" json:"deny,omitempty"`
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Policy) allows(name string) bool {
+	if matchAny(p.Deny, name) {
+		return false
+	}
+
+	return len(p.Allow) == 0 || matchAny(p.Allow, name)
+}
+
+// Policies are the policies of the tools file. Default applies to every
+// query, the namespace and key ones on top of it to queries in their scope.
+// Keys are api key ids, which unlike names are never reused.
+type Policies struct {
+	Default    Policy            `yaml:"default"`
+	Namespaces map[string]Policy `yaml:"namespaces"`
+	Keys       map[string]Policy `yaml:"keys"`
+}
+
+// Scope is who a tool runs for: the id of the api key of the request and the
+// rag namespaces of the query.
+type Scope struct {
+	KeyID      string
+	Namespaces []string
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context whose tool queries are checked against the
+// policies of scope.
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFrom returns the scope set by WithScope, if any.
+func ScopeFrom(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+
+	return scope
+}
+
+// check tells whether every policy applying to scope allows the tool.
+func (p Policies) check(scope Scope, name string) error {
+	if !p.Default.allows(name) {
+		return fmt.Errorf("%w: %s", ErrDenied, name)
+	}
+
+	for _, ns := range scope.Namespaces {
+		if nsPolicy, ok := p.Namespaces[ns]; ok && !nsPolicy.allows(name) {
+			return fmt.Errorf("%w in namespace %s: %s", ErrDenied, ns, name)
+		}
+	}
+
+	if keyPolicy, ok := p.Keys[scope.KeyID]; ok && scope.KeyID != "" && !keyPolicy.allows(name) {
+		return fmt.Errorf("%w for key %s: %s", ErrDenied, scope.KeyID, name)
+	}
+
+	return nil
+}
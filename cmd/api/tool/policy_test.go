@@ -0,0 +1,37 @@
+package tool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPoliciesCheck(t *testing.T) {
+	p := Policies{
+		Default:    Policy{Deny: []string{"ping"}},
+		Namespaces: map[string]Policy{"publico": {Allow: []string{"date", "INCIDENT*"}}},
+		Keys:       map[string]Policy{"2b7e0c1a": {Deny: []string{"INCIDENT*"}}},
+	}
+
+	for _, tt := range []struct {
+		scope Scope
+		tool  string
+		allow bool
+	}{
+		{scope: Scope{}, tool: "ping", allow: false},
+		{scope: Scope{}, tool: "hostname", allow: true},
+		{scope: Scope{Namespaces: []string{"publico"}}, tool: "hostname", allow: false},
+		{scope: Scope{Namespaces: []string{"publico"}}, tool: "INCIDENT_COUNT", allow: true},
+		{scope: Scope{KeyID: "2b7e0c1a", Namespaces: []string{"publico"}}, tool: "INCIDENT_COUNT", allow: false},
+		// another key, as one made after revoking it under the same name, is not bound by it
+		{scope: Scope{KeyID: "9f3d5e77", Namespaces: []string{"publico"}}, tool: "INCIDENT_COUNT", allow: true},
+	} {
+		err := p.check(tt.scope, tt.tool)
+		if tt.allow && err != nil {
+			t.Errorf("%+v %s: %v", tt.scope, tt.tool, err)
+		}
+
+		if !tt.allow && !errors.Is(err, ErrDenied) {
+			t.Errorf("%+v %s: err = %v, want %v", tt.scope, tt.tool, err, ErrDenied)
+		}
+	}
+}
@@ -3,52 +3,375 @@ package tool
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	"gophercon-2025/cmd/api/sqldb"
 )
 
+// dbTool reads a KPI from the kpis table, every KPI has a dbTool of its own.
+// KPIs it is compared to are looked up in tools, so they are bound by the same
+// policies as when queried themselves.
 type dbTool struct {
-	db *sql.DB
+	tools   *Service
+	db      *sql.DB
+	dialect sqldb.Dialect
+	kpi     string
+	meta    Kpi
+}
+
+var kpiSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"ini": {
+			"type": "string",
+			"description": "inicio do periodo em RFC3339. Se a pergunta citar um mes, semana ou ano, o primeiro dia dele. Se nao houver periodo, 01-Jan do ano vigente"
+		},
+		"end": {
+			"type": "string",
+			"description": "fim do periodo em RFC3339. Se a pergunta citar um mes, semana ou ano, o ultimo dia dele. Se nao houver periodo, 31-Dez do ano vigente"
+		},
+		"agg": {
+			"type": "string",
+			"enum": ["", "sum", "avg", "min", "max", "count", "last"],
+			"description": "agregacao pedida: sum (soma, total), avg (media), min, max, count (quantidade de registros), last (valor mais recente). Vazio para listar os valores"
+		},
+		"group": {
+			"type": "string",
+			"enum": ["", "day", "week", "month", "quarter", "year"],
+			"description": "agrupamento da agregacao: day, week, month, quarter (trimestre) ou year. Vazio para um unico valor no periodo"
+		},
+		"compare_kpi": {
+			"type": "string",
+			"description": "outro indicador a comparar no mesmo periodo, se a pergunta pedir. Vazio caso contrario"
+		},
+		"compare_ini": {
+			"type": "string",
+			"description": "inicio em RFC3339 de outro periodo a comparar, se a pergunta pedir. Vazio caso contrario"
+		},
+		"compare_end": {
+			"type": "string",
+			"description": "fim em RFC3339 de outro periodo a comparar, se a pergunta pedir. Vazio caso contrario"
+		}
+	},
+	"required": ["ini", "end"]
+}`)
+
+// kpiAggs are the sql expressions of the supported aggregations. Only keys of
+// this map are ever written into a query. last is not an aggregate function in
+// every dialect, so it is queried apart.
+var kpiAggs = map[string]string{
+	"sum":   "SUM(value)",
+	"avg":   "AVG(value)",
+	"min":   "MIN(value)",
+	"max":   "MAX(value)",
+	"count": "COUNT(value)",
+	"last":  "",
+}
+
+var kpiAggLabels = map[string]string{
+	"sum":   "Soma",
+	"avg":   "Média",
+	"min":   "Mínimo",
+	"max":   "Máximo",
+	"count": "Quantidade de registros",
+	"last":  "Último valor",
+}
+
+// kpiGroups maps the supported groupings to their name and the layout of
+// their period labels.
+var kpiGroups = map[string]struct {
+	name   string
+	layout string
+}{
+	"day":     {"dia", "02-01-2006"},
+	"week":    {"semana", "semana de 02-01-2006"},
+	"month":   {"mês", "01-2006"},
+	"quarter": {"trimestre", ""},
+	"year":    {"ano", "2006"},
+}
+
+func (d dbTool) Name() string { return d.kpi }
+
+func (d dbTool) Description() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("valores do indicador (KPI) %s por data", d.kpi))
+
+	if d.meta.DisplayName != "" {
+		sb.WriteString(" - " + d.meta.DisplayName)
+	}
+
+	if d.meta.Unit != "" {
+		sb.WriteString(" em " + d.meta.Unit)
+	}
+
+	if d.meta.Description != "" {
+		sb.WriteString(": " + d.meta.Description)
+	}
+
+	sb.WriteString(", com soma, media, minimo, maximo e comparações entre periodos")
+
+	return sb.String()
+}
+
+func (d dbTool) Schema() json.RawMessage { return kpiSchema }
+
+func parseDate(s string) (time.Time, error) {
+	ret, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	return ret, nil
+}
+
+// kpiQuery is a KPI aggregated over a period, grouped when group is set.
+type kpiQuery struct {
+	kpi   string
+	ini   time.Time
+	end   time.Time
+	agg   string
+	group string
+}
+
+func (q kpiQuery) label() string {
+	return fmt.Sprintf("%s de %s entre %s e %s", kpiAggLabels[q.agg], q.kpi, q.ini.Format("02-01-2006"), q.end.Format("02-01-2006"))
+}
+
+type kpiPoint struct {
+	period time.Time
+	value  float64
+	ok     bool
 }
 
 func (d dbTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
-	iniStr := params["ini"]
-	endStr := params["end"]
-	toolName := params["tool"]
+	q := kpiQuery{
+		kpi:   params["tool"],
+		agg:   strings.ToLower(params["agg"]),
+		group: strings.ToLower(params["group"]),
+	}
+
+	if q.ini, err = parseDate(params["ini"]); err != nil {
+		return "", err
+	}
+
+	if q.end, err = parseDate(params["end"]); err != nil {
+		return "", err
+	}
+
+	compareKpi := params["compare_kpi"]
+	compareIni, compareEnd := params["compare_ini"], params["compare_end"]
+
+	if q.agg == "" && q.group == "" && compareKpi == "" && compareIni == "" {
+		return d.list(ctx, q)
+	}
+
+	if q.agg == "" {
+		q.agg = "sum"
+	}
+
+	if _, ok := kpiAggs[q.agg]; !ok {
+		return "", fmt.Errorf("unknown aggregation: %s", q.agg)
+	}
+
+	if _, ok := kpiGroups[q.group]; !ok && q.group != "" {
+		return "", fmt.Errorf("unknown grouping: %s", q.group)
+	}
 
-	iniDt, err := time.Parse(time.RFC3339, iniStr)
+	points, err := d.aggregate(ctx, q)
 	if err != nil {
-		iniDt, err = time.Parse(time.RFC3339Nano, iniStr)
-		if err != nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(formatKpi(q, points))
+
+	others := []kpiQuery{}
+
+	if compareKpi != "" {
+		if err = d.comparable(ctx, compareKpi); err != nil {
 			return "", err
 		}
+
+		other := q
+		other.kpi = compareKpi
+		others = append(others, other)
 	}
 
-	endDt, err := time.Parse(time.RFC3339, endStr)
-	if err != nil {
-		endDt, err = time.Parse(time.RFC3339Nano, endStr)
+	if compareIni != "" || compareEnd != "" {
+		other := q
+
+		if other.ini, err = parseDate(compareIni); err != nil {
+			return "", err
+		}
+
+		if other.end, err = parseDate(compareEnd); err != nil {
+			return "", err
+		}
+
+		others = append(others, other)
+	}
+
+	for _, other := range others {
+		otherPoints, err := d.aggregate(ctx, other)
 		if err != nil {
 			return "", err
 		}
+
+		sb.WriteString("\n" + formatKpi(other, otherPoints))
+
+		if q.group == "" {
+			sb.WriteString(formatComparison(points[0], otherPoints[0]))
+		}
 	}
 
-	rows, err := d.db.QueryContext(ctx,
-		"SELECT dt,value FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3 order by dt",
-		toolName, iniDt, endDt)
+	return sb.String(), nil
+}
+
+// comparable tells whether kpi is a registered KPI the scope of ctx may query.
+func (d dbTool) comparable(ctx context.Context, kpi string) error {
+	t, err := d.tools.lookup(ctx, kpi)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if rows.Err() != nil {
-		return "", err
+	if _, ok := t.(*dbTool); !ok {
+		return fmt.Errorf("%w: %s is not a kpi", ErrUnknownTool, kpi)
+	}
+
+	return nil
+}
+
+// aggregate runs the aggregation in the db. Without a group it returns a
+// single point, not ok when the period has no values.
+func (d dbTool) aggregate(ctx context.Context, q kpiQuery) ([]kpiPoint, error) {
+	ini, end := timeArg(d.dialect, q.ini), timeArg(d.dialect, q.end)
+
+	if q.group == "" {
+		query := "SELECT " + kpiAggs[q.agg] + " FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3"
+		if q.agg == "last" {
+			query = "SELECT value FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3 ORDER BY dt DESC LIMIT 1"
+		}
+
+		var val sql.NullFloat64
+
+		err := d.db.QueryRowContext(ctx, query, q.kpi, ini, end).Scan(&val)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		return []kpiPoint{{value: val.Float64, ok: val.Valid}}, nil
 	}
 
+	period := periodExpr(d.dialect, q.group)
+
+	query := "SELECT " + period + " AS period, " + kpiAggs[q.agg] +
+		" FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3 GROUP BY period ORDER BY period"
+	if q.agg == "last" {
+		query = "SELECT period, value FROM (SELECT " + period + " AS period, value, " +
+			"ROW_NUMBER() OVER (PARTITION BY " + period + " ORDER BY dt DESC) AS rn " +
+			"FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3) latest WHERE rn = 1 ORDER BY period"
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, q.kpi, ini, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []kpiPoint
+
+	for rows.Next() {
+		var (
+			p      kpiPoint
+			period string
+		)
+
+		if err = rows.Scan(&period, &p.value); err != nil {
+			return nil, err
+		}
+
+		if p.period, err = time.Parse(time.DateOnly, period); err != nil {
+			return nil, err
+		}
+
+		p.ok = true
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+func periodLabel(group string, period time.Time) string {
+	if group == "quarter" {
+		return fmt.Sprintf("T%d-%d", (int(period.Month())-1)/3+1, period.Year())
+	}
+
+	return period.Format(kpiGroups[group].layout)
+}
+
+func formatKpi(q kpiQuery, points []kpiPoint) string {
+	if q.group == "" {
+		if !points[0].ok {
+			return q.label() + ": sem valores no periodo"
+		}
+
+		return fmt.Sprintf("%s: %s", q.label(), formatValue(points[0].value))
+	}
+
+	if len(points) == 0 {
+		return q.label() + " por " + kpiGroups[q.group].name + ": sem valores no periodo"
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(q.label() + " por " + kpiGroups[q.group].name + ": ")
+
+	for i, p := range points {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+
+		sb.WriteString(fmt.Sprintf("%s: %s", periodLabel(q.group, p.period), formatValue(p.value)))
+	}
+
+	return sb.String()
+}
+
+func formatComparison(a, b kpiPoint) string {
+	if !a.ok || !b.ok {
+		return ""
+	}
+
+	diff := a.value - b.value
+
+	if b.value == 0 {
+		return fmt.Sprintf(" (diferença: %s)", formatValue(diff))
+	}
+
+	return fmt.Sprintf(" (diferença: %s, variação: %+.1f%%)", formatValue(diff), diff/b.value*100)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// list returns the raw values of the period, when no aggregation was asked.
+func (d dbTool) list(ctx context.Context, q kpiQuery) (ret string, err error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT dt,value FROM kpis WHERE kpi = $1 and dt >= $2 and dt <= $3 order by dt",
+		q.kpi, timeArg(d.dialect, q.ini), timeArg(d.dialect, q.end))
+	if err != nil {
+		return "", err
+	}
 	defer rows.Close()
 
 	sb := strings.Builder{}
 
-	sb.WriteString(fmt.Sprintf("Valores para %s por data: ", toolName))
+	sb.WriteString(fmt.Sprintf("Valores para %s por data: ", q.kpi))
 
 	for rows.Next() {
 		var val float64
@@ -62,5 +385,9 @@ func (d dbTool) Query(ctx context.Context, params map[string]string) (ret string
 		sb.WriteString(fmt.Sprintf("%s: %v, ", dt.Format("02-01-2006"), val))
 	}
 
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
 	return strings.TrimSuffix(sb.String(), ", "), nil
 }
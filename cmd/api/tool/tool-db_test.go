@@ -0,0 +1,279 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"gophercon-2025/cmd/api/sqldb"
+)
+
+// newTestKpis returns a service on an in-memory db holding VENDAS, besides the
+// INCIDENTS of 2024 the migrations seed.
+func newTestKpis(t *testing.T) *Service {
+	t.Helper()
+
+	db, dialect, err := sqldb.Open("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	s := New(WithTracer(noop.NewTracerProvider().Tracer("")), WithDb(db, dialect))
+
+	var points []Point
+
+	for _, p := range []struct {
+		dt    string
+		value float64
+	}{
+		{"2025-01-06", 10},
+		{"2025-01-08", 20},
+		{"2025-01-13", 6},
+		{"2025-02-03", 30},
+		{"2025-04-01", 40},
+	} {
+		dt, err := time.Parse(time.DateOnly, p.dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		points = append(points, Point{Kpi: "VENDAS", Dt: dt, Value: p.value})
+	}
+
+	if err = s.UpsertPoints(context.Background(), points); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func day(s string) time.Time {
+	ret, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ret
+}
+
+func TestKpiAggregate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestKpis(t)
+
+	d, ok := s.tools["VENDAS"].(*dbTool)
+	if !ok {
+		t.Fatal("VENDAS has no tool")
+	}
+
+	// periods are the first day of each group, values by agg
+	for _, tt := range []struct {
+		group   string
+		periods []string
+		values  map[string][]float64
+	}{
+		{
+			group: "",
+			values: map[string][]float64{
+				"sum": {106}, "avg": {21.2}, "min": {6}, "max": {40}, "count": {5}, "last": {40},
+			},
+		},
+		{
+			group:   "day",
+			periods: []string{"2025-01-06", "2025-01-08", "2025-01-13", "2025-02-03", "2025-04-01"},
+			values: map[string][]float64{
+				"sum":   {10, 20, 6, 30, 40},
+				"avg":   {10, 20, 6, 30, 40},
+				"min":   {10, 20, 6, 30, 40},
+				"max":   {10, 20, 6, 30, 40},
+				"count": {1, 1, 1, 1, 1},
+				"last":  {10, 20, 6, 30, 40},
+			},
+		},
+		{
+			// weeks start on monday, 2025-04-01 is a tuesday
+			group:   "week",
+			periods: []string{"2025-01-06", "2025-01-13", "2025-02-03", "2025-03-31"},
+			values: map[string][]float64{
+				"sum":   {30, 6, 30, 40},
+				"avg":   {15, 6, 30, 40},
+				"min":   {10, 6, 30, 40},
+				"max":   {20, 6, 30, 40},
+				"count": {2, 1, 1, 1},
+				"last":  {20, 6, 30, 40},
+			},
+		},
+		{
+			group:   "month",
+			periods: []string{"2025-01-01", "2025-02-01", "2025-04-01"},
+			values: map[string][]float64{
+				"sum":   {36, 30, 40},
+				"avg":   {12, 30, 40},
+				"min":   {6, 30, 40},
+				"max":   {20, 30, 40},
+				"count": {3, 1, 1},
+				"last":  {6, 30, 40},
+			},
+		},
+		{
+			group:   "quarter",
+			periods: []string{"2025-01-01", "2025-04-01"},
+			values: map[string][]float64{
+				"sum":   {66, 40},
+				"avg":   {16.5, 40},
+				"min":   {6, 40},
+				"max":   {30, 40},
+				"count": {4, 1},
+				"last":  {30, 40},
+			},
+		},
+		{
+			group:   "year",
+			periods: []string{"2025-01-01"},
+			values: map[string][]float64{
+				"sum": {106}, "avg": {21.2}, "min": {6}, "max": {40}, "count": {5}, "last": {40},
+			},
+		},
+	} {
+		for agg := range kpiAggs {
+			t.Run(tt.group+" "+agg, func(t *testing.T) {
+				q := kpiQuery{kpi: "VENDAS", ini: day("2025-01-01"), end: day("2025-12-31"), agg: agg, group: tt.group}
+
+				points, err := d.aggregate(ctx, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var (
+					periods []string
+					values  []float64
+				)
+
+				for _, p := range points {
+					if !p.ok {
+						t.Fatalf("point not ok: %+v", p)
+					}
+
+					if tt.group != "" {
+						periods = append(periods, p.period.Format(time.DateOnly))
+					}
+
+					values = append(values, p.value)
+				}
+
+				if !slices.Equal(periods, tt.periods) {
+					t.Errorf("periods %v, want %v", periods, tt.periods)
+				}
+
+				if !slices.Equal(values, tt.values[agg]) {
+					t.Errorf("values %v, want %v", values, tt.values[agg])
+				}
+			})
+		}
+
+		t.Run(tt.group+" empty period", func(t *testing.T) {
+			q := kpiQuery{kpi: "VENDAS", ini: day("2023-01-01"), end: day("2023-12-31"), agg: "sum", group: tt.group}
+
+			points, err := d.aggregate(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.group == "" && (len(points) != 1 || points[0].ok) {
+				t.Fatalf("got %+v, want a single point not ok", points)
+			}
+
+			if tt.group != "" && len(points) != 0 {
+				t.Fatalf("got %+v, want no points", points)
+			}
+
+			if got := formatKpi(q, points); !strings.HasSuffix(got, "sem valores no periodo") {
+				t.Fatalf("got %q", got)
+			}
+		})
+	}
+}
+
+func TestKpiCompare(t *testing.T) {
+	ctx := context.Background()
+	s := newTestKpis(t)
+
+	query := func(ctx context.Context, compare string) (string, error) {
+		return s.Query(ctx, "VENDAS", map[string]string{
+			"ini":         "2024-01-01T00:00:00Z",
+			"end":         "2025-12-31T00:00:00Z",
+			"agg":         "sum",
+			"compare_kpi": compare,
+		})
+	}
+
+	got, err := query(ctx, "INCIDENTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Soma de VENDAS entre 01-01-2024 e 31-12-2025: 106\n" +
+		"Soma de INCIDENTS entre 01-01-2024 e 31-12-2025: 66 (diferença: 40, variação: +60.6%)"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	for _, compare := range []string{"NOPE", "date"} {
+		if _, err = query(ctx, compare); !errors.Is(err, ErrUnknownTool) {
+			t.Errorf("compared to %s: err = %v, want %v", compare, err, ErrUnknownTool)
+		}
+	}
+
+	s.policies = Policies{Keys: map[string]Policy{"2b7e0c1a": {Deny: []string{"INCIDENTS"}}}}
+
+	if _, err = query(WithScope(ctx, Scope{KeyID: "2b7e0c1a"}), "INCIDENTS"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("err = %v, want %v", err, ErrDenied)
+	}
+
+	// the policy is of that key only
+	if _, err = query(ctx, "INCIDENTS"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKpiNameClash(t *testing.T) {
+	ctx := context.Background()
+	s := newTestKpis(t)
+
+	if err := s.SaveKpi(ctx, Kpi{Kpi: "date"}); !errors.Is(err, ErrKpiInvalid) {
+		t.Fatalf("save: err = %v, want %v", err, ErrKpiInvalid)
+	}
+
+	err := s.UpsertPoints(ctx, []Point{{Kpi: "VENDAS", Dt: day("2025-05-01"), Value: 1}, {Kpi: "date", Dt: day("2025-05-01"), Value: 1}})
+	if !errors.Is(err, ErrKpiInvalid) {
+		t.Fatalf("upsert: err = %v, want %v", err, ErrKpiInvalid)
+	}
+
+	// nothing is written when a name is refused
+	points, err := s.Series(ctx, "VENDAS", day("2025-05-01"), day("2025-05-01"))
+	if err != nil || len(points) != 0 {
+		t.Fatalf("got %v %v, want no points", points, err)
+	}
+
+	// a clash already in the db leaves the tool in place instead of failing
+	_, err = s.db.ExecContext(ctx, "INSERT INTO kpis (kpi, dt, value) VALUES ('date', '2025-05-01 00:00:00', 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := New(WithDb(s.db, s.dialect))
+
+	if _, ok := restarted.tools["date"].(*dateTool); !ok {
+		t.Fatalf("date is %T, want the built-in tool", restarted.tools["date"])
+	}
+
+	if _, ok := restarted.tools["VENDAS"].(*dbTool); !ok {
+		t.Fatal("VENDAS has no tool")
+	}
+}
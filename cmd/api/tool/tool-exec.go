@@ -0,0 +1,81 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// execTool runs a local executable defined in the tools file.
+type execTool struct {
+	configTool
+	cfg  ExecConfig
+	args []*template.Template
+}
+
+func newExecTool(base configTool, cfg ExecConfig) (*execTool, error) {
+	if cfg.Command == "" {
+		return nil, errors.New("exec command is required")
+	}
+
+	ret := &execTool{configTool: base, cfg: cfg}
+
+	for i, arg := range cfg.Args {
+		t, err := parseTemplate(fmt.Sprintf("arg%d", i), arg)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.args = append(ret.args, t)
+	}
+
+	return ret, nil
+}
+
+// passEnv returns the variables of the api environment named in names, the
+// only ones passed on to the processes started by tools.
+func passEnv(names []string) []string {
+	ret := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			ret = append(ret, name+"="+v)
+		}
+	}
+
+	return ret
+}
+
+func (e *execTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	args := make([]string, 0, len(e.args))
+
+	for _, t := range e.args {
+		arg, err := render(t, params)
+		if err != nil {
+			return "", err
+		}
+
+		args = append(args, arg)
+	}
+
+	out := &cappedBuffer{max: maxConfigRead}
+
+	cmd := exec.CommandContext(ctx, e.cfg.Command, args...)
+	cmd.Env = passEnv(e.cfg.Env)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		return "", fmt.Errorf("%s: %w: %s", e.name, err, strings.TrimSpace(out.String()))
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,130 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// httpTool calls an http endpoint defined in the tools file.
+type httpTool struct {
+	configTool
+	cfg     HttpConfig
+	url     *template.Template
+	body    *template.Template
+	extract []pathStep
+	client  *http.Client
+}
+
+func newHttpTool(base configTool, cfg HttpConfig) (*httpTool, error) {
+	if cfg.Url == "" {
+		return nil, errors.New("http url is required")
+	}
+
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+
+	ret := &httpTool{
+		configTool: base,
+		cfg:        cfg,
+		client:     &http.Client{},
+	}
+
+	var err error
+
+	if ret.url, err = parseTemplate("url", cfg.Url); err != nil {
+		return nil, err
+	}
+
+	if ret.body, err = parseTemplate("body", cfg.Body); err != nil {
+		return nil, err
+	}
+
+	if cfg.Extract != "" {
+		if ret.extract, err = parseJsonPath(cfg.Extract); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// escapeParams escapes every param for the url, spaces and reserved
+// characters included, so it is valid both in the path and in the query.
+func escapeParams(params map[string]string) map[string]string {
+	ret := make(map[string]string, len(params))
+	for k, v := range params {
+		ret[k] = strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+	}
+
+	return ret
+}
+
+func (h *httpTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	target, err := render(h.url, escapeParams(params))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := render(h.body, params)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.cfg.Method, target, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	out := &cappedBuffer{max: maxConfigRead}
+	if _, err = io.Copy(out, res.Body); err != nil {
+		return "", err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("%s: http status %d: %s", h.name, res.StatusCode, strings.TrimSpace(out.String()))
+	}
+
+	if h.extract == nil {
+		return strings.TrimSpace(out.String()), nil
+	}
+
+	if out.truncated {
+		return "", fmt.Errorf("%s: response larger than %d bytes can't be extracted", h.name, maxConfigRead)
+	}
+
+	var doc any
+	if err = json.Unmarshal(out.buf.Bytes(), &doc); err != nil {
+		return "", err
+	}
+
+	found, err := evalJsonPath(doc, h.extract)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %w", h.name, h.cfg.Extract, err)
+	}
+
+	if s, ok := found.(string); ok {
+		return s, nil
+	}
+
+	bs, err := json.Marshal(found)
+
+	return string(bs), err
+}
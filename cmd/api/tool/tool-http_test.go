@@ -0,0 +1,48 @@
+package tool
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpToolEscapesUrl(t *testing.T) {
+	var gotPath, gotQuery, gotBody string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+
+		gotPath, gotQuery, gotBody = r.URL.EscapedPath(), r.URL.Query().Get("q"), string(bs)
+	}))
+	defer srv.Close()
+
+	h, err := newHttpTool(configTool{name: "busca"}, HttpConfig{
+		Method: http.MethodPost,
+		Url:    srv.URL + "/itens/{{.id}}?q={{.q}}",
+		Body:   `{"q": {{json .q}}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = h.Query(context.Background(), map[string]string{
+		"id": "../admin",
+		"q":  `a b&c=d "e"`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/itens/..%2Fadmin"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+
+	if want := `a b&c=d "e"`; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+
+	if want := `{"q": "a b\u0026c=d \"e\""}`; gotBody != want {
+		t.Errorf("body = %q, want %q", gotBody, want)
+	}
+}
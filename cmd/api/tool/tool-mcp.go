@@ -0,0 +1,455 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var errMcpDisconnected = errors.New("mcp server disconnected")
+
+// McpConfig imports the tools of an mcp server, started as a subprocess
+// talking over stdio when Command is set, or reached at Url over streamable
+// http. Header values may reference the api environment as $VAR. Prefix is
+// prepended to the names of the imported tools, to tell apart tools of the
+// same name.
+type McpConfig struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     []string          `yaml:"env"`
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Prefix  string            `yaml:"prefix"`
+}
+
+func (mc McpConfig) validate() error {
+	switch {
+	case mc.Name == "":
+		return errors.New("name is required")
+	case mc.Command != "" && mc.Url != "":
+		return errors.New("command and url are mutually exclusive")
+	case mc.Command == "" && mc.Url == "":
+		return errors.New("either command or url is required")
+	}
+
+	return nil
+}
+
+//nolint:ireturn
+func (mc McpConfig) transport() gomcp.Transport {
+	if mc.Command != "" {
+		cmd := exec.Command(mc.Command, mc.Args...)
+		cmd.Env = passEnv(mc.Env)
+		cmd.Stderr = os.Stderr
+
+		return &gomcp.CommandTransport{Command: cmd}
+	}
+
+	return &gomcp.StreamableClientTransport{
+		Endpoint:   mc.Url,
+		HTTPClient: &http.Client{Transport: &mcpHeaders{headers: mc.Headers, base: http.DefaultTransport}},
+	}
+}
+
+// mcpHeaders adds the configured headers and the trace context to the
+// requests sent to an mcp server.
+type mcpHeaders struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (h *mcpHeaders) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	for k, v := range h.headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+
+	return h.base.RoundTrip(req)
+}
+
+// mcpServer is a connection to an mcp server. owned is guarded by the
+// registry lock, like the other owned sets.
+type mcpServer struct {
+	cfg   McpConfig
+	owned map[string]bool
+
+	mu      sync.RWMutex
+	session *gomcp.ClientSession
+}
+
+func (m *mcpServer) current() *gomcp.ClientSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.session
+}
+
+// detach forgets session, telling whether it was still the current one.
+func (m *mcpServer) detach(session *gomcp.ClientSession) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.session != session {
+		return false
+	}
+
+	m.session = nil
+
+	return true
+}
+
+// syncMcp connects to the mcp servers of the tools file. Servers whose
+// config did not change keep their connection, the ones gone or changed are
+// closed and their tools unregistered. Servers that can't be reached are
+// retried by Watch.
+func (s *Service) syncMcp(ctx context.Context, cfgs []McpConfig) {
+	s.mcpMu.Lock()
+	defer s.mcpMu.Unlock()
+
+	wanted := make(map[string]McpConfig, len(cfgs))
+	for _, mc := range cfgs {
+		wanted[mc.Name] = mc
+	}
+
+	for name, srv := range s.mcpServers {
+		if mc, ok := wanted[name]; ok && reflect.DeepEqual(mc, srv.cfg) {
+			continue
+		}
+
+		s.closeMcp(srv)
+		delete(s.mcpServers, name)
+	}
+
+	for name, mc := range wanted {
+		if _, ok := s.mcpServers[name]; ok {
+			continue
+		}
+
+		srv := &mcpServer{cfg: mc, owned: map[string]bool{}}
+		s.mcpServers[name] = srv
+
+		if _, err := s.connectMcp(ctx, srv); err != nil {
+			slog.Warn("Failed to connect to mcp server", "server", name, "err", err)
+		}
+	}
+}
+
+// reconnectMcp retries the mcp servers not connected.
+func (s *Service) reconnectMcp(ctx context.Context) {
+	s.mcpMu.Lock()
+	defer s.mcpMu.Unlock()
+
+	changed := false
+
+	for name, srv := range s.mcpServers {
+		if srv.current() != nil {
+			continue
+		}
+
+		srvChanged, err := s.connectMcp(ctx, srv)
+		if err != nil {
+			slog.Debug("Mcp server still unreachable", "server", name, "err", err)
+			continue
+		}
+
+		slog.Info("Mcp server reconnected", "server", name)
+
+		changed = changed || srvChanged
+	}
+
+	if changed {
+		s.changed(ctx)
+	}
+}
+
+// mcpTimeout bounds connecting to an mcp server and listing its tools, also
+// when tools may run with no timeout.
+func (s *Service) mcpTimeout() time.Duration {
+	if s.timeout <= 0 {
+		return DefaultTimeout
+	}
+
+	return s.timeout
+}
+
+// connectMcp opens a session to srv and imports its tools. When the session
+// ends on the server side the tools are unregistered, until Watch reconnects.
+func (s *Service) connectMcp(ctx context.Context, srv *mcpServer) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.mcpTimeout())
+	defer cancel()
+
+	client := gomcp.NewClient(&gomcp.Implementation{Name: "gophercon-2025", Version: "1.0.0"}, &gomcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *gomcp.ToolListChangedRequest) {
+			// the notification is handled on the session's read loop, which
+			// the list call needs free
+			go s.refreshMcp(srv)
+		},
+	})
+
+	session, err := client.Connect(ctx, srv.cfg.transport(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	srv.mu.Lock()
+	srv.session = session
+	srv.mu.Unlock()
+
+	go func() {
+		err := session.Wait()
+
+		if srv.detach(session) {
+			slog.Warn("Mcp server disconnected", "server", srv.cfg.Name, "err", err)
+			s.unregisterMcp(context.Background(), srv)
+		}
+	}()
+
+	changed, err := s.importMcp(ctx, srv)
+	if err != nil {
+		if srv.detach(session) {
+			session.Close()
+		}
+
+		return false, err
+	}
+
+	return changed, nil
+}
+
+// closeMcp ends the session to srv and unregisters its tools.
+func (s *Service) closeMcp(srv *mcpServer) {
+	if session := srv.current(); session != nil && srv.detach(session) {
+		if err := session.Close(); err != nil {
+			slog.Debug("Failed to close mcp session", "server", srv.cfg.Name, "err", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replaceOwned(s.tools, &srv.owned, nil)
+}
+
+func (s *Service) unregisterMcp(ctx context.Context, srv *mcpServer) {
+	s.mu.Lock()
+	changed := replaceOwned(s.tools, &srv.owned, nil)
+	s.mu.Unlock()
+
+	if changed {
+		s.changed(ctx)
+	}
+}
+
+// refreshMcp imports the tools of srv again, after it announced they changed.
+func (s *Service) refreshMcp(srv *mcpServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.mcpTimeout())
+	defer cancel()
+
+	changed, err := s.importMcp(ctx, srv)
+	if err != nil {
+		slog.Warn("Failed to refresh mcp tools", "server", srv.cfg.Name, "err", err)
+		return
+	}
+
+	if changed {
+		s.changed(ctx)
+	}
+}
+
+// importMcp registers the tools srv lists in place of the ones it had. It
+// tells whether the descriptors changed.
+func (s *Service) importMcp(ctx context.Context, srv *mcpServer) (bool, error) {
+	session := srv.current()
+	if session == nil {
+		return false, fmt.Errorf("%w: %s", errMcpDisconnected, srv.cfg.Name)
+	}
+
+	var tools []Tool
+
+	for t, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return false, err
+		}
+
+		tools = append(tools, newMcpTool(srv, t))
+	}
+
+	s.mu.Lock()
+	changed := replaceOwned(s.tools, &srv.owned, tools)
+	s.mu.Unlock()
+
+	slog.Info("Mcp tools imported", "server", srv.cfg.Name, "tools", len(tools))
+
+	return changed, nil
+}
+
+// Close ends the sessions to the mcp servers, stopping the ones started as
+// subprocesses.
+func (s *Service) Close() error {
+	s.mcpMu.Lock()
+	defer s.mcpMu.Unlock()
+
+	for name, srv := range s.mcpServers {
+		s.closeMcp(srv)
+		delete(s.mcpServers, name)
+	}
+
+	return nil
+}
+
+// mcpTool is a tool of an mcp server, called through its session.
+type mcpTool struct {
+	server      *mcpServer
+	name        string
+	remote      string
+	description string
+	schema      json.RawMessage
+}
+
+func newMcpTool(srv *mcpServer, t *gomcp.Tool) *mcpTool {
+	schema, err := json.Marshal(t.InputSchema)
+	if err != nil || t.InputSchema == nil {
+		schema = noParams
+	}
+
+	return &mcpTool{
+		server:      srv,
+		name:        srv.cfg.Prefix + t.Name,
+		remote:      t.Name,
+		description: t.Description,
+		schema:      schema,
+	}
+}
+
+func (m *mcpTool) Name() string { return m.name }
+
+func (m *mcpTool) Description() string { return m.description }
+
+func (m *mcpTool) Schema() json.RawMessage { return m.schema }
+
+func (m *mcpTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	session := m.server.current()
+	if session == nil {
+		return "", fmt.Errorf("%w: %s", errMcpDisconnected, m.server.cfg.Name)
+	}
+
+	args, err := mcpArgs(m.schema, params)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := session.CallTool(ctx, &gomcp.CallToolParams{Name: m.remote, Arguments: args})
+	if err != nil {
+		return "", err
+	}
+
+	ret, err = mcpText(res)
+	if err != nil {
+		return "", err
+	}
+
+	if res.IsError {
+		return "", fmt.Errorf("%s: %s", m.name, ret)
+	}
+
+	return ret, nil
+}
+
+// mcpArgs turns the string params extracted by the llm into the arguments
+// the schema declares, converting numbers, booleans, arrays and objects.
+// Params the schema does not declare and empty ones are left out.
+func mcpArgs(schema json.RawMessage, params map[string]string) (map[string]any, error) {
+	var s struct {
+		Properties map[string]struct {
+			Type json.RawMessage `json:"type"`
+		} `json:"properties"`
+	}
+
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, err
+	}
+
+	ret := map[string]any{}
+
+	for name, prop := range s.Properties {
+		v, ok := params[name]
+		if !ok || v == "" {
+			continue
+		}
+
+		var typ string
+		_ = json.Unmarshal(prop.Type, &typ)
+
+		var err error
+
+		switch typ {
+		case "integer":
+			ret[name], err = strconv.ParseInt(v, 10, 64)
+		case "number":
+			ret[name], err = strconv.ParseFloat(v, 64)
+		case "boolean":
+			ret[name], err = strconv.ParseBool(v)
+		case "array", "object":
+			var decoded any
+			err = json.Unmarshal([]byte(v), &decoded)
+			ret[name] = decoded
+		default:
+			ret[name] = v
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("param %s: invalid %s: %s", name, typ, v)
+		}
+	}
+
+	return ret, nil
+}
+
+// mcpText renders the content of a result as text. Content other than text
+// is passed on as json.
+func mcpText(res *gomcp.CallToolResult) (string, error) {
+	parts := make([]string, 0, len(res.Content))
+
+	for _, c := range res.Content {
+		if text, ok := c.(*gomcp.TextContent); ok {
+			parts = append(parts, text.Text)
+			continue
+		}
+
+		bs, err := json.Marshal(c)
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, string(bs))
+	}
+
+	if len(parts) == 0 && res.StructuredContent != nil {
+		bs, err := json.Marshal(res.StructuredContent)
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, string(bs))
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
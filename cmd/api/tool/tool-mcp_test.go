@@ -0,0 +1,122 @@
+package tool
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// buildMcpStub builds cmd/mcp-stub, the fake mcp server.
+func buildMcpStub(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	bin := filepath.Join(t.TempDir(), "mcp-stub")
+
+	out, err := exec.Command("go", "build", "-o", bin, "gophercon-2025/cmd/mcp-stub").CombinedOutput()
+	if err != nil {
+		t.Fatalf("building mcp-stub: %v\n%s", err, out)
+	}
+
+	return bin
+}
+
+// eventually polls cond until it holds or a few seconds pass.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestMcpStub(t *testing.T) {
+	ctx := context.Background()
+	bin := buildMcpStub(t)
+
+	s := New(WithTracer(noop.NewTracerProvider().Tracer("")))
+	defer s.Close()
+
+	var changes atomic.Int64
+
+	s.OnChange(func(context.Context) error {
+		changes.Add(1)
+		return nil
+	})
+
+	registered := func(name string) bool {
+		_, ok := s.Describe(name)
+		return ok
+	}
+
+	s.syncMcp(ctx, []McpConfig{{
+		Name:    "servicedesk",
+		Command: bin,
+		Args:    []string{"--churn", "200ms"},
+		Prefix:  "sd_",
+	}})
+
+	for _, name := range []string{"sd_ticket_status", "sd_stock_level"} {
+		if !registered(name) {
+			t.Fatalf("%s was not imported", name)
+		}
+	}
+
+	ret, err := s.Query(ctx, "sd_ticket_status", map[string]string{"id": "INC-1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(ret, "time-infra") {
+		t.Fatalf("unexpected ticket: %s", ret)
+	}
+
+	t.Run("tool list changed", func(t *testing.T) {
+		eventually(t, "the churned tool to be imported", func() bool { return registered("sd_stock_audit") })
+		eventually(t, "the churned tool to be removed", func() bool { return !registered("sd_stock_audit") })
+
+		if changes.Load() < 2 {
+			t.Fatalf("%d change hooks ran, want the import and the removal", changes.Load())
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		s.mcpMu.Lock()
+		srv := s.mcpServers["servicedesk"]
+		s.mcpMu.Unlock()
+
+		// the session ending unregisters the tools, as when the server dies
+		if err := srv.current().Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		eventually(t, "the tools to be unregistered", func() bool { return !registered("sd_ticket_status") })
+
+		if _, err := s.Query(ctx, "sd_ticket_status", map[string]string{"id": "INC-1001"}); err == nil {
+			t.Fatal("tool of a disconnected server ran")
+		}
+
+		s.reconnectMcp(ctx)
+
+		if !registered("sd_ticket_status") {
+			t.Fatal("tools were not imported again")
+		}
+
+		if _, err := s.Query(ctx, "sd_stock_level", map[string]string{"item": "monitor"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
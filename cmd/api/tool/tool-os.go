@@ -2,50 +2,323 @@ package tool
 
 import (
 	"context"
-	"os/exec"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
 	"strings"
+	"time"
 )
 
+var errUnsupported = errors.New("not supported on this platform")
+
+// compact renders the structured result of the os tools, the fewer tokens
+// the better.
+func compact(prefix string, v any) (string, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + ": " + string(bs), nil
+}
+
+func humanBytes(n uint64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func percent(part, total uint64) string {
+	if total == 0 {
+		return "0%"
+	}
+
+	return fmt.Sprintf("%.0f%%", float64(part)/float64(total)*100)
+}
+
 type hostnameTool struct{}
 
+func (h hostnameTool) Name() string { return "hostname" }
+
+func (h hostnameTool) Description() string { return "nome do host (hostname) da maquina" }
+
+func (h hostnameTool) Schema() json.RawMessage { return noParams }
+
 func (h hostnameTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
-	bs, err := exec.CommandContext(ctx, "hostname").CombinedOutput()
+	name, err := os.Hostname()
 	if err != nil {
 		return "", err
 	}
 
-	return "Seu hostname é: " + strings.TrimSpace(string(bs)), nil
+	return "Seu hostname é: " + name, nil
 }
 
 type ifconfigTool struct{}
 
+func (h ifconfigTool) Name() string { return "ifconfig" }
+
+func (h ifconfigTool) Description() string {
+	return "configurações de rede e endereço ip da maquina"
+}
+
+func (h ifconfigTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"name": {
+			"type": "string",
+			"description": "nome da interface de rede, ex eth0. Vazio para todas"
+		}
+	}
+}`)
+}
+
+type netInterface struct {
+	Name  string   `json:"name"`
+	Mac   string   `json:"mac,omitempty"`
+	Up    bool     `json:"up"`
+	Mtu   int      `json:"mtu"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
 func (h ifconfigTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
-	bs, err := exec.CommandContext(ctx, "ifconfig").CombinedOutput()
+	ifaces, err := net.Interfaces()
 	if err != nil {
 		return "", err
 	}
 
-	return "As configurações de rede e ip são: " + strings.TrimSpace(string(bs)), nil
+	list := make([]netInterface, 0, len(ifaces))
+
+	for _, iface := range ifaces {
+		if params["name"] != "" && iface.Name != params["name"] {
+			continue
+		}
+
+		item := netInterface{
+			Name: iface.Name,
+			Mac:  iface.HardwareAddr.String(),
+			Up:   iface.Flags&net.FlagUp != 0,
+			Mtu:  iface.MTU,
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", err
+		}
+
+		for _, addr := range addrs {
+			item.Addrs = append(item.Addrs, addr.String())
+		}
+
+		list = append(list, item)
+	}
+
+	if len(list) == 0 && params["name"] != "" {
+		return "", fmt.Errorf("network interface not found: %s", params["name"])
+	}
+
+	return compact("As interfaces de rede são", list)
 }
 
 type dateTool struct{}
 
+func (h dateTool) Name() string { return "date" }
+
+func (h dateTool) Description() string { return "data e hora atuais" }
+
+func (h dateTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"tz": {
+			"type": "string",
+			"description": "fuso horario IANA se a pergunta citar um, ex America/Sao_Paulo. Vazio para o fuso local"
+		}
+	}
+}`)
+}
+
 func (h dateTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
-	bs, err := exec.CommandContext(ctx, "date").CombinedOutput()
-	if err != nil {
-		return "", err
+	now := time.Now()
+
+	if tz := params["tz"]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return "", err
+		}
+
+		now = now.In(loc)
 	}
 
-	return "A data e hora atual é: " + strings.TrimSpace(string(bs)), nil
+	return fmt.Sprintf("A data e hora atual é: %s (%s, %s)",
+		now.Format(time.RFC3339), now.Location(), weekdays[now.Weekday()]), nil
 }
 
+var weekdays = [...]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"}
+
 type diskFreeTool struct{}
 
+func (h diskFreeTool) Name() string { return "df" }
+
+func (h diskFreeTool) Description() string { return "espaço livre em disco" }
+
+func (h diskFreeTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"mount": {
+			"type": "string",
+			"description": "ponto de montagem, ex / ou /home. Vazio para todos"
+		}
+	}
+}`)
+}
+
+type diskUsage struct {
+	Mount string `json:"mount"`
+	Fs    string `json:"fs"`
+	Size  string `json:"size"`
+	Used  string `json:"used"`
+	Free  string `json:"free"`
+	Use   string `json:"use"`
+}
+
 func (h diskFreeTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
-	bs, err := exec.CommandContext(ctx, "df", "-h").CombinedOutput()
+	disks, err := diskUsages(params["mount"])
+	if err != nil {
+		return "", err
+	}
+
+	if len(disks) == 0 && params["mount"] != "" {
+		return "", fmt.Errorf("mount point not found: %s", params["mount"])
+	}
+
+	return compact("As informações sobre disco livre são", disks)
+}
+
+type memoryTool struct{}
+
+func (h memoryTool) Name() string { return "memory" }
+
+func (h memoryTool) Description() string { return "memoria RAM e swap, total, usada e livre" }
+
+func (h memoryTool) Schema() json.RawMessage { return noParams }
+
+type memoryUsage struct {
+	Total     string `json:"total"`
+	Used      string `json:"used"`
+	Available string `json:"available"`
+	Use       string `json:"use"`
+	SwapTotal string `json:"swap_total"`
+	SwapUsed  string `json:"swap_used"`
+}
+
+func (h memoryTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	mem, err := memory()
+	if err != nil {
+		return "", err
+	}
+
+	return compact("As informações sobre memoria são", mem)
+}
+
+type loadTool struct{}
+
+func (h loadTool) Name() string { return "loadavg" }
+
+func (h loadTool) Description() string {
+	return "carga media (load average) da cpu no ultimo minuto, 5 e 15 minutos"
+}
+
+func (h loadTool) Schema() json.RawMessage { return noParams }
+
+type loadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+	Cpus   int     `json:"cpus"`
+}
+
+func (h loadTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	load, err := loadAvg()
+	if err != nil {
+		return "", err
+	}
+
+	return compact("A carga media da cpu é", load)
+}
+
+type uptimeTool struct{}
+
+func (h uptimeTool) Name() string { return "uptime" }
+
+func (h uptimeTool) Description() string {
+	return "há quanto tempo a maquina está ligada, desde o ultimo boot"
+}
+
+func (h uptimeTool) Schema() json.RawMessage { return noParams }
+
+func (h uptimeTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	up, err := uptime()
+	if err != nil {
+		return "", err
+	}
+
+	up = up.Truncate(time.Minute)
+
+	return fmt.Sprintf("A maquina está ligada há %s, desde %s", up, time.Now().Add(-up).Format(time.RFC3339)), nil
+}
+
+type processesTool struct{}
+
+func (h processesTool) Name() string { return "processes" }
+
+func (h processesTool) Description() string {
+	return "quantidade de processos em execução na maquina"
+}
+
+func (h processesTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"name": {
+			"type": "string",
+			"description": "nome do programa, para contar apenas os processos dele. Vazio para todos"
+		}
+	}
+}`)
+}
+
+func (h processesTool) Query(ctx context.Context, params map[string]string) (ret string, err error) {
+	names, err := processNames()
 	if err != nil {
 		return "", err
 	}
 
-	return "As informações sobre disco livre são: " + strings.TrimSpace(string(bs)), nil
+	name := params["name"]
+	if name == "" {
+		return fmt.Sprintf("Há %d processos em execução", len(names)), nil
+	}
+
+	n := 0
+
+	for _, p := range names {
+		if strings.EqualFold(p, name) {
+			n++
+		}
+	}
+
+	return fmt.Sprintf("Há %d processos %s em execução", n, name), nil
 }
@@ -0,0 +1,162 @@
+package tool
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// mntNowait has getfsstat return the cached stats instead of waiting on
+// every filesystem, as df does.
+const mntNowait = 2
+
+// pseudoFs are the filesystems df leaves out, as they hold no disk space.
+var pseudoFs = map[string]bool{"devfs": true, "autofs": true}
+
+func diskUsages(mount string) ([]diskUsage, error) {
+	n, err := syscall.Getfsstat(nil, mntNowait)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]syscall.Statfs_t, n)
+
+	if n, err = syscall.Getfsstat(buf, mntNowait); err != nil {
+		return nil, err
+	}
+
+	ret := []diskUsage{}
+
+	for _, st := range buf[:n] {
+		mnt, fs := cString(st.Mntonname[:]), cString(st.Fstypename[:])
+		if pseudoFs[fs] || st.Blocks == 0 || (mount != "" && mnt != mount) {
+			continue
+		}
+
+		bsize := uint64(st.Bsize)
+		size := st.Blocks * bsize
+		used := (st.Blocks - st.Bfree) * bsize
+
+		ret = append(ret, diskUsage{
+			Mount: mnt,
+			Fs:    fs,
+			Size:  humanBytes(size),
+			Used:  humanBytes(used),
+			Free:  humanBytes(st.Bavail * bsize),
+			Use:   percent(used, size),
+		})
+	}
+
+	return ret, nil
+}
+
+// cString reads a nul terminated string of a syscall struct.
+func cString(bs []int8) string {
+	ret := make([]byte, 0, len(bs))
+
+	for _, b := range bs {
+		if b == 0 {
+			break
+		}
+
+		ret = append(ret, byte(b))
+	}
+
+	return string(ret)
+}
+
+// memory reads the sizes from sysctl. Available counts the pages free or that
+// can be reclaimed right away: speculative, purgeable and file backed ones.
+func memory() (memoryUsage, error) {
+	total, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return memoryUsage{}, err
+	}
+
+	var pages uint64
+
+	for _, name := range []string{"vm.page_free_count", "vm.page_speculative_count", "vm.page_purgeable_count", "vm.page_pageable_external_count"} {
+		n, err := unix.SysctlUint32(name)
+		if err != nil {
+			return memoryUsage{}, err
+		}
+
+		pages += uint64(n)
+	}
+
+	available := min(pages*uint64(os.Getpagesize()), total)
+
+	// struct xsw_usage: total, avail and used, in bytes
+	swap, err := unix.SysctlRaw("vm.swapusage")
+	if err != nil {
+		return memoryUsage{}, err
+	}
+
+	if len(swap) < 24 {
+		return memoryUsage{}, errors.New("unexpected vm.swapusage size")
+	}
+
+	return memoryUsage{
+		Total:     humanBytes(total),
+		Used:      humanBytes(total - available),
+		Available: humanBytes(available),
+		Use:       percent(total-available, total),
+		SwapTotal: humanBytes(binary.NativeEndian.Uint64(swap[0:])),
+		SwapUsed:  humanBytes(binary.NativeEndian.Uint64(swap[16:])),
+	}, nil
+}
+
+// loadAvg reads struct loadavg: three fixed point loads, then their scale as
+// a long, aligned to 8 bytes.
+func loadAvg() (loadAverage, error) {
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		return loadAverage{}, err
+	}
+
+	if len(raw) < 24 {
+		return loadAverage{}, errors.New("unexpected vm.loadavg size")
+	}
+
+	scale := float64(binary.NativeEndian.Uint64(raw[16:]))
+	if scale == 0 {
+		return loadAverage{}, errors.New("vm.loadavg without a scale")
+	}
+
+	ret := loadAverage{Cpus: runtime.NumCPU()}
+
+	for i, dst := range []*float64{&ret.Load1, &ret.Load5, &ret.Load15} {
+		*dst = float64(binary.NativeEndian.Uint32(raw[i*4:])) / scale
+	}
+
+	return ret, nil
+}
+
+func uptime() (time.Duration, error) {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(time.Unix(tv.Unix())).Truncate(time.Second), nil
+}
+
+func processNames() ([]string, error) {
+	procs, err := unix.SysctlKinfoProcSlice("kern.proc.all")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(procs))
+
+	for _, p := range procs {
+		ret = append(ret, unix.ByteSliceToString(p.Proc.P_comm[:]))
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,156 @@
+package tool
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pseudoFs are the filesystems df leaves out, as they hold no disk space.
+var pseudoFs = map[string]bool{
+	"proc": true, "sysfs": true, "devpts": true, "cgroup": true, "cgroup2": true, "mqueue": true,
+	"securityfs": true, "debugfs": true, "tracefs": true, "pstore": true, "bpf": true, "autofs": true,
+	"configfs": true, "fusectl": true, "hugetlbfs": true, "binfmt_misc": true, "nsfs": true, "devtmpfs": true,
+}
+
+func diskUsages(mount string) ([]diskUsage, error) {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := []diskUsage{}
+	seen := map[string]bool{}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || pseudoFs[fields[2]] || seen[fields[1]] {
+			continue
+		}
+
+		if mount != "" && fields[1] != mount {
+			continue
+		}
+
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(fields[1], &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+
+		seen[fields[1]] = true
+
+		bsize := uint64(st.Bsize) //nolint:gosec
+		size := st.Blocks * bsize
+		used := (st.Blocks - st.Bfree) * bsize
+
+		ret = append(ret, diskUsage{
+			Mount: fields[1],
+			Fs:    fields[2],
+			Size:  humanBytes(size),
+			Used:  humanBytes(used),
+			Free:  humanBytes(st.Bavail * bsize),
+			Use:   percent(used, size),
+		})
+	}
+
+	return ret, sc.Err()
+}
+
+func memory() (memoryUsage, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return memoryUsage{}, err
+	}
+	defer f.Close()
+
+	kb := map[string]uint64{}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(v), " kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		kb[k] = n * 1024
+	}
+
+	if err = sc.Err(); err != nil {
+		return memoryUsage{}, err
+	}
+
+	total, available := kb["MemTotal"], kb["MemAvailable"]
+
+	return memoryUsage{
+		Total:     humanBytes(total),
+		Used:      humanBytes(total - available),
+		Available: humanBytes(available),
+		Use:       percent(total-available, total),
+		SwapTotal: humanBytes(kb["SwapTotal"]),
+		SwapUsed:  humanBytes(kb["SwapTotal"] - kb["SwapFree"]),
+	}, nil
+}
+
+func loadAvg() (loadAverage, error) {
+	bs, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return loadAverage{}, err
+	}
+
+	fields := strings.Fields(string(bs))
+	if len(fields) < 3 {
+		return loadAverage{}, errUnsupported
+	}
+
+	ret := loadAverage{Cpus: runtime.NumCPU()}
+
+	for i, dst := range []*float64{&ret.Load1, &ret.Load5, &ret.Load15} {
+		if *dst, err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return loadAverage{}, err
+		}
+	}
+
+	return ret, nil
+}
+
+func uptime() (time.Duration, error) {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(info.Uptime) * time.Second, nil
+}
+
+func processNames() ([]string, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(dirs))
+
+	for _, comm := range dirs {
+		bs, err := os.ReadFile(comm)
+		if err != nil {
+			// the process ended since the glob
+			continue
+		}
+
+		ret = append(ret, strings.TrimSpace(string(bs)))
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package tool
+
+import "time"
+
+func diskUsages(string) ([]diskUsage, error) { return nil, errUnsupported }
+
+func memory() (memoryUsage, error) { return memoryUsage{}, errUnsupported }
+
+func loadAvg() (loadAverage, error) { return loadAverage{}, errUnsupported }
+
+func uptime() (time.Duration, error) { return 0, errUnsupported }
+
+func processNames() ([]string, error) { return nil, errUnsupported }
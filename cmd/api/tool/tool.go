@@ -1,59 +1,297 @@
 package tool
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
-	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
-	"github.com/pressly/goose/v3"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+
+	"gophercon-2025/cmd/api/sqldb"
 )
 
+// Tool is something the llm can run to get data it does not have. Schema is
+// the JSON schema of the params, whose values are always strings.
 type Tool interface {
+	Name() string
+	Description() string
+	Schema() json.RawMessage
 	Query(ctx context.Context, params map[string]string) (ret string, err error)
 }
 
+// Descriptor is what is known about a tool without running it.
+type Descriptor struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+func describe(t Tool) Descriptor {
+	return Descriptor{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Schema:      t.Schema(),
+	}
+}
+
+// noParams is the schema of tools taking no params.
+var noParams = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// Property is a param declared by a tool schema.
+type Property struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Properties lists the params declared by a schema, sorted by name.
+func Properties(schema json.RawMessage) []Property {
+	var s struct {
+		Properties map[string]struct {
+			Description string `json:"description"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}
+
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil
+	}
+
+	ret := make([]Property, 0, len(s.Properties))
+	for name, p := range s.Properties {
+		ret = append(ret, Property{
+			Name:        name,
+			Description: p.Description,
+			Required:    slices.Contains(s.Required, name),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// HasParams tells whether a schema declares any property, so callers can skip
+// extracting params for tools that take none.
+func HasParams(schema json.RawMessage) bool {
+	return len(Properties(schema)) > 0
+}
+
+var ErrUnknownTool = errors.New("unknown tool")
+
 type Service struct {
-	tools       map[string]Tool
-	defaultTool Tool
-	tracer      trace.Tracer
+	mu     sync.RWMutex
+	tools  map[string]Tool
+	tracer trace.Tracer
+
+	timeout   time.Duration
+	maxOutput int
+	sem       chan struct{}
+	limits    map[string]Limit
+	policies  Policies
+
+	db       *sql.DB
+	dialect  sqldb.Dialect
+	kpiTools map[string]bool
+
+	configPath    string
+	configModTime time.Time
+	configured    map[string]bool
+
+	mcpMu      sync.Mutex
+	mcpServers map[string]*mcpServer
+
+	hooksMu sync.Mutex
+	hooks   []ChangeFunc
+}
+
+// ChangeFunc is called after the registered tools change.
+type ChangeFunc func(ctx context.Context) error
+
+// OnChange registers fn to be called whenever tools are added or removed, so
+// whatever was derived from the registry can be rebuilt.
+func (s *Service) OnChange(fn ChangeFunc) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+
+	s.hooks = append(s.hooks, fn)
+}
+
+func (s *Service) changed(ctx context.Context) {
+	s.hooksMu.Lock()
+	hooks := s.hooks
+	s.hooksMu.Unlock()
+
+	for _, fn := range hooks {
+		if err := fn(ctx); err != nil {
+			slog.Warn("Tool change hook failed", "err", err)
+		}
+	}
 }
 
+// Query runs a tool for the scope of ctx, within its limits. Names not
+// registered and tools denied by the policies fail without running anything.
 func (s *Service) Query(ctx context.Context, toolName string, params map[string]string) (ret string, err error) {
-	ctx, span := s.tracer.Start(ctx, "tool.Query")
+	ctx, span := s.tracer.Start(ctx, "tool.Query", trace.WithAttributes(attribute.String("tool", toolName)))
 	defer func() {
 		span.RecordError(err)
 		span.End()
 	}()
 
+	tool, err := s.lookup(ctx, toolName)
+	if err != nil {
+		return "", err
+	}
+
+	if params == nil {
+		params = map[string]string{}
+	}
+
 	params["tool"] = toolName
 
-	tool, ok := s.tools[toolName]
+	ret, err = s.run(ctx, tool, params)
+
+	span.SetAttributes(attribute.Int("output", len(ret)))
+
+	return ret, err
+}
+
+// Check tells whether a tool exists and may run for the scope of ctx.
+func (s *Service) Check(ctx context.Context, name string) error {
+	_, err := s.lookup(ctx, name)
+
+	return err
+}
+
+func (s *Service) lookup(ctx context.Context, name string) (Tool, error) {
+	s.mu.RLock()
+	tool, ok := s.tools[name]
+	policies := s.policies
+	s.mu.RUnlock()
+
 	if !ok {
-		return s.defaultTool.Query(ctx, params)
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
 	}
 
-	return tool.Query(ctx, params)
+	if err := policies.check(ScopeFrom(ctx), name); err != nil {
+		return nil, err
+	}
+
+	return tool, nil
 }
 
-type Option func(service *Service)
+// Register adds a tool to the registry.
+func (s *Service) Register(t Tool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tools[t.Name()]; ok {
+		return fmt.Errorf("tool already registered: %s", t.Name())
+	}
+
+	s.tools[t.Name()] = t
+
+	return nil
+}
+
+// List describes every registered tool, sorted by name.
+func (s *Service) List() []Descriptor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-//go:embed migrations/*.sql
-var embedMigrations embed.FS
+	ret := make([]Descriptor, 0, len(s.tools))
+	for _, t := range s.tools {
+		ret = append(ret, describe(t))
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// Describe returns the descriptor of a registered tool.
+func (s *Service) Describe(name string) (Descriptor, bool) {
+	s.mu.RLock()
+	t, ok := s.tools[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return Descriptor{}, false
+	}
+
+	return describe(t), true
+}
 
-func WithDb(db *sql.DB) Option {
+// replaceOwned swaps the tools of registry named in owned for tools and updates
+// owned. Tools clashing with one owned by someone else are skipped, the one
+// registered first is kept. It tells whether the descriptors changed. Callers
+// hold the registry lock.
+func replaceOwned(registry map[string]Tool, owned *map[string]bool, tools []Tool) bool {
+	before := map[string]Descriptor{}
+
+	for name := range *owned {
+		before[name] = describe(registry[name])
+		delete(registry, name)
+	}
+
+	changed := false
+
+	*owned = map[string]bool{}
+
+	for _, t := range tools {
+		if _, ok := registry[t.Name()]; ok {
+			slog.Warn("Tool name already taken, skipping it", "tool", t.Name())
+			continue
+		}
+
+		registry[t.Name()] = t
+		(*owned)[t.Name()] = true
+
+		if prev, ok := before[t.Name()]; !ok || !sameDescriptor(prev, describe(t)) {
+			changed = true
+		}
+	}
+
+	return changed || len(before) != len(*owned)
+}
+
+func sameDescriptor(a, b Descriptor) bool {
+	return a.Name == b.Name && a.Description == b.Description && bytes.Equal(a.Schema, b.Schema)
+}
+
+type Option func(service *Service)
+
+// WithDb migrates the tool db and registers a tool for every KPI in it. A nil
+// db leaves the KPI tools disabled.
+func WithDb(db *sql.DB, dialect sqldb.Dialect) Option {
 	return func(service *Service) {
-		goose.SetBaseFS(embedMigrations)
+		if db == nil {
+			return
+		}
 
-		if err := goose.SetDialect("postgres"); err != nil {
+		if err := migrate(context.Background(), db, dialect); err != nil {
 			panic(err)
 		}
 
-		if err := goose.Up(db, "migrations"); err != nil {
+		service.db = db
+		service.dialect = dialect
+
+		if err := service.refreshKpis(context.Background()); err != nil {
 			panic(err)
 		}
-
-		service.defaultTool = &dbTool{db: db}
 	}
 }
 
@@ -65,12 +303,20 @@ func WithTracer(t trace.Tracer) Option {
 
 func New(opts ...Option) *Service {
 	ret := &Service{
-		tools: map[string]Tool{
-			"df":       &diskFreeTool{},
-			"hostname": &hostnameTool{},
-			"ifconfig": &ifconfigTool{},
-			"date":     &dateTool{},
-		},
+		tools:      map[string]Tool{},
+		configured: map[string]bool{},
+		kpiTools:   map[string]bool{},
+		mcpServers: map[string]*mcpServer{},
+		timeout:    DefaultTimeout,
+		maxOutput:  DefaultMaxOutput,
+		sem:        make(chan struct{}, DefaultConcurrency),
+	}
+
+	for _, t := range []Tool{
+		&diskFreeTool{}, &hostnameTool{}, &ifconfigTool{}, &dateTool{},
+		&memoryTool{}, &loadTool{}, &uptimeTool{}, &processesTool{},
+	} {
+		ret.tools[t.Name()] = t
 	}
 
 	for _, opt := range opts {
@@ -0,0 +1,149 @@
+package vecdb
+
+import (
+	"context"
+	"io"
+	"maps"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// ExportPage is how many documents are held at once while exporting.
+const ExportPage = 256
+
+// Index keeps the ids and metadata of the documents of a collection, so they
+// can be listed and filtered without a gob export of the collection each
+// time. It is read back from the collection once and kept in sync by the
+// service owning it.
+type Index struct {
+	mu   sync.RWMutex
+	meta map[string]map[string]string
+}
+
+func NewIndex(docs ...chromem.Document) *Index {
+	ret := &Index{meta: make(map[string]map[string]string, len(docs))}
+	ret.Add(docs...)
+
+	return ret
+}
+
+// LoadIndex indexes the documents of a collection.
+func LoadIndex(db *chromem.DB, collection string) (*Index, error) {
+	docs, err := Documents(db, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIndex(docs...), nil
+}
+
+// Add indexes docs, replacing the ones already indexed with the same id.
+func (x *Index) Add(docs ...chromem.Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, doc := range docs {
+		x.meta[doc.ID] = maps.Clone(doc.Metadata)
+	}
+}
+
+func (x *Index) Remove(ids ...string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range ids {
+		delete(x.meta, id)
+	}
+}
+
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.meta)
+}
+
+// Meta returns the metadata of a document, which must not be changed.
+func (x *Index) Meta(id string) (map[string]string, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	ret, ok := x.meta[id]
+
+	return ret, ok
+}
+
+// Select returns the ids of the documents whose metadata fn accepts, sorted.
+// fn must not change the metadata.
+func (x *Index) Select(fn func(id string, meta map[string]string) bool) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var ret []string
+
+	for id, meta := range x.meta {
+		if fn == nil || fn(id, meta) {
+			ret = append(ret, id)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// Where returns the ids of the documents whose metadata has every value of
+// where, sorted.
+func (x *Index) Where(where map[string]string) []string {
+	return x.Select(func(_ string, meta map[string]string) bool {
+		for k, v := range where {
+			if meta[k] != v {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// WriteDocuments writes the documents ids of col as JSONL, reading them a page
+// at a time, so the collection is never held in memory whole. Documents
+// deleted meanwhile are skipped. Writers with a Flush method are flushed after
+// every page.
+func WriteDocuments(ctx context.Context, w io.Writer, col *chromem.Collection, ids []string, namespace string, embeddings bool) (n int, err error) {
+	page := make([]Record, 0, ExportPage)
+
+	for ini := 0; ini < len(ids); ini += ExportPage {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		page = page[:0]
+
+		for _, id := range ids[ini:min(ini+ExportPage, len(ids))] {
+			// it only fails for documents no longer there
+			doc, err := col.GetByID(ctx, id)
+			if err != nil {
+				continue
+			}
+
+			page = append(page, NewRecord(doc, namespace, embeddings))
+		}
+
+		if err := WriteRecords(w, page...); err != nil {
+			return n, err
+		}
+
+		n += len(page)
+
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,174 @@
+// Package vecdb holds helpers shared by the services backed by chromem
+// collections, mainly the JSONL format used to export and import them.
+package vecdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/philippgille/chromem-go"
+)
+
+var ErrInvalidRecord = errors.New("invalid record")
+
+// ImportBatch is how many records are embedded and added at once on import.
+const ImportBatch = 64
+
+// maxLineBytes bounds a single JSONL record, embeddings included.
+const maxLineBytes = 16 * 1024 * 1024
+
+// Record is a single line of a JSONL export.
+type Record struct {
+	ID        string            `json:"id"`
+	Namespace string            `json:"namespace,omitempty"`
+	Content   string            `json:"content"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Embedding []float32         `json:"embedding,omitempty"`
+}
+
+func (r Record) Document() chromem.Document {
+	return chromem.Document{
+		ID:        r.ID,
+		Metadata:  r.Meta,
+		Embedding: r.Embedding,
+		Content:   r.Content,
+	}
+}
+
+func NewRecord(doc chromem.Document, namespace string, embeddings bool) Record {
+	ret := Record{
+		ID:        doc.ID,
+		Namespace: namespace,
+		Content:   doc.Content,
+		Meta:      doc.Metadata,
+	}
+
+	if embeddings {
+		ret.Embedding = doc.Embedding
+	}
+
+	return ret
+}
+
+// Documents returns every document of a collection sorted by id. chromem has
+// no way of listing documents, so they are read back from a gob export, which
+// holds the whole collection in memory: it is meant for loading an Index.
+func Documents(db *chromem.DB, collection string) ([]chromem.Document, error) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(db.ExportToWriter(pw, false, "", collection))
+	}()
+
+	var export struct {
+		Collections map[string]*struct {
+			Name      string
+			Documents map[string]*chromem.Document
+		}
+	}
+
+	if err := gob.NewDecoder(pr).Decode(&export); err != nil {
+		pr.CloseWithError(err)
+		return nil, fmt.Errorf("reading collection %s: %w", collection, err)
+	}
+
+	// drains the exporter so it is never left blocked on the pipe
+	_, _ = io.Copy(io.Discard, pr)
+
+	col, ok := export.Collections[collection]
+	if !ok {
+		return nil, nil
+	}
+
+	ret := make([]chromem.Document, 0, len(col.Documents))
+	for _, doc := range col.Documents {
+		ret = append(ret, *doc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+
+	return ret, nil
+}
+
+// WriteRecords writes records as JSONL.
+func WriteRecords(w io.Writer, records ...Record) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadRecords reads JSONL records, calling fn with batches of up to
+// ImportBatch records. Blank lines are skipped.
+func ReadRecords(ctx context.Context, r io.Reader, fn func(batch []Record) error) (n int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+
+	batch := make([]Record, 0, ImportBatch)
+	line := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := fn(batch); err != nil {
+			return err
+		}
+
+		n += len(batch)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		line++
+
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		bs := scanner.Bytes()
+		if len(bs) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(bs, &rec); err != nil {
+			return n, fmt.Errorf("%w: line %d: %w", ErrInvalidRecord, line, err)
+		}
+
+		if rec.ID == "" || rec.Content == "" {
+			return n, fmt.Errorf("%w: line %d: id and content are required", ErrInvalidRecord, line)
+		}
+
+		batch = append(batch, rec)
+
+		if len(batch) == ImportBatch {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+
+	return n, flush()
+}
@@ -0,0 +1,196 @@
+// mcp-stub is a fake ticketing and inventory mcp server, to try the mcp
+// client of the api without the real servers. It serves over stdio unless an
+// http address is given, and can add and remove a tool now and then to
+// exercise the list_changed notifications.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/urfave/cli/v3"
+)
+
+type ticketArgs struct {
+	Id string `json:"id" jsonschema:"numero do chamado, ex INC-1234"`
+}
+
+type ticket struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Owner  string `json:"owner"`
+	Title  string `json:"title"`
+}
+
+var tickets = map[string]ticket{
+	"INC-1001": {Id: "INC-1001", Status: "aberto", Owner: "time-infra", Title: "disco cheio no servidor de build"},
+	"INC-1002": {Id: "INC-1002", Status: "em andamento", Owner: "time-dados", Title: "atraso na carga do dw"},
+	"INC-1003": {Id: "INC-1003", Status: "resolvido", Owner: "time-rede", Title: "perda de pacotes na vpn"},
+}
+
+func ticketStatus(_ context.Context, _ *mcp.CallToolRequest, args ticketArgs) (*mcp.CallToolResult, ticket, error) {
+	t, ok := tickets[strings.ToUpper(args.Id)]
+	if !ok {
+		return nil, ticket{}, fmt.Errorf("chamado não encontrado: %s", args.Id)
+	}
+
+	return nil, t, nil
+}
+
+type stockArgs struct {
+	Item string `json:"item" jsonschema:"nome do item do estoque, ex notebook"`
+}
+
+type stock struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	Location string `json:"location"`
+}
+
+var inventory = map[string]stock{
+	"notebook": {Item: "notebook", Quantity: 12, Location: "almoxarifado SP"},
+	"monitor":  {Item: "monitor", Quantity: 30, Location: "almoxarifado SP"},
+	"headset":  {Item: "headset", Quantity: 0, Location: "almoxarifado RJ"},
+}
+
+func stockLevel(_ context.Context, _ *mcp.CallToolRequest, args stockArgs) (*mcp.CallToolResult, stock, error) {
+	s, ok := inventory[strings.ToLower(args.Item)]
+	if !ok {
+		return nil, stock{}, fmt.Errorf("item não encontrado: %s", args.Item)
+	}
+
+	return nil, s, nil
+}
+
+type auditArgs struct{}
+
+type audit struct {
+	LastAudit string `json:"last_audit"`
+	Items     int    `json:"items"`
+}
+
+func stockAudit(_ context.Context, _ *mcp.CallToolRequest, _ auditArgs) (*mcp.CallToolResult, audit, error) {
+	return nil, audit{LastAudit: time.Now().AddDate(0, 0, -3).Format(time.DateOnly), Items: len(inventory)}, nil
+}
+
+func newServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "mcp-stub", Version: "1.0.0"}, nil)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "ticket_status",
+		Description: "situação, responsável e título de um chamado do service desk",
+	}, ticketStatus)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "stock_level",
+		Description: "quantidade em estoque e localização de um item do inventário",
+	}, stockLevel)
+
+	return server
+}
+
+// churn adds and removes the audit tool every interval, until ctx is done.
+func churn(ctx context.Context, server *mcp.Server, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	on := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		on = !on
+
+		if on {
+			mcp.AddTool(server, &mcp.Tool{
+				Name:        "stock_audit",
+				Description: "data da ultima auditoria do inventário",
+			}, stockAudit)
+		} else {
+			server.RemoveTools("stock_audit")
+		}
+
+		slog.Info("Tool list changed", "stock_audit", on)
+	}
+}
+
+func run(ctx context.Context, addr string, churnEvery time.Duration) error {
+	server := newServer()
+
+	if churnEvery > 0 {
+		go churn(ctx, server, churnEvery)
+	}
+
+	if addr == "" {
+		return server.Run(ctx, &mcp.StdioTransport{})
+	}
+
+	httpServer := &http.Server{
+		Addr: addr,
+		Handler: mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+			return server
+		}, nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		httpServer.Close() //nolint:errcheck
+	}()
+
+	slog.Info("Serving mcp over http", "addr", addr)
+
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// stdout carries the protocol over stdio
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	var (
+		addr       string
+		churnEvery time.Duration
+	)
+
+	if err := (&cli.Command{
+		Name:  "mcp-stub",
+		Usage: "Fake ticketing and inventory mcp server",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "http",
+				Usage:       "address to serve streamable http at, stdio when empty",
+				Destination: &addr,
+			},
+			&cli.DurationFlag{
+				Name:        "churn",
+				Usage:       "adds and removes a tool every interval, 0 disables it",
+				Destination: &churnEvery,
+			},
+		},
+		Action: func(ctx context.Context, command *cli.Command) error {
+			return run(ctx, addr, churnEvery)
+		},
+	}).Run(ctx, os.Args); err != nil {
+		slog.Error("mcp-stub failed", "err", err)
+		os.Exit(1)
+	}
+}